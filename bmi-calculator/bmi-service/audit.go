@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"bmi-calculator/logging"
+)
+
+// auditRecord is one line of the audit log. It holds the caller's inputs and
+// address as given, which are personal data: route the audit log somewhere with
+// access controls.
+type auditRecord struct {
+	Event       string         `json:"event"`
+	Timestamp   string         `json:"timestamp"`
+	ClientIP    string         `json:"client_ip"`
+	Endpoint    string         `json:"endpoint"`
+	Calculation BMICalculation `json:"calculation"`
+}
+
+// auditLogger writes a JSON line per stored calculation through its own logger,
+// apart from the request logs, so it can be shipped and retained independently.
+// A nil *auditLogger records nothing.
+type auditLogger struct {
+	out *log.Logger
+	// file is nil when the audit log goes to stdout
+	file *logging.RotatingFile
+}
+
+// newAuditLogger writes to path, rotated like LOG_FILE, or to stdout when path is
+// empty; request logs go to stderr, so the two streams stay apart either way.
+func newAuditLogger(path string, maxSizeMB, maxBackups int) (*auditLogger, error) {
+	if path == "" {
+		return &auditLogger{out: log.New(os.Stdout, "", 0)}, nil
+	}
+	rf, err := logging.OpenRotatingFile(path, int64(maxSizeMB)<<20, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogger{out: log.New(rf, "", 0), file: rf}, nil
+}
+
+// CheckWritable reports whether the audit file can still be written; stdout, and
+// a nil *auditLogger, always can.
+func (a *auditLogger) CheckWritable() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	return a.file.CheckWritable()
+}
+
+// Record logs c; call it only once c has been stored.
+func (a *auditLogger) Record(r *http.Request, c BMICalculation) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(auditRecord{
+		Event:       "calculation",
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		ClientIP:    clientIPs.FromRequest(r),
+		Endpoint:    r.URL.Path,
+		Calculation: c,
+	})
+	if err != nil {
+		log.Printf("Error encoding audit record: %v", err)
+		return
+	}
+	a.out.Println(string(line))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	freshStore(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := newAuditLogger(path, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.file.Close() })
+	audit = a
+
+	var want []float64
+	for _, body := range []string{`{"weight": 70, "height": 1.75}`, `{"weight": 90, "height": 1.80}`} {
+		rec := postCalculate(t, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d: %s", body, rec.Code, rec.Body)
+		}
+		var c BMICalculation
+		if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, c.BMI)
+	}
+	// Neither a rejected request nor a failed write stores anything to audit
+	if rec := postCalculate(t, `{"weight": -1, "height": 1.75}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid weight = %d, want 400", rec.Code)
+	}
+	store.failureRate = 1
+	if rec := postCalculate(t, `{"weight": 70, "height": 1.75}`); rec.Code == http.StatusOK {
+		t.Fatalf("failed write = 200, want an error")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []auditRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit line %q is not JSON: %v", scanner.Text(), err)
+		}
+		got = append(got, record)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d audit lines, want one per stored calculation (%d)", len(got), len(want))
+	}
+	for i, record := range got {
+		if record.Event != "calculation" || record.Endpoint != "/calculate" || record.ClientIP == "" || record.Timestamp == "" {
+			t.Errorf("line %d = %+v, want a calculation event from /calculate with a client and a timestamp", i+1, record)
+		}
+		if record.Calculation.BMI != want[i] || record.Calculation.ID == 0 {
+			t.Errorf("line %d records BMI %v with ID %d, want the stored BMI %v", i+1, record.Calculation.BMI, record.Calculation.ID, want[i])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock supplies the time stamped on calculations. Everything else, from log and
+// audit timestamps to elapsed-time measurements, uses the time package directly,
+// so probes and logging never move a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// fakeClock starts at a fixed time and moves forward by step on every reading, so
+// timestamps come out identical on every run; a zero step freezes it.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func newFakeClock(start time.Time, step time.Duration) *fakeClock {
+	return &fakeClock{now: start, step: step}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// clock is the real clock unless FAKE_CLOCK freezes it at startup.
+var clock Clock = realClock{}
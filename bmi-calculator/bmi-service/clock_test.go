@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFakeClockTimestamps(t *testing.T) {
+	freshStore(t)
+	defer func(old Clock) { clock = old }(clock)
+	clock = newFakeClock(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), time.Minute)
+
+	want := []string{"2026-01-02T03:04:05Z", "2026-01-02T03:05:05Z", "2026-01-02T03:06:05Z"}
+	for i, ts := range want {
+		rec := postCalculate(t, `{"weight": 70, "height": 1.75}`)
+		var c BMICalculation
+		if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Timestamp != ts {
+			t.Errorf("calculation %d stamped %q, want %q", i+1, c.Timestamp, ts)
+		}
+	}
+
+	rec := getHistory(t, "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /history = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Calculations []BMICalculation `json:"calculations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Calculations) != len(want) {
+		t.Fatalf("history has %d calculations, want %d", len(body.Calculations), len(want))
+	}
+	for i, c := range body.Calculations {
+		if c.Timestamp != want[i] {
+			t.Errorf("history entry %d stamped %q, want %q", i+1, c.Timestamp, want[i])
+		}
+	}
+
+	frozen := newFakeClock(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), 0)
+	if a, b := frozen.Now(), frozen.Now(); !a.Equal(b) {
+		t.Errorf("zero-step clock moved from %v to %v", a, b)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+const (
+	mediaTypeJSON      = "application/json"
+	mediaTypeForm      = "application/x-www-form-urlencoded"
+	mediaTypeCSV       = "text/csv"
+	mediaTypeMultipart = "multipart/form-data"
+)
+
+// requireContentType rejects with 415 a request whose Content-Type is not one of
+// mediaTypes, parameters such as charset allowed. A request with neither a body
+// nor the header is let through so the handler answers it with its usual 400.
+func requireContentType(next http.Handler, mediaTypes ...string) http.Handler {
+	message := "Content-Type must be " + strings.Join(mediaTypes, " or ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" && r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			for _, allowed := range mediaTypes {
+				if mediaType == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		respond.Error(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", message)
+	})
+}
+
+// isForm reports whether r carries a form-encoded body.
+func isForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mediaTypeForm
+}
+
+// isMultipart reports whether r carries a multipart form, e.g. a file upload.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mediaTypeMultipart
+}
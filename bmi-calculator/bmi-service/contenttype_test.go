@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireContentType(t *testing.T) {
+	h := requireContentType(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), mediaTypeJSON)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", "application/json", `{"weight":70,"height":1.75}`, http.StatusNoContent},
+		{"json with charset", "application/json; charset=utf-8", `{"weight":70,"height":1.75}`, http.StatusNoContent},
+		{"no header and no body", "", "", http.StatusNoContent},
+		{"missing", "", `{"weight":70,"height":1.75}`, http.StatusUnsupportedMediaType},
+		{"text", "text/plain", `{"weight":70,"height":1.75}`, http.StatusUnsupportedMediaType},
+		{"form", "application/x-www-form-urlencoded", "weight=70&height=1.75", http.StatusUnsupportedMediaType},
+		{"malformed", "application/", `{}`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/calculate/batch", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnsupportedMediaType && !strings.Contains(rec.Body.String(), "unsupported_media_type") {
+				t.Errorf("body = %s, want the unsupported_media_type error", rec.Body)
+			}
+		})
+	}
+}
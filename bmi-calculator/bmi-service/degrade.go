@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"bmi-calculator/respond"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	degradeOnStorageError = getEnv("DEGRADE_ON_STORAGE_ERROR", "false") == "true"
+
+	degradedResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bmi_degraded_responses_total",
+		Help: "Calculations returned without being stored because the history store failed",
+	}, []string{"endpoint"})
+)
+
+// storeCalculation adds calculation to the history and audit log. When the store
+// fails and DEGRADE_ON_STORAGE_ERROR is set, the calculation is marked degraded
+// and the caller answers with it anyway: the BMI needs nothing from storage, so
+// losing the history entry beats losing the response. It reports whether the
+// caller should go on to write calculation; if not, an error was written.
+func storeCalculation(w http.ResponseWriter, r *http.Request, calculation *BMICalculation) bool {
+	err := store.Add(r.Context(), calculation)
+	if err == nil {
+		audit.Record(r, *calculation)
+		return true
+	}
+	if errors.Is(err, errStorageUnavailable) && degradeOnStorageError {
+		log.Printf("Degraded: %s %s answered without storing the calculation: %v", r.Method, r.URL.Path, err)
+		degradedResponses.WithLabelValues(routeTemplate(r)).Inc()
+		calculation.Degraded = true
+		return true
+	}
+	writeStoreError(w, r, err)
+	return false
+}
+
+// writeStoreError answers a failed store operation: 503 when the store itself is
+// unavailable, else the status for the request context that ended.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errStorageUnavailable) {
+		log.Printf("Storage error: %s %s: %v", r.Method, r.URL.Path, err)
+		respond.Error(w, r, http.StatusServiceUnavailable, "storage_unavailable", err.Error())
+		return
+	}
+	writeContextError(w, r, err)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDegradeOnStorageError(t *testing.T) {
+	defer func(old bool) { degradeOnStorageError = old }(degradeOnStorageError)
+	const body = `{"weight": 70, "height": 1.75}`
+
+	t.Run("degraded", func(t *testing.T) {
+		freshStore(t)
+		store.failureRate = 1
+		degradeOnStorageError = true
+		before := testutil.ToFloat64(degradedResponses.WithLabelValues("/calculate"))
+
+		rec := postCalculate(t, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want a 200 despite the storage error: %s", rec.Code, rec.Body)
+		}
+		var c BMICalculation
+		if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		if !c.Degraded || math.Round(c.BMI*100)/100 != 22.86 || c.ID != 0 {
+			t.Errorf("response = %+v, want BMI 22.86 flagged degraded and never given an ID", c)
+		}
+		if stored, _ := store.List(context.Background()); len(stored) != 0 {
+			t.Errorf("stored %d calculations, want persistence skipped", len(stored))
+		}
+		if got := testutil.ToFloat64(degradedResponses.WithLabelValues("/calculate")) - before; got != 1 {
+			t.Errorf("bmi_degraded_responses_total grew by %v, want 1", got)
+		}
+	})
+
+	t.Run("not degraded", func(t *testing.T) {
+		freshStore(t)
+		store.failureRate = 1
+		degradeOnStorageError = false
+
+		rec := postCalculate(t, body)
+		var e struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &e)
+		if rec.Code != http.StatusServiceUnavailable || e.Code != "storage_unavailable" {
+			t.Errorf("status = %d, code %q; want 503 storage_unavailable", rec.Code, e.Code)
+		}
+	})
+
+	t.Run("healthy store", func(t *testing.T) {
+		freshStore(t)
+		degradeOnStorageError = true
+
+		rec := postCalculate(t, body)
+		if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "degraded") {
+			t.Errorf("status = %d, body %s; want a stored result without the degraded flag", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"bmi-calculator/respond"
+
+	"github.com/gorilla/mux"
+)
+
+// deleteHistoryHandler removes one calculation by ID, e.g. to correct a mistaken
+// entry during a demo.
+func deleteHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	raw := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "id must be a positive integer")
+		return
+	}
+
+	found, err := store.Delete(r.Context(), id)
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+	if !found {
+		respond.Error(w, r, http.StatusNotFound, "not_found", "no calculation with id "+raw)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
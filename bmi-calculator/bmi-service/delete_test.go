@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func deleteEntry(id string) int {
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/history/"+id, nil), map[string]string{"id": id})
+	rec := httptest.NewRecorder()
+	deleteHistoryHandler(rec, r)
+	return rec.Code
+}
+
+func TestDeleteHistoryEntry(t *testing.T) {
+	freshStore(t)
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		var c BMICalculation
+		if err := json.Unmarshal(postCalculate(t, `{"weight": 70, "height": 1.75}`).Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, c.ID)
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Fatalf("ids = %v, want each calculation its own", ids)
+	}
+
+	middle := strconv.FormatUint(ids[1], 10)
+	if code := deleteEntry(middle); code != http.StatusNoContent {
+		t.Fatalf("DELETE /history/%s = %d, want 204", middle, code)
+	}
+	calculations, _ := store.List(context.Background())
+	if len(calculations) != 2 || calculations[0].ID != ids[0] || calculations[1].ID != ids[2] {
+		t.Errorf("history after the delete = %+v, want ids %d and %d kept", calculations, ids[0], ids[2])
+	}
+	// IDs don't shift when an earlier entry goes, so a page still shows the same ones
+	var page struct {
+		Calculations []BMICalculation `json:"calculations"`
+	}
+	json.Unmarshal(getHistory(t, "offset=1", "").Body.Bytes(), &page)
+	if len(page.Calculations) != 1 || page.Calculations[0].ID != ids[2] {
+		t.Errorf("?offset=1 = %+v, want only id %d", page.Calculations, ids[2])
+	}
+
+	if code := deleteEntry(middle); code != http.StatusNotFound {
+		t.Errorf("deleting %s again = %d, want 404", middle, code)
+	}
+	if code := deleteEntry("999999"); code != http.StatusNotFound {
+		t.Errorf("DELETE of an unknown id = %d, want 404", code)
+	}
+	if code := deleteEntry("18446744073709551616"); code != http.StatusBadRequest {
+		t.Errorf("DELETE of an id past uint64 = %d, want 400", code)
+	}
+}
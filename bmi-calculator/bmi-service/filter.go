@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// historyFilter narrows /history to the calculations matching every query
+// parameter given; without parameters it matches everything.
+type historyFilter struct {
+	minBMI, maxBMI float64
+	category       string
+}
+
+func parseHistoryFilter(q url.Values) (historyFilter, error) {
+	f := historyFilter{minBMI: 0, maxBMI: math.Inf(1)}
+	for _, p := range []struct {
+		name string
+		dst  *float64
+	}{{"min_bmi", &f.minBMI}, {"max_bmi", &f.maxBMI}} {
+		raw := q.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return f, fmt.Errorf("%s must be a non-negative number", p.name)
+		}
+		*p.dst = v
+	}
+	f.category = q.Get("category")
+	if f.minBMI > f.maxBMI {
+		return f, fmt.Errorf("min_bmi must not be greater than max_bmi")
+	}
+	return f, nil
+}
+
+func (f historyFilter) match(c BMICalculation) bool {
+	if f.category != "" && !strings.EqualFold(c.Category, f.category) {
+		return false
+	}
+	return c.BMI >= f.minBMI && c.BMI <= f.maxBMI
+}
+
+func (f historyFilter) apply(calculations []BMICalculation) []BMICalculation {
+	out := calculations[:0]
+	for _, c := range calculations {
+		if f.match(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// historyPage is the slice of matching calculations a /history request returns.
+type historyPage struct {
+	limit, offset int
+}
+
+// parseHistoryPage reads ?limit= and ?offset=. The limit defaults to, and is
+// clamped at, maxLimit so a single request can't serialise the whole history.
+func parseHistoryPage(q url.Values, maxLimit int) (historyPage, error) {
+	p := historyPage{limit: maxLimit}
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &p.limit}, {"offset", &p.offset}} {
+		raw := q.Get(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("%s must be a non-negative integer", v.name)
+		}
+		*v.dst = n
+	}
+	p.limit = min(p.limit, maxLimit)
+	return p, nil
+}
+
+func (p historyPage) apply(calculations []BMICalculation) []BMICalculation {
+	if p.offset >= len(calculations) {
+		return calculations[:0]
+	}
+	calculations = calculations[p.offset:]
+	return calculations[:min(p.limit, len(calculations))]
+}
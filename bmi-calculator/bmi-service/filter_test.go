@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// historyBMIs returns the BMIs /history?query lists, rounded to one decimal.
+func historyBMIs(t *testing.T, query string) []float64 {
+	t.Helper()
+	rec := getHistory(t, query, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /history?%s = %d: %s", query, rec.Code, rec.Body)
+	}
+	var body struct {
+		Calculations []BMICalculation `json:"calculations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	bmis := make([]float64, len(body.Calculations))
+	for i, c := range body.Calculations {
+		bmis[i] = float64(int(c.BMI*10+0.5)) / 10
+	}
+	return bmis
+}
+
+func TestHistoryBMIRange(t *testing.T) {
+	freshStore(t)
+	// BMIs 16.3, 22.9, 29.4 and 35.9
+	for _, weight := range []string{"50", "70", "90", "110"} {
+		postCalculate(t, `{"weight": `+weight+`, "height": 1.75}`)
+	}
+
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{"", []float64{16.3, 22.9, 29.4, 35.9}},
+		{"min_bmi=20&max_bmi=30", []float64{22.9, 29.4}},
+		{"min_bmi=30", []float64{35.9}},
+		{"max_bmi=18.5", []float64{16.3}},
+		{"min_bmi=20&max_bmi=30&category=overweight", []float64{29.4}},
+		{"min_bmi=25&max_bmi=25", []float64{}},
+	}
+	for _, tt := range tests {
+		got := historyBMIs(t, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("?%s listed BMIs %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("?%s listed BMIs %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHistoryBMIRangeInvalid(t *testing.T) {
+	freshStore(t)
+	for _, query := range []string{"min_bmi=30&max_bmi=20", "min_bmi=-1", "max_bmi=lots", "max_bmi=Inf"} {
+		if rec := getHistory(t, query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /history?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestHistoryLimitClamp(t *testing.T) {
+	freshStore(t)
+	defer func(old int) { historyMax = old }(historyMax)
+	historyMax = 3
+	for i := 0; i < 5; i++ {
+		postCalculate(t, `{"weight": 70, "height": 1.75}`)
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		count int
+	}{
+		{"limit=1000000", 3, 3},
+		{"", 3, 3},
+		{"limit=2", 2, 2},
+		{"limit=0", 0, 0},
+	}
+	for _, tt := range tests {
+		rec := getHistory(t, tt.query, "")
+		var body struct {
+			Count int `json:"count"`
+			Total int `json:"total"`
+			Limit int `json:"limit"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || body.Limit != tt.limit || body.Count != tt.count || body.Total != 5 {
+			t.Errorf("?%s = %d with limit %d, count %d, total %d; want limit %d, count %d of 5",
+				tt.query, rec.Code, body.Limit, body.Count, body.Total, tt.limit, tt.count)
+		}
+	}
+
+	for _, query := range []string{"limit=-1", "offset=-1", "limit=many"} {
+		if rec := getHistory(t, query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bmi-calculator/respond"
+	"bmi-calculator/schemas"
+)
+
+// importMaxRows caps the data rows of one /history/import upload.
+var importMaxRows = max(getEnvInt("IMPORT_MAX_ROWS", 1000), 1)
+
+// historyColumns are the CSV columns of a calculation, named like its JSON fields.
+// An import needs weight and height; the others are optional and id is ignored,
+// since the store assigns IDs.
+var historyColumns = []string{"id", "weight", "height", "unit", "bmi", "category", "standard", "timestamp", "user_id"}
+
+// bmiTolerance is how far an imported bmi may be from the one its weight and
+// height give, to allow for rounding in the file.
+const bmiTolerance = 0.05
+
+type importError struct {
+	Line       int                 `json:"line"`
+	Error      string              `json:"error"`
+	Violations []schemas.Violation `json:"violations,omitempty"`
+}
+
+// importHistoryHandler adds the rows of a CSV upload, sent as text/csv or as the
+// "file" field of a multipart form, to the history. The header row names the
+// columns in any order. Every row is validated like a calculate request and its
+// bmi, category and standard, when given, must agree with its weight and height;
+// failing rows are skipped and reported by line, and the response is 207 when
+// any were. Nothing is stored when the upload is malformed or over the row cap.
+func importHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	src, err := importSource(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	defer src.Close()
+
+	reader := csv.NewReader(src)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "missing CSV header row: "+err.Error())
+		return
+	}
+	columns, err := parseImportHeader(header)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	calculations := []BMICalculation{}
+	failures := []importError{}
+	for rows := 0; ; rows++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if rows == importMaxRows {
+			respond.Error(w, r, http.StatusBadRequest, "import_too_large", "import exceeds "+strconv.Itoa(importMaxRows)+" rows")
+			return
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+			failures = append(failures, importError{Line: parseErr.StartLine, Error: fmt.Sprintf("row has %d fields, the header has %d", len(record), len(header))})
+			continue
+		}
+		if err != nil {
+			respond.Error(w, r, http.StatusBadRequest, "invalid_request", "malformed CSV: "+err.Error())
+			return
+		}
+		line, _ := reader.FieldPos(0)
+
+		calculation, violations, err := parseImportRow(columns, record)
+		if err != nil {
+			failures = append(failures, importError{Line: line, Error: err.Error(), Violations: violations})
+			continue
+		}
+		calculations = append(calculations, calculation)
+	}
+
+	for i := range calculations {
+		if err := store.Add(r.Context(), &calculations[i]); err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		audit.Record(r, calculations[i])
+	}
+
+	status := http.StatusOK
+	if len(failures) > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	respond.JSON(w, r, status, map[string]interface{}{
+		"errors": failures,
+		"summary": map[string]int{
+			"imported": len(calculations),
+			"skipped":  len(failures),
+		},
+	})
+}
+
+// importSource is the CSV in r's body, or in the "file" field of a multipart form.
+func importSource(r *http.Request) (io.ReadCloser, error) {
+	if !isMultipart(r) {
+		return r.Body, nil
+	}
+	if err := r.ParseMultipartForm(maxBodyBytes); err != nil {
+		return nil, err
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New(`multipart upload needs the CSV in a "file" field`)
+	}
+	return file, nil
+}
+
+// parseImportHeader maps each known column to its index; weight and height are
+// required and unknown or repeated columns are refused, as likely typos.
+func parseImportHeader(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(historyColumns))
+	for _, name := range historyColumns {
+		known[name] = true
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column %q, expected %s", name, strings.Join(historyColumns, ","))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"weight", "height"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing required column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// parseImportRow validates one row. Weight, height, unit and user_id go through the
+// calculate request schema by way of the equivalent JSON body, like form posts.
+func parseImportRow(columns map[string]int, record []string) (BMICalculation, []schemas.Violation, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	fields := map[string]interface{}{}
+	for _, name := range []string{"weight", "height"} {
+		fields[name] = get(name)
+		if f, err := strconv.ParseFloat(get(name), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			fields[name] = f
+		}
+	}
+	for _, name := range []string{"unit", "user_id"} {
+		if value := get(name); value != "" {
+			fields[name] = value
+		}
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return BMICalculation{}, nil, err
+	}
+	req, violations := parseCalculateRequest(body)
+	if len(violations) > 0 {
+		return BMICalculation{}, violations, errors.New("row does not match schema")
+	}
+
+	calculation, err := newCalculation(req.Weight, req.Height, req.Unit)
+	if err != nil {
+		return BMICalculation{}, nil, err
+	}
+	calculation.UserID = req.UserID
+
+	if standard := get("standard"); standard != "" && standard != calculation.Standard {
+		if !isKnownStandard(standard) {
+			return BMICalculation{}, nil, fmt.Errorf("unknown standard %q, expected one of %s", standard, strings.Join(standardNames(), ", "))
+		}
+		calculation.Standard = standard
+		calculation.Category = getBMICategory(calculation.BMI, standard)
+	}
+	if raw := get("bmi"); raw != "" {
+		bmi, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsInf(bmi, 0) || math.IsNaN(bmi) {
+			return BMICalculation{}, nil, fmt.Errorf("bmi %q is not a number", raw)
+		}
+		if math.Abs(bmi-calculation.BMI) > bmiTolerance {
+			return BMICalculation{}, nil, fmt.Errorf("bmi %s does not match weight and height, which give %.2f", raw, calculation.BMI)
+		}
+	}
+	if category := get("category"); category != "" && category != calculation.Category {
+		return BMICalculation{}, nil, fmt.Errorf("category %q does not match bmi %.1f, which is %q under %s", category, calculation.BMI, calculation.Category, calculation.Standard)
+	}
+	if raw := get("timestamp"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return BMICalculation{}, nil, fmt.Errorf("timestamp %q is not RFC 3339", raw)
+		}
+		calculation.Timestamp = t.Format(time.RFC3339)
+	}
+	return calculation, nil, nil
+}
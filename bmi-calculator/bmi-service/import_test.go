@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const importCSV = `weight,height,bmi,category,timestamp
+70,1.75,22.86,Normal weight,2026-01-02T03:04:05Z
+abc,1.75,,,
+90,1.80,,Underweight,
+60,1.65,,,
+`
+
+type importResponse struct {
+	Errors  []importError  `json:"errors"`
+	Summary map[string]int `json:"summary"`
+}
+
+func postImport(t *testing.T, contentType string, body *bytes.Buffer) (*httptest.ResponseRecorder, importResponse) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/history/import", body)
+	r.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	importHistoryHandler(rec, r)
+	var resp importResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestImportHistory(t *testing.T) {
+	multipartBody := func() (string, *bytes.Buffer) {
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		part, err := form.CreateFormFile("file", "history.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(importCSV))
+		form.Close()
+		return form.FormDataContentType(), &buf
+	}
+
+	for _, tt := range []struct {
+		name string
+		body func() (string, *bytes.Buffer)
+	}{
+		{"text/csv", func() (string, *bytes.Buffer) { return mediaTypeCSV, bytes.NewBufferString(importCSV) }},
+		{"multipart", multipartBody},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			freshStore(t)
+			contentType, body := tt.body()
+			rec, resp := postImport(t, contentType, body)
+			if rec.Code != http.StatusMultiStatus {
+				t.Fatalf("status = %d, want 207 with skipped rows: %s", rec.Code, rec.Body)
+			}
+			if resp.Summary["imported"] != 2 || resp.Summary["skipped"] != 2 {
+				t.Errorf("summary = %v, want 2 imported and 2 skipped", resp.Summary)
+			}
+			if len(resp.Errors) != 2 || resp.Errors[0].Line != 3 || len(resp.Errors[0].Violations) == 0 ||
+				resp.Errors[1].Line != 4 || !strings.Contains(resp.Errors[1].Error, "category") {
+				t.Errorf("errors = %+v, want the bad weight on line 3 and the wrong category on line 4", resp.Errors)
+			}
+
+			stored, err := store.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != 2 || stored[0].Weight != 70 || stored[0].Timestamp != "2026-01-02T03:04:05Z" || stored[1].Weight != 60 {
+				t.Errorf("stored %+v, want the rows from lines 2 and 5 with their timestamp kept", stored)
+			}
+		})
+	}
+}
+
+func TestImportHistoryRefusals(t *testing.T) {
+	defer func(old int) { importMaxRows = old }(importMaxRows)
+	importMaxRows = 3
+
+	for _, tt := range []struct {
+		name, csv, code string
+	}{
+		{"over the row cap", importCSV, "import_too_large"},
+		{"unknown column", "weight,height,colour\n70,1.75,red\n", "invalid_request"},
+		{"missing height", "weight\n70\n", "invalid_request"},
+		{"empty upload", "", "invalid_request"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			freshStore(t)
+			rec, _ := postImport(t, mediaTypeCSV, bytes.NewBufferString(tt.csv))
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if rec.Code != http.StatusBadRequest || body.Code != tt.code {
+				t.Errorf("status = %d, code %q; want 400 %s", rec.Code, body.Code, tt.code)
+			}
+			if stored, _ := store.List(context.Background()); len(stored) != 0 {
+				t.Errorf("stored %d rows from a refused upload, want none", len(stored))
+			}
+		})
+	}
+}
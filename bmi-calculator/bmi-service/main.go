@@ -1,22 +1,52 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"bmi-calculator/clientip"
+	"bmi-calculator/deadline"
+	"bmi-calculator/identity"
+	"bmi-calculator/listen"
+	"bmi-calculator/logging"
+	"bmi-calculator/profiling"
+	"bmi-calculator/respond"
+	"bmi-calculator/schemas"
+
+	"chaos"
+	"config"
+	"middleware"
+
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type BMICalculation struct {
+	// ID is assigned by the store and never reused, so it stays valid across pages and deletes
+	ID        uint64  `json:"id"`
 	Weight    float64 `json:"weight"`
 	Height    float64 `json:"height"`
+	Unit      string  `json:"unit"`
 	BMI       float64 `json:"bmi"`
 	Category  string  `json:"category"`
+	Standard  string  `json:"standard"`
 	Timestamp string  `json:"timestamp"`
+	UserID    string  `json:"user_id,omitempty"`
+	// Degraded marks a calculation answered without being stored, see storeCalculation
+	Degraded bool `json:"degraded,omitempty"`
 }
 
 type HealthResponse struct {
@@ -26,29 +56,171 @@ type HealthResponse struct {
 	Version   string `json:"version"`
 }
 
-var calculations []BMICalculation
+type calculateRequest struct {
+	Weight float64 `json:"weight"`
+	Height float64 `json:"height"`
+	Unit   string  `json:"unit"`
+	UserID string  `json:"user_id"`
+}
+
+var (
+	store          = newHistoryStore()
+	etagNonce      = time.Now().UnixNano()
+	bmiStandard    = getEnv("BMI_STANDARD", standardWHO)
+	requestTimeout = getEnvDuration("REQUEST_TIMEOUT", 10*time.Second)
+	quickCalcMax   = getEnvFloat("QUICK_CALC_MAX", 1000)
+	historyMax     = max(getEnvInt("HISTORY_MAX_LIMIT", 500), 1)
+	clientIPs      = clientip.Resolver{TrustProxyHeaders: getEnv("TRUST_PROXY_HEADERS", "false") == "true"}
+
+	// audit is nil unless AUDIT_LOG or AUDIT_FILE is set
+	audit *auditLogger
+
+	inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	})
+)
+
+const (
+	unitMetric   = "metric"   // kilograms and metres
+	unitImperial = "imperial" // pounds and inches
+
+	maxBodyBytes = 1 << 20
+	maxBatchSize = 1000
+
+	// statusClientClosedRequest is nginx's non-standard code for a client that went away mid-request.
+	statusClientClosedRequest = 499
+)
 
 func main() {
+	if err := logging.Setup(getEnv("LOG_FILE", ""), getEnvInt("LOG_MAX_SIZE_MB", 100), getEnvInt("LOG_MAX_BACKUPS", 3), getEnv("LOG_CONSOLE", "true") == "true"); err != nil {
+		log.Fatalf("Invalid LOG_FILE: %v", err)
+	}
+	profiling.Start(getEnv("ENABLE_PPROF", "false") == "true", getEnv("ADMIN_PORT", "6060"))
+	respond.Pretty = getEnv("PRETTY_JSON", "false") == "true"
+	switch jsonCase := getEnv("JSON_CASE", "snake"); jsonCase {
+	case "snake":
+	case "camel":
+		respond.CamelCase = true
+	default:
+		log.Fatalf("Invalid JSON_CASE %q, expected snake or camel", jsonCase)
+	}
+
+	if start := getEnv("FAKE_CLOCK", ""); start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			log.Fatalf("Invalid FAKE_CLOCK: %v", err)
+		}
+		clock = newFakeClock(t, getEnvDuration("FAKE_CLOCK_STEP", time.Second))
+		log.Printf("Using a fake clock starting at %s", t.Format(time.RFC3339))
+	}
+
+	if auditFile := getEnv("AUDIT_FILE", ""); auditFile != "" || getEnv("AUDIT_LOG", "false") == "true" {
+		var err error
+		if audit, err = newAuditLogger(auditFile, getEnvInt("LOG_MAX_SIZE_MB", 100), getEnvInt("LOG_MAX_BACKUPS", 3)); err != nil {
+			log.Fatalf("Invalid AUDIT_FILE: %v", err)
+		}
+	}
+
+	if rate := getEnvFloat("STORAGE_FAILURE_RATE", 0); rate > 0 {
+		store.failureRate = rate
+		log.Printf("Failing %.0f%% of history writes, degraded responses: %t", min(rate, 1)*100, degradeOnStorageError)
+	}
+
+	// Storage that can't be opened at all has already stopped startup; this catches
+	// what opens but can't take every write, such as an audit directory that
+	// rotation can't create backups in
+	if err := checkStorage(context.Background()); err != nil {
+		log.Printf("Warning: /ready will fail until storage is writable: %v", err)
+	}
+
+	bmiBehavior, err := chaos.Parse(getEnv("BMI_BEHAVIOR", string(chaos.Normal)))
+	if err != nil {
+		log.Fatalf("Invalid BMI_BEHAVIOR: %v", err)
+	}
+	rng, err := chaos.SeededRand(getEnv("RAND_SEED", ""))
+	if err != nil {
+		log.Fatalf("Invalid RAND_SEED: %v", err)
+	}
+	store.rng = rng
+	simulate := middleware.Chaos(bmiBehavior, rng, respond.Error)
+
 	r := mux.NewRouter()
 
-	r.Use(loggingMiddleware)
+	r.Use(stats.Middleware)
+	r.Use(timeoutMiddleware)
 
 	r.HandleFunc("/health", healthHandler).Methods("GET")
-	r.HandleFunc("/calculate", calculateHandler).Methods("POST")
+	r.HandleFunc("/ready", readyHandler).Methods("GET")
+	r.Handle("/calculate", requireContentType(simulate(http.HandlerFunc(calculateHandler)), mediaTypeJSON, mediaTypeForm)).Methods("POST")
+	r.Handle("/calculate/batch", requireContentType(http.HandlerFunc(batchCalculateHandler), mediaTypeJSON)).Methods("POST")
 	r.HandleFunc("/history", historyHandler).Methods("GET")
+	r.HandleFunc("/history/stream", historyStreamHandler).Methods("GET")
+	r.HandleFunc("/history/series", seriesHandler).Methods("GET")
+	r.HandleFunc("/history/reclassify", reclassifyHandler).Methods("POST")
+	r.Handle("/history/import", requireContentType(http.HandlerFunc(importHistoryHandler), mediaTypeCSV, mediaTypeMultipart)).Methods("POST")
+	r.HandleFunc("/history/{user_id}/trend", trendHandler).Methods("GET")
+	r.HandleFunc("/history/{id:[0-9]+}", deleteHistoryHandler).Methods("DELETE")
+	r.HandleFunc("/bmi/percentile", percentileHandler).Methods("GET")
 	r.HandleFunc("/bmi/{weight}/{height}", quickCalculateHandler).Methods("GET")
+	r.HandleFunc("/target-weight", targetWeightHandler).Methods("GET")
+	r.HandleFunc("/recommendations", recommendationsHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/stats", statsHandler).Methods("GET")
+	r.Handle("/config", config.Handler(respond.JSON)).Methods("GET")
+	r.Handle("/whoami", identity.Handler("bmi-service")).Methods("GET")
+	r.Handle("/version", identity.VersionHandler("bmi-service", getEnv("IMAGE_VERSION", "unknown"))).Methods("GET")
+
+	if !isKnownStandard(bmiStandard) {
+		log.Fatalf("Unknown BMI_STANDARD %q, expected one of %s", bmiStandard, strings.Join(standardNames(), ", "))
+	}
 
 	port := getEnv("PORT", "8081")
-	log.Printf("BMI Service starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	addr, err := listen.Addr(getEnv("BIND_ADDR", "0.0.0.0"), port)
+	if err != nil {
+		log.Fatalf("Invalid listen address: %v", err)
+	}
+	log.Printf("BMI standard: %s", bmiStandard)
+	log.Printf("Simulated behavior: %s", bmiBehavior)
+	log.Printf("Request timeout: %s", requestTimeout)
+	log.Printf("BMI Service starting on %s", addr)
+	rateLimit := getEnvFloat("RATE_LIMIT_RPS", 0)
+	limiter := middleware.NewRateLimiter(rateLimit, getEnvInt("RATE_LIMIT_BURST", 0), clientIPs.FromRequest)
+	if limiter != nil {
+		log.Printf("Rate limiting each client to %g requests/s", rateLimit)
+	}
+	shedder := middleware.NewLoadShedder(getEnvInt("MAX_CONCURRENT", 256), inFlightGauge)
+	log.Fatal(http.ListenAndServe(addr, middleware.Chain(middleware.Standard(middleware.Stack{
+		ClientIP: clientIPs.FromRequest,
+		Error:    respond.Error,
+		Metrics:  middleware.NewMetrics(prometheus.DefaultRegisterer),
+		Limiter:  limiter,
+		Shedder:  shedder,
+	})...)(r)))
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
+// timeoutMiddleware bounds every request by REQUEST_TIMEOUT, or by a shorter
+// X-Timeout-Ms budget from the caller; the derived context is also cancelled when
+// the client disconnects. The history stream is long-lived by design and only ends
+// when the client goes away.
+func timeoutMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-		log.Printf("Completed: %s %s in %v", r.Method, r.URL.Path, time.Since(start))
+		if r.URL.Path == "/history/stream" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout := requestTimeout
+		budget, ok, err := deadline.FromRequest(r, requestTimeout)
+		if err != nil {
+			respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if ok {
+			timeout = budget
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -61,104 +233,370 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		"image_version": getEnv("IMAGE_VERSION", "unknown"),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respond.JSON(w, r, http.StatusOK, response)
 }
 
+// calculateHandler takes a JSON body or, for plain HTML forms, the same fields
+// form-encoded.
 func calculateHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Weight float64 `json:"weight"`
-		Height float64 `json:"height"`
+	var body []byte
+	var err error
+	if isForm(r) {
+		body, err = formToJSON(w, r)
+	} else {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBodyBytes))
+	}
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	req, violations := parseCalculateRequest(body)
+	if len(violations) > 0 {
+		respond.JSON(w, r, http.StatusBadRequest, struct {
+			respond.ErrorBody
+			Violations []schemas.Violation `json:"violations"`
+		}{
+			ErrorBody:  respond.ErrorBody{Status: http.StatusBadRequest, Code: "schema_violation", Message: "request body does not match schema"},
+			Violations: violations,
+		})
 		return
 	}
 
-	if req.Weight <= 0 || req.Height <= 0 {
-		http.Error(w, "weight and height must be positive numbers", http.StatusBadRequest)
+	calculation, err := newCalculation(req.Weight, req.Height, req.Unit)
+	if err != nil {
+		respond.Error(w, r, http.StatusUnprocessableEntity, "unprocessable", err.Error())
 		return
 	}
+	calculation.UserID = req.UserID
 
-	bmi := req.Weight / (req.Height * req.Height)
-	category := getBMICategory(bmi)
+	if !storeCalculation(w, r, &calculation) {
+		return
+	}
 
-	calculation := BMICalculation{
-		Weight:    req.Weight,
-		Height:    req.Height,
-		BMI:       bmi,
-		Category:  category,
-		Timestamp: time.Now().Format(time.RFC3339),
+	respond.JSON(w, r, http.StatusOK, calculation)
+}
+
+type batchResult struct {
+	Index       int            `json:"index"`
+	Calculation BMICalculation `json:"calculation"`
+}
+
+type batchError struct {
+	Index      int                 `json:"index"`
+	Error      string              `json:"error"`
+	Violations []schemas.Violation `json:"violations,omitempty"`
+}
+
+// batchCalculateHandler accepts a JSON array of calculate requests. Every entry is
+// validated so clients see all of their mistakes at once; valid entries are stored
+// in order and the response is 207 when some entries failed. Storing stops as soon
+// as the request context is cancelled or times out.
+func batchCalculateHandler(w http.ResponseWriter, r *http.Request) {
+	var entries []json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&entries); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "body must be a JSON array of calculate requests")
+		return
+	}
+
+	if len(entries) > maxBatchSize {
+		respond.Error(w, r, http.StatusBadRequest, "batch_too_large", "batch exceeds "+strconv.Itoa(maxBatchSize)+" entries")
+		return
+	}
+
+	results := []batchResult{}
+	failures := []batchError{}
+	for i, entry := range entries {
+		if err := r.Context().Err(); err != nil {
+			writeContextError(w, r, err)
+			return
+		}
+
+		req, violations := parseCalculateRequest(entry)
+		if len(violations) > 0 {
+			failures = append(failures, batchError{
+				Index:      i,
+				Error:      "entry does not match schema",
+				Violations: violations,
+			})
+			continue
+		}
+
+		calculation, err := newCalculation(req.Weight, req.Height, req.Unit)
+		if err != nil {
+			failures = append(failures, batchError{Index: i, Error: err.Error()})
+			continue
+		}
+		calculation.UserID = req.UserID
+		if err := store.Add(r.Context(), &calculation); err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		audit.Record(r, calculation)
+		results = append(results, batchResult{Index: i, Calculation: calculation})
+	}
+
+	status := http.StatusOK
+	if len(failures) > 0 {
+		status = http.StatusMultiStatus
 	}
 
-	calculations = append(calculations, calculation)
+	respond.JSON(w, r, status, map[string]interface{}{
+		"results": results,
+		"errors":  failures,
+		"summary": map[string]int{
+			"succeeded": len(results),
+			"failed":    len(failures),
+		},
+	})
+}
+
+// markCacheable lets shared caches, such as the gateway's micro-cache, keep a
+// response that depends on nothing but its query string.
+func markCacheable(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "public, max-age=60")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(calculation)
+// writeContextError maps a cancelled or expired request context to a status code.
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		respond.Error(w, r, http.StatusGatewayTimeout, "timeout", "request timed out")
+		return
+	}
+	log.Printf("Aborted: %s %s, client closed request", r.Method, r.URL.Path)
+	respond.Error(w, r, statusClientClosedRequest, "client_closed_request", "client closed request")
 }
 
 func quickCalculateHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	weight, err := strconv.ParseFloat(vars["weight"], 64)
+	weight, err := parseQuickValue("weight", vars["weight"])
 	if err != nil {
-		http.Error(w, "invalid weight parameter", http.StatusBadRequest)
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
 
-	height, err := strconv.ParseFloat(vars["height"], 64)
+	height, err := parseQuickValue("height", vars["height"])
 	if err != nil {
-		http.Error(w, "invalid height parameter", http.StatusBadRequest)
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
 		return
 	}
 
-	if weight <= 0 || height <= 0 {
-		http.Error(w, "weight and height must be positive numbers", http.StatusBadRequest)
+	calculation, err := newCalculation(weight, height, unitMetric)
+	if err != nil {
+		respond.Error(w, r, http.StatusUnprocessableEntity, "unprocessable", err.Error())
 		return
 	}
 
-	bmi := weight / (height * height)
-	category := getBMICategory(bmi)
-
-	calculation := BMICalculation{
-		Weight:    weight,
-		Height:    height,
-		BMI:       bmi,
-		Category:  category,
-		Timestamp: time.Now().Format(time.RFC3339),
+	if !storeCalculation(w, r, &calculation) {
+		return
 	}
 
-	calculations = append(calculations, calculation)
+	respond.JSON(w, r, http.StatusOK, calculation)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(calculation)
+// parseQuickValue parses a path parameter of /bmi/{weight}/{height}. ParseFloat
+// accepts NaN, Inf and huge exponents, none of which make a meaningful BMI and
+// non-finite ones cannot even be encoded as JSON.
+func parseQuickValue(name, raw string) (float64, error) {
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("%s must be a finite number", name)
+	}
+	if v <= 0 || v > quickCalcMax {
+		return 0, fmt.Errorf("%s must be greater than 0 and at most %g", name, quickCalcMax)
+	}
+	return v, nil
 }
 
+// historyHandler lists stored calculations, optionally limited to a BMI range with
+// ?min_bmi= and ?max_bmi= or to a ?category=, and paged with ?limit= and ?offset=. The ETag covers the
+// whole history, so any change invalidates every filtered view too.
 func historyHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	page, err := parseHistoryPage(r.URL.Query(), historyMax)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	calculations, revision, err := store.Snapshot(r.Context())
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+
+	etag := historyETag(calculations, revision)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	calculations = filter.apply(calculations)
+	total := len(calculations)
+	calculations = page.apply(calculations)
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
 		"calculations": calculations,
 		"count":        len(calculations),
+		"total":        total,
+		"limit":        page.limit,
+		"offset":       page.offset,
 	})
 }
 
-func getBMICategory(bmi float64) string {
-	switch {
-	case bmi < 18.5:
-		return "Underweight"
-	case bmi < 25:
-		return "Normal weight"
-	case bmi < 30:
-		return "Overweight"
-	default:
-		return "Obese"
+// historyETag derives a weak validator from the history's size, newest entry and
+// store revision. The per-process nonce keeps tags from a previous pod, whose
+// revisions started from zero too, from matching.
+func historyETag(calculations []BMICalculation, revision uint64) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%d|%d", etagNonce, revision, len(calculations))
+	if n := len(calculations); n > 0 {
+		h.Write([]byte(calculations[n-1].Timestamp))
+	}
+	return fmt.Sprintf(`W/"%d-%x"`, len(calculations), h.Sum64())
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using weak comparison.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// formToJSON turns a form-encoded calculate request into the equivalent JSON body,
+// so it goes through the same schema validation. weight and height become numbers
+// when they parse as one and stay strings otherwise, for the schema to reject.
+func formToJSON(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(r.PostForm))
+	for name, values := range r.PostForm {
+		value := values[0]
+		fields[name] = value
+		if name == "weight" || name == "height" {
+			if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				fields[name] = f
+			}
+		}
 	}
+	return json.Marshal(fields)
+}
+
+// parseCalculateRequest validates a raw calculate body against its schema and decodes it.
+func parseCalculateRequest(body []byte) (calculateRequest, []schemas.Violation) {
+	var req calculateRequest
+	if violations := schemas.CalculateRequest.Validate(body); len(violations) > 0 {
+		return req, violations
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, []schemas.Violation{{Message: err.Error()}}
+	}
+	if req.Unit == "" {
+		req.Unit = unitMetric
+	}
+	return req, nil
+}
+
+// errNonFiniteBMI is returned for inputs whose BMI overflows, e.g. a height so small
+// that its square underflows to zero. encoding/json cannot represent the result.
+var errNonFiniteBMI = errors.New("weight and height produce a BMI that is not a finite number")
+
+func newCalculation(weight, height float64, unit string) (BMICalculation, error) {
+	weightKg, heightM := toMetric(weight, height, unit)
+	bmi := weightKg / (heightM * heightM)
+	if math.IsInf(bmi, 0) || math.IsNaN(bmi) {
+		return BMICalculation{}, errNonFiniteBMI
+	}
+	simulateWork(bmi)
+
+	return BMICalculation{
+		Weight:    weight,
+		Height:    height,
+		Unit:      unit,
+		BMI:       bmi,
+		Category:  getBMICategory(bmi, bmiStandard),
+		Standard:  bmiStandard,
+		Timestamp: clock.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// toMetric converts weight and height in the given unit system to kilograms and metres.
+func toMetric(weight, height float64, unit string) (float64, float64) {
+	if unit == unitImperial {
+		return weight * 0.45359237, height * 0.0254
+	}
+	return weight, height
+}
+
+// fromMetricWeight converts kilograms back to unit's weight unit.
+func fromMetricWeight(kg float64, unit string) float64 {
+	if unit == unitImperial {
+		return kg / 0.45359237
+	}
+	return kg
 }
 
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
+		config.Record(key, value)
 		return value
 	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err == nil && d > 0 {
+			config.Record(key, d)
+			return d
+		}
+		log.Printf("Invalid %s %q, using default %s", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil && f > 0 && !math.IsInf(f, 0) {
+			config.Record(key, f)
+			return f
+		}
+		log.Printf("Invalid %s %q, using default %v", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			config.Record(key, n)
+			return n
+		}
+		log.Printf("Invalid %s %q, using default %d", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
 	return defaultValue
 }
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"bmi-calculator/respond"
+
+	"chaos"
+	"middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// freshStore gives the test an empty history store and no audit log, restoring
+// the previous ones afterwards.
+func freshStore(t *testing.T) {
+	t.Helper()
+	oldStore, oldAudit := store, audit
+	t.Cleanup(func() { store, audit = oldStore, oldAudit })
+	store, audit = newHistoryStore(), nil
+}
+
+// postCalculate sends body to calculateHandler as JSON.
+func postCalculate(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	calculateHandler(rec, r)
+	return rec
+}
+
+func TestCalculateSchemaViolations(t *testing.T) {
+	freshStore(t)
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{"valid", `{"weight": 70, "height": 1.75}`, http.StatusOK, nil},
+		{"missing fields", `{"unit": "metric"}`, http.StatusBadRequest, []string{"weight", "height"}},
+		{"wrong types", `{"weight": "heavy", "height": 1.75}`, http.StatusBadRequest, []string{"weight"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postCalculate(t, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			var body struct {
+				Code       string `json:"code"`
+				Violations []struct {
+					Field string `json:"field"`
+				} `json:"violations"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "schema_violation" || len(body.Violations) != len(tt.fields) {
+				t.Fatalf("body = %s, want a schema_violation for %v", rec.Body, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if body.Violations[i].Field != field {
+					t.Errorf("violation %d is for %q, want %q", i, body.Violations[i].Field, field)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchReportsEveryInvalidEntry(t *testing.T) {
+	freshStore(t)
+	body := `[
+		{"weight": 70, "height": 1.75},
+		{"weight": "heavy", "height": 1.75},
+		{"weight": 80, "height": 1.8},
+		{"weight": 70, "height": 0},
+		{"weight": 60, "height": 1.6}
+	]`
+	r := httptest.NewRequest(http.MethodPost, "/calculate/batch", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	batchCalculateHandler(rec, r)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+	}
+	var got struct {
+		Results []struct {
+			Index int `json:"index"`
+		} `json:"results"`
+		Errors []struct {
+			Index int    `json:"index"`
+			Error string `json:"error"`
+		} `json:"errors"`
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Errors) != 2 || got.Errors[0].Index != 1 || got.Errors[1].Index != 3 {
+		t.Fatalf("errors = %+v, want entries 1 and 3", got.Errors)
+	}
+	for _, failure := range got.Errors {
+		if failure.Error == "" {
+			t.Errorf("entry %d is reported without an error message", failure.Index)
+		}
+	}
+	if len(got.Results) != 3 || got.Results[0].Index != 0 || got.Results[1].Index != 2 || got.Results[2].Index != 4 {
+		t.Errorf("results = %+v, want entries 0, 2 and 4", got.Results)
+	}
+	if got.Summary["succeeded"] != 3 || got.Summary["failed"] != 2 {
+		t.Errorf("summary = %v, want 3 succeeded and 2 failed", got.Summary)
+	}
+}
+
+// batchBody is a batch of n valid calculate requests.
+func batchBody(n int) string {
+	return "[" + strings.TrimSuffix(strings.Repeat(`{"weight": 70, "height": 1.75},`, n), ",") + "]"
+}
+
+func TestBatchStopsWhenCancelled(t *testing.T) {
+	freshStore(t)
+	// Hang up as the tenth entry is stored
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	added := 0
+	store.onAdd = func(BMICalculation) {
+		if added++; added == 10 {
+			cancel()
+		}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/calculate/batch", strings.NewReader(batchBody(maxBatchSize))).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	batchCalculateHandler(rec, r)
+
+	if rec.Code != statusClientClosedRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, statusClientClosedRequest)
+	}
+	if calculations, _ := store.List(context.Background()); len(calculations) != 10 {
+		t.Errorf("%d of %d entries stored, want the 10 before the client hung up", len(calculations), maxBatchSize)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	defer func(old time.Duration) { requestTimeout = old }(requestTimeout)
+	requestTimeout = 20 * time.Millisecond
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			writeContextError(w, r, r.Context().Err())
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"REQUEST_TIMEOUT", "", http.StatusGatewayTimeout},
+		{"shorter budget from the caller", "5", http.StatusGatewayTimeout},
+		{"invalid budget", "soon", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/history", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Timeout-Ms", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		timeoutMiddleware(slow).ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("%s: took %v, want the deadline to cut it short", tt.name, elapsed)
+		}
+	}
+}
+
+// getHistory sends GET /history?query to historyHandler, with If-None-Match when
+// etag is set.
+func getHistory(t *testing.T, query, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/history?"+query, nil)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	historyHandler(rec, r)
+	return rec
+}
+
+func TestHistoryETag(t *testing.T) {
+	freshStore(t)
+	postCalculate(t, `{"weight": 70, "height": 1.75}`)
+
+	first := getHistory(t, "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET /history = %d with ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+	if rec := getHistory(t, "", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("GET /history with a matching If-None-Match = %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+
+	postCalculate(t, `{"weight": 80, "height": 1.80}`)
+	added := getHistory(t, "", etag)
+	if added.Code != http.StatusOK || added.Header().Get("ETag") == etag {
+		t.Fatalf("GET /history after a new calculation = %d with ETag %q, want 200 with a new ETag", added.Code, added.Header().Get("ETag"))
+	}
+
+	calculations, _ := store.List(context.Background())
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/history/1", nil), map[string]string{"id": strconv.FormatUint(calculations[0].ID, 10)})
+	deleteHistoryHandler(httptest.NewRecorder(), r)
+	if rec := getHistory(t, "", added.Header().Get("ETag")); rec.Code != http.StatusOK {
+		t.Errorf("GET /history after a delete = %d, want 200 with a new ETag", rec.Code)
+	}
+}
+
+func TestCalculateBehaviors(t *testing.T) {
+	tests := []struct {
+		behavior chaos.Behavior
+		requests int
+		minDelay time.Duration // per request
+		failures bool
+	}{
+		{chaos.Normal, 20, 0, false},
+		{chaos.Slow, 2, 200 * time.Millisecond, false},
+		{chaos.ErrorProne, 20, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.behavior), func(t *testing.T) {
+			freshStore(t)
+			h := middleware.Chaos(tt.behavior, chaos.NewRand(1), respond.Error)(http.HandlerFunc(calculateHandler))
+
+			failed := 0
+			start := time.Now()
+			for i := 0; i < tt.requests; i++ {
+				r := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(`{"weight": 70, "height": 1.75}`))
+				r.Header.Set("Content-Type", "application/json")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+				switch rec.Code {
+				case http.StatusOK:
+				case http.StatusInternalServerError:
+					failed++
+				default:
+					t.Fatalf("status = %d, want 200 or a simulated 500", rec.Code)
+				}
+			}
+
+			if elapsed := time.Since(start); elapsed < time.Duration(tt.requests)*tt.minDelay {
+				t.Errorf("%d requests took %v, want at least %v each", tt.requests, elapsed, tt.minDelay)
+			}
+			if tt.failures != (failed > 0) {
+				t.Errorf("%d of %d requests failed, want failures: %v", failed, tt.requests, tt.failures)
+			}
+			// A simulated failure happens before the handler, so nothing is stored for it
+			if calculations, _ := store.List(context.Background()); len(calculations) != tt.requests-failed {
+				t.Errorf("%d calculations stored, want %d", len(calculations), tt.requests-failed)
+			}
+		})
+	}
+}
+
+// getQuick sends GET /bmi/{weight}/{height} to quickCalculateHandler.
+func getQuick(weight, height string) *httptest.ResponseRecorder {
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/bmi/"+weight+"/"+height, nil), map[string]string{"weight": weight, "height": height})
+	rec := httptest.NewRecorder()
+	quickCalculateHandler(rec, r)
+	return rec
+}
+
+func TestQuickCalculateRejectsNonFinite(t *testing.T) {
+	freshStore(t)
+	tests := []struct {
+		weight, height string
+		want           int
+	}{
+		{"70", "1.75", http.StatusOK},
+		{"Inf", "1.75", http.StatusBadRequest},
+		{"70", "-Inf", http.StatusBadRequest},
+		{"NaN", "1.75", http.StatusBadRequest},
+		{"1e309", "1.75", http.StatusBadRequest}, // overflows float64
+		{"1e308", "1.75", http.StatusBadRequest}, // finite, but far beyond any body
+		{"heavy", "1.75", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := getQuick(tt.weight, tt.height)
+		if rec.Code != tt.want {
+			t.Errorf("/bmi/%s/%s = %d, want %d: %s", tt.weight, tt.height, rec.Code, tt.want, rec.Body)
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("/bmi/%s/%s answered invalid JSON %q", tt.weight, tt.height, rec.Body)
+		}
+	}
+}
+
+func TestCalculateTinyHeight(t *testing.T) {
+	freshStore(t)
+	// Squaring 1e-200 underflows to zero, so the BMI would be +Inf
+	rec := postCalculate(t, `{"weight": 70, "height": 1e-200}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+	}
+	if body.Code != "unprocessable" || body.Message != errNonFiniteBMI.Error() {
+		t.Errorf("body = %+v, want the unprocessable non-finite BMI error", body)
+	}
+	if calculations, _ := store.List(context.Background()); len(calculations) != 0 {
+		t.Errorf("%d calculations stored, want none", len(calculations))
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	freshStore(t)
+	jsonOnly := requireContentType(http.HandlerFunc(calculateHandler), mediaTypeJSON)
+	malformed := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader("{"))
+	malformed.Header.Set("Content-Type", "application/json")
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request *http.Request
+		status  int
+		code    string
+	}{
+		{
+			name:    "malformed body",
+			handler: calculateHandler,
+			request: malformed,
+			status:  http.StatusBadRequest,
+			code:    "schema_violation",
+		},
+		{
+			name:    "wrong content type",
+			handler: jsonOnly.ServeHTTP,
+			request: httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader("weight=70")),
+			status:  http.StatusUnsupportedMediaType,
+			code:    "unsupported_media_type",
+		},
+		{
+			name:    "unknown user",
+			handler: trendHandler,
+			request: mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/history/nobody/trend", nil), map[string]string{"user_id": "nobody"}),
+			status:  http.StatusNotFound,
+			code:    "not_found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, tt.request)
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error body is not JSON: %q", rec.Body)
+			}
+			if rec.Code != tt.status || body["status"] != float64(tt.status) || body["code"] != tt.code || body["error"] == "" {
+				t.Errorf("%d %v, want %d with status, code %q and error", rec.Code, body, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestCalculateForm(t *testing.T) {
+	freshStore(t)
+	defer func(old string) { bmiStandard = old }(bmiStandard)
+	bmiStandard = standardWHO
+
+	tests := []struct {
+		form     string
+		status   int
+		bmi      float64
+		category string
+	}{
+		{"weight=70&height=1.75", http.StatusOK, 22.86, "Normal weight"},
+		{"weight=154&height=69&unit=imperial", http.StatusOK, 22.74, "Normal weight"},
+		{"weight=heavy&height=1.75", http.StatusBadRequest, 0, ""},
+		{"height=1.75", http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(tt.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		calculateHandler(rec, r)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.form, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			if !strings.Contains(rec.Body.String(), "schema_violation") {
+				t.Errorf("%s: body = %s, want the schema violations the JSON body would get", tt.form, rec.Body)
+			}
+			continue
+		}
+		var got BMICalculation
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got.BMI-tt.bmi) > 0.01 || got.Category != tt.category {
+			t.Errorf("%s: BMI %v %q, want %v %q", tt.form, got.BMI, got.Category, tt.bmi, tt.category)
+		}
+	}
+}
+
+func TestTimeoutBudget(t *testing.T) {
+	freshStore(t)
+	h := timeoutMiddleware(middleware.Chaos(chaos.Slow, chaos.NewRand(1), respond.Error)(http.HandlerFunc(calculateHandler)))
+
+	tests := []struct {
+		budget string
+		status int
+	}{
+		{"20", http.StatusGatewayTimeout},
+		{"0", http.StatusBadRequest},
+		{"soon", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/calculate", strings.NewReader(`{"weight": 70, "height": 1.75}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Timeout-Ms", tt.budget)
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.status {
+			t.Errorf("X-Timeout-Ms: %s = %d, want %d", tt.budget, rec.Code, tt.status)
+		}
+		// The slow behavior sleeps far longer than the budget
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("X-Timeout-Ms: %s answered after %s, want it cut short", tt.budget, elapsed)
+		}
+	}
+	if calculations, _ := store.List(context.Background()); len(calculations) != 0 {
+		t.Errorf("%d calculations stored past their deadline, want none", len(calculations))
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+// growthChartCSV holds BMI-for-age cut-offs per sex at whole years from 2 to 20.
+//
+//go:embed growth_chart.csv
+var growthChartCSV string
+
+const (
+	minChartAge = 2
+	maxChartAge = 20
+)
+
+// chartRow is the BMI at the 5th, 50th, 85th and 95th percentile for one age.
+type chartRow struct {
+	age float64
+	bmi [4]float64
+}
+
+// chartPercentiles are the percentiles of chartRow.bmi, in order.
+var chartPercentiles = [4]float64{5, 50, 85, 95}
+
+var growthChart = mustParseGrowthChart(growthChartCSV)
+
+func mustParseGrowthChart(data string) map[string][]chartRow {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("growth chart: %v", err))
+	}
+	chart := make(map[string][]chartRow)
+	for _, rec := range records[1:] {
+		row := chartRow{}
+		values := make([]float64, 0, 5)
+		for _, field := range rec[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				panic(fmt.Sprintf("growth chart: %v", err))
+			}
+			values = append(values, v)
+		}
+		row.age = values[0]
+		copy(row.bmi[:], values[1:])
+		chart[rec[0]] = append(chart[rec[0]], row)
+	}
+	return chart
+}
+
+type percentileResult struct {
+	// Percentile is an estimate interpolated between the chart's percentiles; it is
+	// nil below the 5th or above the 95th, where Band says which side.
+	Percentile *float64 `json:"percentile"`
+	Band       string   `json:"percentile_band"`
+	Category   string   `json:"category"`
+}
+
+// bmiPercentile places bmi on the growth chart for a child of age years, which may
+// be fractional, and sex "male" or "female". Cut-offs are interpolated linearly
+// between whole years. Categories follow the CDC: under the 5th percentile is
+// underweight, from the 85th overweight and from the 95th obese.
+func bmiPercentile(chart map[string][]chartRow, bmi, age float64, sex string) (percentileResult, error) {
+	rows, ok := chart[sex]
+	if !ok {
+		return percentileResult{}, errors.New("sex must be male or female")
+	}
+	if age < minChartAge || age > maxChartAge {
+		return percentileResult{}, fmt.Errorf("age must be from %d to %d years", minChartAge, maxChartAge)
+	}
+
+	var cutoffs [4]float64
+	for i := 0; i < len(rows)-1; i++ {
+		lo, hi := rows[i], rows[i+1]
+		if age >= lo.age && age <= hi.age {
+			t := (age - lo.age) / (hi.age - lo.age)
+			for p := range cutoffs {
+				cutoffs[p] = lo.bmi[p] + t*(hi.bmi[p]-lo.bmi[p])
+			}
+			break
+		}
+	}
+
+	result := percentileResult{}
+	switch {
+	case bmi < cutoffs[0]:
+		result.Band, result.Category = "below_5", "Underweight"
+	case bmi >= cutoffs[3]:
+		result.Band, result.Category = "95_and_above", "Obese"
+	case bmi >= cutoffs[2]:
+		result.Band, result.Category = "85_to_95", "Overweight"
+	case bmi >= cutoffs[1]:
+		result.Band, result.Category = "50_to_85", "Healthy weight"
+	default:
+		result.Band, result.Category = "5_to_50", "Healthy weight"
+	}
+	if bmi >= cutoffs[0] && bmi <= cutoffs[3] {
+		for p := 0; p < len(cutoffs)-1; p++ {
+			if bmi <= cutoffs[p+1] {
+				t := (bmi - cutoffs[p]) / (cutoffs[p+1] - cutoffs[p])
+				pct := math.Round((chartPercentiles[p]+t*(chartPercentiles[p+1]-chartPercentiles[p]))*10) / 10
+				result.Percentile = &pct
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// percentileHandler serves GET /bmi/percentile?bmi=&age=&sex= for children and
+// teens. The chart is approximate and meant for teaching.
+func percentileHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	bmi, err := parseQuickValue("bmi", q.Get("bmi"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	age, err := strconv.ParseFloat(q.Get("age"), 64)
+	if err != nil || math.IsNaN(age) {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", fmt.Sprintf("age must be a number of years from %d to %d", minChartAge, maxChartAge))
+		return
+	}
+	sex := strings.ToLower(q.Get("sex"))
+
+	result, err := bmiPercentile(growthChart, bmi, age, sex)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	markCacheable(w)
+	respond.JSON(w, r, http.StatusOK, struct {
+		BMI float64 `json:"bmi"`
+		Age float64 `json:"age"`
+		Sex string  `json:"sex"`
+		percentileResult
+	}{bmi, age, sex, result})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBMIPercentile(t *testing.T) {
+	pct := func(p float64) *float64 { return &p }
+	tests := []struct {
+		name     string
+		bmi, age float64
+		sex      string
+		want     percentileResult
+	}{
+		// Straight off the chart's rows
+		{"boy at his median", 16.6, 10, "male", percentileResult{pct(50), "50_to_85", "Healthy weight"}},
+		{"boy on the 85th", 19.4, 10, "male", percentileResult{pct(85), "85_to_95", "Overweight"}},
+		{"boy on the 95th", 22.1, 10, "male", percentileResult{pct(95), "95_and_above", "Obese"}},
+		{"boy under the 5th", 14.0, 10, "male", percentileResult{nil, "below_5", "Underweight"}},
+		{"girl on the 5th", 17.9, 20, "female", percentileResult{pct(5), "5_to_50", "Healthy weight"}},
+		{"girl over the 95th", 30, 15, "female", percentileResult{nil, "95_and_above", "Obese"}},
+		// Between 10 and 11 the 50th and 85th are 16.9 and 19.8
+		{"half a year", 18.0, 10.5, "male", percentileResult{pct(63.3), "50_to_85", "Healthy weight"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bmiPercentile(growthChart, tt.bmi, tt.age, tt.sex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Band != tt.want.Band || got.Category != tt.want.Category {
+				t.Errorf("band %s, category %s; want %s, %s", got.Band, got.Category, tt.want.Band, tt.want.Category)
+			}
+			switch {
+			case (got.Percentile == nil) != (tt.want.Percentile == nil):
+				t.Errorf("percentile = %v, want %v", got.Percentile, tt.want.Percentile)
+			case got.Percentile != nil && *got.Percentile != *tt.want.Percentile:
+				t.Errorf("percentile = %v, want %v", *got.Percentile, *tt.want.Percentile)
+			}
+		})
+	}
+
+	for _, bad := range []struct {
+		age float64
+		sex string
+	}{{1.9, "male"}, {20.1, "female"}, {10, "other"}, {10, ""}} {
+		if _, err := bmiPercentile(growthChart, 18, bad.age, bad.sex); err == nil {
+			t.Errorf("age %v, sex %q: want an error", bad.age, bad.sex)
+		}
+	}
+}
+
+func TestPercentileHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	percentileHandler(rec, httptest.NewRequest(http.MethodGet, "/bmi/percentile?bmi=19.4&age=10&sex=Male", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Sex        string  `json:"sex"`
+		Percentile float64 `json:"percentile"`
+		Category   string  `json:"category"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Sex != "male" || body.Percentile != 85 || body.Category != "Overweight" {
+		t.Errorf("body = %s, want the 85th percentile for a 10-year-old boy", rec.Body)
+	}
+
+	for _, query := range []string{"bmi=19&age=abc&sex=male", "bmi=19&age=25&sex=male", "bmi=&age=10&sex=male", "bmi=19&age=10&sex=x"} {
+		rec := httptest.NewRecorder()
+		percentileHandler(rec, httptest.NewRequest(http.MethodGet, "/bmi/percentile?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"bmi-calculator/respond"
+)
+
+// checkStorage proves that what bmi-service writes to before it answers a
+// calculation can still be written: the history store, through its own write
+// path, and the audit file when AUDIT_FILE is set.
+func checkStorage(ctx context.Context) error {
+	if err := store.CheckWritable(ctx); err != nil {
+		return err
+	}
+	if err := audit.CheckWritable(); err != nil {
+		return fmt.Errorf("audit log is not writable: %w", err)
+	}
+	return nil
+}
+
+// readyHandler answers 503 while storage can't be written, so Kubernetes holds
+// traffic back instead of letting calculations go unrecorded.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkStorage(r.Context()); err != nil {
+		respond.Error(w, r, http.StatusServiceUnavailable, "not_ready", err.Error())
+		return
+	}
+	respond.JSON(w, r, http.StatusOK, map[string]string{
+		"status":  "ready",
+		"service": "bmi-service",
+	})
+}
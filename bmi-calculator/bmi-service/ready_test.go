@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadyHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureRate float64
+		// breakAudit, when set, opens an audit file in a temporary directory and
+		// then breaks it; it reports false to skip the case
+		breakAudit func(t *testing.T, path string) bool
+		want       int
+	}{
+		{name: "writable", want: http.StatusOK},
+		{name: "store failing every write", failureRate: 1, want: http.StatusServiceUnavailable},
+		{name: "store failing some writes", failureRate: 0.5, want: http.StatusOK},
+		{
+			name: "audit file deleted",
+			breakAudit: func(t *testing.T, path string) bool {
+				return os.Remove(path) == nil
+			},
+			want: http.StatusServiceUnavailable,
+		},
+		{
+			name: "audit file in a read-only directory",
+			breakAudit: func(t *testing.T, path string) bool {
+				if os.Geteuid() == 0 {
+					t.Skip("root can write to read-only directories")
+				}
+				dir := filepath.Dir(path)
+				t.Cleanup(func() { os.Chmod(dir, 0o755) })
+				return os.Chmod(dir, 0o555) == nil
+			},
+			want: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(s *historyStore, a *auditLogger) { store, audit = s, a }(store, audit)
+			store = newHistoryStore()
+			store.failureRate = tt.failureRate
+			audit = nil
+			if tt.breakAudit != nil {
+				path := filepath.Join(t.TempDir(), "audit.log")
+				a, err := newAuditLogger(path, 1, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { a.file.Close() })
+				audit = a
+				if !tt.breakAudit(t, path) {
+					t.Fatal("could not break the audit file")
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			readyHandler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.want {
+				t.Errorf("GET /ready = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+// reclassifyHandler recategorises every stored calculation under ?standard= and
+// returns how many now fall in each category, to compare standards over the same
+// data. New calculations keep using BMI_STANDARD.
+func reclassifyHandler(w http.ResponseWriter, r *http.Request) {
+	standard := r.URL.Query().Get("standard")
+	if !isKnownStandard(standard) {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "standard must be one of "+strings.Join(standardNames(), ", "))
+		return
+	}
+
+	counts := make(map[string]int)
+	err := store.Update(r.Context(), func(c *BMICalculation) {
+		c.Category = getBMICategory(c.BMI, standard)
+		c.Standard = standard
+		counts[c.Category]++
+	})
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"standard":   standard,
+		"categories": counts,
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func reclassify(t *testing.T, standard string) (int, map[string]int) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reclassifyHandler(rec, httptest.NewRequest(http.MethodPost, "/history/reclassify?standard="+standard, nil))
+	var body struct {
+		Categories map[string]int `json:"categories"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body.Categories
+}
+
+func TestReclassify(t *testing.T) {
+	freshStore(t)
+	defer func(old string) { bmiStandard = old }(bmiStandard)
+	bmiStandard = standardWHO
+
+	// BMIs of 20, 23.5 and 27.6: the last two sit between the two standards' cutoffs
+	for _, body := range []string{
+		`{"weight": 61.25, "height": 1.75}`,
+		`{"weight": 72, "height": 1.75}`,
+		`{"weight": 84.5, "height": 1.75}`,
+	} {
+		postCalculate(t, body)
+	}
+
+	tests := []struct {
+		standard   string
+		categories []string // of the stored calculations, oldest first
+		counts     map[string]int
+	}{
+		{standardAsiaPacific, []string{"Normal weight", "Overweight", "Obese"}, map[string]int{"Normal weight": 1, "Overweight": 1, "Obese": 1}},
+		{standardWHO, []string{"Normal weight", "Normal weight", "Overweight"}, map[string]int{"Normal weight": 2, "Overweight": 1}},
+	}
+	for _, tt := range tests {
+		code, counts := reclassify(t, tt.standard)
+		if code != http.StatusOK || !reflect.DeepEqual(counts, tt.counts) {
+			t.Errorf("reclassify to %s = %d %v, want 200 %v", tt.standard, code, counts, tt.counts)
+		}
+		calculations, _ := store.List(context.Background())
+		for i, c := range calculations {
+			if c.Category != tt.categories[i] || c.Standard != tt.standard {
+				t.Errorf("after %s: BMI %.1f is %s under %s, want %s", tt.standard, c.BMI, c.Category, c.Standard, tt.categories[i])
+			}
+		}
+	}
+
+	if code, _ := reclassify(t, "imperial"); code != http.StatusBadRequest {
+		t.Errorf("unknown standard = %d, want 400", code)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+// activityFactors multiply BMR into total daily energy expenditure (TDEE).
+var activityFactors = map[string]float64{
+	"sedentary":   1.2,
+	"light":       1.375,
+	"moderate":    1.55,
+	"active":      1.725,
+	"very_active": 1.9,
+}
+
+// Mifflin-St Jeor is fitted on adults, so younger ages are refused rather than
+// answered with a misleading number.
+const (
+	minRecommendationAge = 18
+	maxRecommendationAge = 120
+)
+
+// mifflinStJeor returns the basal metabolic rate in kcal/day for weight in
+// kilograms, height in metres and age in years; sex is "male" or "female".
+func mifflinStJeor(weightKg, heightM float64, age int, sex string) float64 {
+	bmr := 10*weightKg + 6.25*heightM*100 - 5*float64(age)
+	if sex == "male" {
+		return bmr + 5
+	}
+	return bmr - 161
+}
+
+// recommendationsHandler estimates daily calorie needs for ?weight=&height=&age=
+// &sex=&activity=, taking the same ?unit= as /target-weight. It is an educational
+// estimate; nothing is stored.
+func recommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	unit := q.Get("unit")
+	if unit == "" {
+		unit = unitMetric
+	}
+	if unit != unitMetric && unit != unitImperial {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "unit must be metric or imperial")
+		return
+	}
+
+	weight, err := parseQuickValue("weight", q.Get("weight"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	height, err := parseQuickValue("height", q.Get("height"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	age, err := strconv.Atoi(q.Get("age"))
+	if err != nil || age < minRecommendationAge || age > maxRecommendationAge {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request",
+			fmt.Sprintf("age must be a whole number of years from %d to %d", minRecommendationAge, maxRecommendationAge))
+		return
+	}
+
+	sex := strings.ToLower(q.Get("sex"))
+	if sex != "male" && sex != "female" {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "sex must be male or female")
+		return
+	}
+
+	activity := strings.ToLower(q.Get("activity"))
+	factor, ok := activityFactors[activity]
+	if !ok {
+		levels := make([]string, 0, len(activityFactors))
+		for level := range activityFactors {
+			levels = append(levels, level)
+		}
+		sort.Strings(levels)
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "activity must be one of "+strings.Join(levels, ", "))
+		return
+	}
+
+	weightKg, heightM := toMetric(weight, height, unit)
+	bmr := mifflinStJeor(weightKg, heightM, age, sex)
+
+	markCacheable(w)
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"weight":          weight,
+		"height":          height,
+		"unit":            unit,
+		"age":             age,
+		"sex":             sex,
+		"activity":        activity,
+		"activity_factor": factor,
+		"bmr_kcal":        math.Round(bmr),
+		"tdee_kcal":       math.Round(bmr * factor),
+		"formula":         "mifflin-st-jeor",
+	})
+}
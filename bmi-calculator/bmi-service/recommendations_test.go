@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMifflinStJeor(t *testing.T) {
+	tests := []struct {
+		weight, height float64
+		age            int
+		sex            string
+		want           float64
+	}{
+		// 10*70 + 6.25*175 - 5*30 + 5
+		{70, 1.75, 30, "male", 1648.75},
+		// 10*60 + 6.25*165 - 5*25 - 161
+		{60, 1.65, 25, "female", 1345.25},
+		{90, 1.80, 50, "male", 1780},
+	}
+	for _, tt := range tests {
+		if got := mifflinStJeor(tt.weight, tt.height, tt.age, tt.sex); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("mifflinStJeor(%v, %v, %d, %s) = %v, want %v", tt.weight, tt.height, tt.age, tt.sex, got, tt.want)
+		}
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	get := func(query string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		recommendationsHandler(rec, httptest.NewRequest(http.MethodGet, "/recommendations?"+query, nil))
+		var body map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	code, body := get("weight=70&height=1.75&age=30&sex=male&activity=moderate")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %v", code, body)
+	}
+	// 1648.75 kcal BMR, times 1.55 for moderate activity
+	if body["bmr_kcal"] != 1649.0 || body["tdee_kcal"] != 2556.0 {
+		t.Errorf("bmr %v, tdee %v, want 1649 and 2556", body["bmr_kcal"], body["tdee_kcal"])
+	}
+	if body["weight"] != 70.0 || body["age"] != 30.0 || body["sex"] != "male" || body["activity"] != "moderate" || body["activity_factor"] != 1.55 {
+		t.Errorf("inputs not echoed: %v", body)
+	}
+
+	for _, query := range []string{
+		"height=1.75&age=30&sex=male&activity=moderate",
+		"weight=70&age=30&sex=male&activity=moderate",
+		"weight=70&height=1.75&sex=male&activity=moderate",
+		"weight=70&height=1.75&age=30&activity=moderate",
+		"weight=70&height=1.75&age=30&sex=male",
+		"weight=70&height=1.75&age=12&sex=male&activity=moderate",
+		"weight=70&height=1.75&age=30&sex=robot&activity=moderate",
+		"weight=70&height=1.75&age=30&sex=male&activity=couch",
+		"weight=70&height=1.75&age=30&sex=male&activity=moderate&unit=stone",
+	} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, code)
+		}
+	}
+}
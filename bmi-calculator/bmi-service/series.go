@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"bmi-calculator/respond"
+)
+
+// maxSeriesBuckets bounds a series so a tiny bucket over a long history can't
+// produce an enormous response.
+const maxSeriesBuckets = 10000
+
+type seriesPoint struct {
+	Start      string  `json:"start"`
+	Count      int     `json:"count"`
+	AverageBMI float64 `json:"average_bmi"`
+}
+
+// buildSeries groups calculations into consecutive buckets of the given width,
+// aligned to the Unix epoch, from the oldest calculation's bucket to the newest's.
+// Buckets without calculations are included with a zero count and average.
+// Calculations whose timestamp doesn't parse are skipped.
+func buildSeries(calculations []BMICalculation, bucket time.Duration) ([]seriesPoint, error) {
+	type acc struct {
+		count int
+		sum   float64
+	}
+	buckets := make(map[int64]*acc)
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, c := range calculations {
+		ts, err := time.Parse(time.RFC3339, c.Timestamp)
+		if err != nil {
+			continue
+		}
+		i := ts.UnixNano() / int64(bucket)
+		first, last = min(first, i), max(last, i)
+		a, ok := buckets[i]
+		if !ok {
+			a = &acc{}
+			buckets[i] = a
+		}
+		a.count++
+		a.sum += c.BMI
+	}
+
+	points := []seriesPoint{}
+	if len(buckets) == 0 {
+		return points, nil
+	}
+	if last-first+1 > maxSeriesBuckets {
+		return nil, fmt.Errorf("series would have %d buckets, more than %d; use a larger bucket", last-first+1, maxSeriesBuckets)
+	}
+	for i := first; i <= last; i++ {
+		p := seriesPoint{Start: time.Unix(0, i*int64(bucket)).UTC().Format(time.RFC3339)}
+		if a, ok := buckets[i]; ok {
+			p.Count = a.count
+			p.AverageBMI = math.Round(a.sum/float64(a.count)*100) / 100
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// seriesHandler serves GET /history/series?bucket=1h: calculation counts and
+// average BMI per time bucket, for plotting. It takes the same filters as /history.
+func seriesHandler(w http.ResponseWriter, r *http.Request) {
+	bucket := time.Hour
+	if raw := r.URL.Query().Get("bucket"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			respond.Error(w, r, http.StatusBadRequest, "invalid_request", "bucket must be a duration of at least 1s")
+			return
+		}
+		bucket = d
+	}
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	calculations, err := store.List(r.Context())
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+
+	points, err := buildSeries(filter.apply(calculations), bucket)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"bucket": bucket.String(),
+		"points": points,
+	})
+}
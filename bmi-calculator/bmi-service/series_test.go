@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildSeries(t *testing.T) {
+	calculations := []BMICalculation{
+		{BMI: 20, Category: "Normal weight", Timestamp: "2024-03-01T10:05:00Z"},
+		{BMI: 24.5, Category: "Normal weight", Timestamp: "2024-03-01T10:40:00Z"},
+		{BMI: 31, Category: "Obese", Timestamp: "2024-03-01T12:10:00Z"},
+		{BMI: 99, Timestamp: "yesterday"},
+	}
+	got, err := buildSeries(calculations, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []seriesPoint{
+		{Start: "2024-03-01T10:00:00Z", Count: 2, AverageBMI: 22.25},
+		{Start: "2024-03-01T11:00:00Z"},
+		{Start: "2024-03-01T12:00:00Z", Count: 1, AverageBMI: 31},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildSeries() = %+v, want %+v", got, want)
+	}
+
+	if got, err := buildSeries(nil, time.Hour); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("buildSeries(nil) = %#v, %v, want an empty series", got, err)
+	}
+	// The two hours spanned fit in one-second buckets, not in 100ms ones
+	if _, err := buildSeries(calculations, time.Second); err != nil {
+		t.Errorf("buildSeries() with one-second buckets: %v", err)
+	}
+	if _, err := buildSeries(calculations, 100*time.Millisecond); err == nil {
+		t.Error("buildSeries() with more than maxSeriesBuckets buckets succeeded, want an error")
+	}
+}
+
+func TestSeriesHandler(t *testing.T) {
+	freshStore(t)
+	for _, c := range []BMICalculation{
+		{BMI: 20, Category: "Normal weight", Timestamp: "2024-03-01T10:05:00Z"},
+		{BMI: 31, Category: "Obese", Timestamp: "2024-03-01T10:30:00Z"},
+		{BMI: 22, Category: "Normal weight", Timestamp: "2024-03-01T12:10:00Z"},
+	} {
+		c := c
+		store.Add(context.Background(), &c)
+	}
+
+	rec := httptest.NewRecorder()
+	seriesHandler(rec, httptest.NewRequest(http.MethodGet, "/history/series?bucket=1h&category=Normal%20weight", nil))
+	var body struct {
+		Bucket string        `json:"bucket"`
+		Points []seriesPoint `json:"points"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []seriesPoint{
+		{Start: "2024-03-01T10:00:00Z", Count: 1, AverageBMI: 20},
+		{Start: "2024-03-01T11:00:00Z"},
+		{Start: "2024-03-01T12:00:00Z", Count: 1, AverageBMI: 22},
+	}
+	if rec.Code != http.StatusOK || body.Bucket != "1h0m0s" || !reflect.DeepEqual(body.Points, want) {
+		t.Errorf("series = %d %s %+v, want 200 1h0m0s %+v", rec.Code, body.Bucket, body.Points, want)
+	}
+
+	for _, query := range []string{"bucket=10ms", "bucket=hourly"} {
+		rec := httptest.NewRecorder()
+		seriesHandler(rec, httptest.NewRequest(http.MethodGet, "/history/series?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
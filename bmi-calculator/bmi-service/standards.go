@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+)
+
+// bmiCutoff assigns category to every BMI below the bound.
+type bmiCutoff struct {
+	below    float64
+	category string
+}
+
+const (
+	standardWHO         = "who"
+	standardAsiaPacific = "asia-pacific"
+)
+
+// bmiStandards lists each scheme's cutoffs in ascending order; a BMI above the last
+// cutoff is "Obese". The Asia-Pacific scheme follows the WHO regional guidance of
+// lower overweight and obese thresholds.
+var bmiStandards = map[string][]bmiCutoff{
+	standardWHO: {
+		{18.5, "Underweight"},
+		{25, "Normal weight"},
+		{30, "Overweight"},
+	},
+	standardAsiaPacific: {
+		{18.5, "Underweight"},
+		{23, "Normal weight"},
+		{25, "Overweight"},
+	},
+}
+
+func getBMICategory(bmi float64, standard string) string {
+	for _, cutoff := range bmiStandards[standard] {
+		if bmi < cutoff.below {
+			return cutoff.category
+		}
+	}
+	return "Obese"
+}
+
+func isKnownStandard(standard string) bool {
+	_, ok := bmiStandards[standard]
+	return ok
+}
+
+func standardNames() []string {
+	names := make([]string, 0, len(bmiStandards))
+	for name := range bmiStandards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetBMICategory(t *testing.T) {
+	tests := []struct {
+		bmi              float64
+		who, asiaPacific string
+	}{
+		{17, "Underweight", "Underweight"},
+		{22, "Normal weight", "Normal weight"},
+		{24, "Normal weight", "Overweight"},
+		{27, "Overweight", "Obese"},
+		{31, "Obese", "Obese"},
+	}
+	for _, tt := range tests {
+		if got := getBMICategory(tt.bmi, standardWHO); got != tt.who {
+			t.Errorf("getBMICategory(%v, who) = %q, want %q", tt.bmi, got, tt.who)
+		}
+		if got := getBMICategory(tt.bmi, standardAsiaPacific); got != tt.asiaPacific {
+			t.Errorf("getBMICategory(%v, asia-pacific) = %q, want %q", tt.bmi, got, tt.asiaPacific)
+		}
+	}
+}
+
+func TestCalculationReportsStandard(t *testing.T) {
+	freshStore(t)
+	defer func(old string) { bmiStandard = old }(bmiStandard)
+
+	for _, standard := range []string{standardWHO, standardAsiaPacific} {
+		bmiStandard = standard
+		// 72 kg at 1.75 m is a BMI of 23.5
+		rec := postCalculate(t, `{"weight": 72, "height": 1.75}`)
+		var got BMICalculation
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{standardWHO: "Normal weight", standardAsiaPacific: "Overweight"}[standard]
+		if got.Standard != standard || got.Category != want {
+			t.Errorf("BMI_STANDARD=%s: standard %q, category %q, want %q and %q", standard, got.Standard, got.Category, standard, want)
+		}
+	}
+}
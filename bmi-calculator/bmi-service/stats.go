@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"bmi-calculator/respond"
+
+	"middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// requestStats counts requests in process, for environments where nobody scrapes
+// /metrics. Counters only grow until the process restarts.
+type requestStats struct {
+	total        atomic.Uint64
+	clientErrors atomic.Uint64
+	serverErrors atomic.Uint64
+	// endpoints maps a route template such as /history/{id} to its *atomic.Uint64
+	endpoints sync.Map
+}
+
+var stats requestStats
+
+// Middleware counts each request under its route template, which keeps IDs and
+// path parameters out of the keys. It must run as router middleware.
+func (s *requestStats) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := middleware.RecordStatus(w)
+		next.ServeHTTP(rec, r)
+
+		s.total.Add(1)
+		switch {
+		case rec.Status() >= 500:
+			s.serverErrors.Add(1)
+		case rec.Status() >= 400:
+			s.clientErrors.Add(1)
+		}
+
+		counter, _ := s.endpoints.LoadOrStore(r.Method+" "+routeTemplate(r), new(atomic.Uint64))
+		counter.(*atomic.Uint64).Add(1)
+	})
+}
+
+// routeTemplate is the path template of the route r matched, e.g.
+// /bmi/{weight}/{height}, so per-endpoint counts don't grow with every value; it
+// falls back to the path for unmatched requests.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints := make(map[string]uint64)
+	stats.endpoints.Range(func(key, value interface{}) bool {
+		endpoints[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"total_requests": stats.total.Load(),
+		"client_errors":  stats.clientErrors.Load(),
+		"server_errors":  stats.serverErrors.Load(),
+		"endpoints":      endpoints,
+	})
+}
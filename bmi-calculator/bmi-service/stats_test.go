@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type statsSnapshot struct {
+	TotalRequests uint64            `json:"total_requests"`
+	ClientErrors  uint64            `json:"client_errors"`
+	ServerErrors  uint64            `json:"server_errors"`
+	Endpoints     map[string]uint64 `json:"endpoints"`
+}
+
+func readStats(t *testing.T) statsSnapshot {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	statsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var s statsSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRequestStats(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(stats.Middleware)
+	r.HandleFunc("/bmi/{weight}/{height}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}).Methods("GET")
+	r.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods("GET")
+	r.HandleFunc("/rejected", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}).Methods("GET")
+
+	// Counters are process-wide, so compare against what was there before
+	before := readStats(t)
+	requests := []struct {
+		path  string
+		times int
+	}{
+		{"/bmi/70/1.75", 30},
+		{"/bmi/90/1.80", 20},
+		{"/broken", 7},
+		{"/rejected", 3},
+	}
+	var wg sync.WaitGroup
+	for _, req := range requests {
+		for i := 0; i < req.times; i++ {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+			}(req.path)
+		}
+	}
+	wg.Wait()
+	after := readStats(t)
+
+	if got := after.TotalRequests - before.TotalRequests; got != 60 {
+		t.Errorf("total_requests grew by %d, want 60", got)
+	}
+	if got := after.ClientErrors - before.ClientErrors; got != 3 {
+		t.Errorf("client_errors grew by %d, want 3", got)
+	}
+	if got := after.ServerErrors - before.ServerErrors; got != 7 {
+		t.Errorf("server_errors grew by %d, want 7", got)
+	}
+	for endpoint, want := range map[string]uint64{
+		"GET /bmi/{weight}/{height}": 50,
+		"GET /broken":                7,
+		"GET /rejected":              3,
+	} {
+		if got := after.Endpoints[endpoint] - before.Endpoints[endpoint]; got != want {
+			t.Errorf("%s grew by %d, want %d", endpoint, got, want)
+		}
+	}
+	if _, ok := after.Endpoints["GET /bmi/70/1.75"]; ok {
+		t.Error("endpoints keyed by the raw path, want the route template")
+	}
+}
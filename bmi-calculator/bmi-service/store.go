@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"chaos"
+)
+
+// errStorageUnavailable is what Add returns when it simulates the store's backing
+// dependency failing.
+var errStorageUnavailable = errors.New("history storage is unavailable")
+
+// historyStore keeps calculations in memory. Operations take a context so a
+// cancelled or timed-out request stops touching the store, which matters once
+// the store is backed by something slower than a slice.
+type historyStore struct {
+	mu           sync.RWMutex
+	calculations []BMICalculation
+	// revision increases on every change so callers can cheaply tell whether history moved
+	revision uint64
+	lastID   uint64
+
+	subscribers map[chan BMICalculation]struct{}
+
+	// failureRate is the share of Adds failed with errStorageUnavailable, standing
+	// in for a database that is down or overloaded, drawn from rng, which main
+	// reseeds from RAND_SEED
+	failureRate float64
+	rng         *rand.Rand
+
+	// onAdd, when set, is called with each calculation Add stores, once it is stored
+	onAdd func(BMICalculation)
+}
+
+// subscriberBuffer is how many calculations a slow subscriber may fall behind
+// before further ones are dropped for it rather than blocking Add.
+const subscriberBuffer = 16
+
+func newHistoryStore() *historyStore {
+	return &historyStore{
+		subscribers: make(map[chan BMICalculation]struct{}),
+		rng:         chaos.NewRand(time.Now().UnixNano()),
+	}
+}
+
+// Add stores calculation, setting its ID to the next unused one.
+func (s *historyStore) Add(ctx context.Context, calculation *BMICalculation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.failureRate > 0 && s.rng.Float64() < s.failureRate {
+		return errStorageUnavailable
+	}
+	s.mu.Lock()
+	s.lastID++
+	calculation.ID = s.lastID
+	s.calculations = append(s.calculations, *calculation)
+	s.revision++
+	for ch := range s.subscribers {
+		select {
+		case ch <- *calculation:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	if s.onAdd != nil {
+		s.onAdd(*calculation)
+	}
+	return nil
+}
+
+// CheckWritable goes through Add's write path without storing anything. Memory
+// can always be written, so it only fails while the simulated backing dependency
+// fails every write (STORAGE_FAILURE_RATE=1); intermittent failures leave the
+// service ready, for DEGRADE_ON_STORAGE_ERROR to answer.
+func (s *historyStore) CheckWritable(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.failureRate >= 1 {
+		return errStorageUnavailable
+	}
+	return nil
+}
+
+// Delete removes the calculation with the given ID and reports whether it existed.
+func (s *historyStore) Delete(ctx context.Context, id uint64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.calculations {
+		if c.ID == id {
+			s.calculations = append(s.calculations[:i], s.calculations[i+1:]...)
+			s.revision++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Update calls fn on every stored calculation in insertion order while holding the
+// write lock, so readers never see a half-updated history. Subscribers are not
+// told; they only follow new calculations.
+func (s *historyStore) Update(ctx context.Context, fn func(*BMICalculation)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.calculations {
+		fn(&s.calculations[i])
+	}
+	s.revision++
+	return nil
+}
+
+// Subscribe returns a channel receiving every calculation added from now on and a
+// function that unsubscribes and closes it.
+func (s *historyStore) Subscribe() (<-chan BMICalculation, func()) {
+	ch := make(chan BMICalculation, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// List returns a copy of the stored calculations in insertion order.
+func (s *historyStore) List(ctx context.Context) ([]BMICalculation, error) {
+	calculations, _, err := s.Snapshot(ctx)
+	return calculations, err
+}
+
+// Snapshot returns a copy of the stored calculations together with the revision
+// they were read at.
+func (s *historyStore) Snapshot(ctx context.Context) ([]BMICalculation, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]BMICalculation, len(s.calculations))
+	copy(out, s.calculations)
+	return out, s.revision, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"bmi-calculator/respond"
+)
+
+var streamHeartbeat = getEnvDuration("HISTORY_STREAM_HEARTBEAT", 15*time.Second)
+
+// historyStreamHandler pushes every new calculation to the client as a
+// server-sent event until it disconnects. Comment lines are sent as heartbeats
+// so idle connections aren't closed by proxies.
+func historyStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond.Error(w, r, http.StatusInternalServerError, "streaming_unsupported", "streaming not supported")
+		return
+	}
+
+	calculations, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case calculation := <-calculations:
+			data, err := respond.Marshal(calculation)
+			if err != nil {
+				log.Printf("Error encoding stream event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: calculation\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subscribers counts the store's live stream subscriptions.
+func subscribers() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.subscribers)
+}
+
+func TestHistoryStream(t *testing.T) {
+	freshStore(t)
+	defer func(old time.Duration) { streamHeartbeat = old }(streamHeartbeat)
+	streamHeartbeat = 20 * time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(historyStreamHandler))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The subscription is in place before the headers are sent
+	postCalculate(t, `{"weight": 70, "height": 1.75, "user_id": "ana"}`)
+
+	lines := bufio.NewScanner(resp.Body)
+	var event string
+	heartbeats := 0
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case line == ": heartbeat":
+			heartbeats++
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var calculation BMICalculation
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &calculation); err != nil {
+				t.Fatalf("event data is not a calculation: %v", err)
+			}
+			if event != "calculation" || calculation.UserID != "ana" {
+				t.Fatalf("got %s event %+v, want ana's calculation", event, calculation)
+			}
+		}
+		if event != "" && heartbeats > 0 {
+			break
+		}
+	}
+	if event == "" || heartbeats == 0 {
+		t.Fatalf("stream ended with event %q and %d heartbeats: %v", event, heartbeats, lines.Err())
+	}
+
+	// Hanging up removes the subscriber
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber still registered a second after the client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
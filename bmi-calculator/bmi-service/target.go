@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"bmi-calculator/respond"
+)
+
+// maxTargetBMI bounds GET /target-weight to BMIs a person can plausibly aim for.
+const maxTargetBMI = 100
+
+// targetWeightHandler answers "what weight gives this BMI at this height?", the
+// inverse of a calculation. ?unit=imperial takes the height in inches and returns
+// pounds. Nothing is stored.
+func targetWeightHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	unit := q.Get("unit")
+	if unit == "" {
+		unit = unitMetric
+	}
+	if unit != unitMetric && unit != unitImperial {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "unit must be metric or imperial")
+		return
+	}
+
+	height, err := parseQuickValue("height", q.Get("height"))
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	bmi, err := strconv.ParseFloat(q.Get("bmi"), 64)
+	if err != nil || math.IsNaN(bmi) || bmi <= 0 || bmi > maxTargetBMI {
+		respond.Error(w, r, http.StatusBadRequest, "invalid_request", "bmi must be greater than 0 and at most "+strconv.Itoa(maxTargetBMI))
+		return
+	}
+
+	_, heightM := toMetric(0, height, unit)
+	weight := fromMetricWeight(bmi*heightM*heightM, unit)
+
+	markCacheable(w)
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"height":   height,
+		"unit":     unit,
+		"bmi":      bmi,
+		"weight":   math.Round(weight*100) / 100,
+		"category": getBMICategory(bmi, bmiStandard),
+		"standard": bmiStandard,
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTargetWeight(t *testing.T) {
+	defer func(old string) { bmiStandard = old }(bmiStandard)
+	bmiStandard = standardWHO
+
+	tests := []struct {
+		query    string
+		weight   float64
+		category string
+	}{
+		{"height=1.75&bmi=22", 67.4, "Normal weight"},
+		{"height=69&bmi=22&unit=imperial", 149.0, "Normal weight"},
+		{"height=1.75&bmi=31", 94.9, "Obese"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		targetWeightHandler(rec, httptest.NewRequest(http.MethodGet, "/target-weight?"+tt.query, nil))
+		var body struct {
+			Weight   float64 `json:"weight"`
+			Category string  `json:"category"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || math.Abs(body.Weight-tt.weight) > 0.05 || body.Category != tt.category {
+			t.Errorf("?%s = %d %v %q, want ≈ %v %q", tt.query, rec.Code, body.Weight, body.Category, tt.weight, tt.category)
+		}
+	}
+
+	for _, query := range []string{"height=1.75", "height=1.75&bmi=0", "height=1.75&bmi=NaN", "height=1.75&bmi=1000", "bmi=22", "height=0&bmi=22", "height=1.75&bmi=22&unit=stone"} {
+		rec := httptest.NewRecorder()
+		targetWeightHandler(rec, httptest.NewRequest(http.MethodGet, "/target-weight?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+
+	"bmi-calculator/respond"
+
+	"github.com/gorilla/mux"
+)
+
+// trendThreshold is the BMI change per calculation below which a trend counts as stable.
+const trendThreshold = 0.01
+
+type trendPoint struct {
+	Timestamp string  `json:"timestamp"`
+	BMI       float64 `json:"bmi"`
+	Category  string  `json:"category"`
+}
+
+// trendHandler returns one user's BMI over time, oldest first, and whether it is
+// trending up, down or staying stable.
+func trendHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	calculations, err := store.List(r.Context())
+	if err != nil {
+		writeContextError(w, r, err)
+		return
+	}
+
+	points := []trendPoint{}
+	for _, c := range calculations {
+		if c.UserID == userID {
+			points = append(points, trendPoint{Timestamp: c.Timestamp, BMI: c.BMI, Category: c.Category})
+		}
+	}
+
+	if len(points) == 0 {
+		respond.Error(w, r, http.StatusNotFound, "not_found", "no calculations for user "+userID)
+		return
+	}
+
+	slope := trendSlope(points)
+	respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"points":  points,
+		"count":   len(points),
+		"slope":   slope,
+		"trend":   trendDirection(len(points), slope),
+	})
+}
+
+// trendSlope fits a least-squares line through the BMIs in submission order and
+// returns its slope, i.e. the average BMI change per calculation.
+func trendSlope(points []trendPoint) float64 {
+	n := float64(len(points))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, p := range points {
+		x := float64(i)
+		sumX += x
+		sumY += p.BMI
+		sumXY += x * p.BMI
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+func trendDirection(count int, slope float64) string {
+	switch {
+	case count < 2:
+		return "insufficient data"
+	case slope > trendThreshold:
+		return "up"
+	case slope < -trendThreshold:
+		return "down"
+	default:
+		return "stable"
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// getTrend sends GET /history/{user_id}/trend to trendHandler.
+func getTrend(t *testing.T, userID string) (int, map[string]interface{}) {
+	t.Helper()
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/history/"+userID+"/trend", nil), map[string]string{"user_id": userID})
+	rec := httptest.NewRecorder()
+	trendHandler(rec, r)
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, body
+}
+
+func TestTrend(t *testing.T) {
+	freshStore(t)
+	for _, weight := range []string{"70", "75", "80"} {
+		postCalculate(t, `{"weight": `+weight+`, "height": 1.75, "user_id": "ana"}`)
+	}
+	postCalculate(t, `{"weight": 60, "height": 1.75, "user_id": "bo"}`)
+	postCalculate(t, `{"weight": 90, "height": 1.75}`)
+
+	code, body := getTrend(t, "ana")
+	if code != http.StatusOK || body["trend"] != "up" || body["count"] != 3.0 {
+		t.Fatalf("ana's trend = %d %v, want 200, up over 3 points", code, body)
+	}
+	// 5 kg at 1.75 m is about 1.63 BMI per calculation
+	if slope, _ := body["slope"].(float64); slope < 1.6 || slope > 1.7 {
+		t.Errorf("slope = %v, want about 1.63", body["slope"])
+	}
+
+	if code, body := getTrend(t, "bo"); code != http.StatusOK || body["trend"] != "insufficient data" {
+		t.Errorf("bo's trend = %d %v, want 200 with insufficient data", code, body)
+	}
+	if code, _ := getTrend(t, "nobody"); code != http.StatusNotFound {
+		t.Errorf("unknown user's trend = %d, want 404", code)
+	}
+}
+
+func TestTrendDirection(t *testing.T) {
+	points := func(bmis ...float64) []trendPoint {
+		out := make([]trendPoint, len(bmis))
+		for i, bmi := range bmis {
+			out[i].BMI = bmi
+		}
+		return out
+	}
+	tests := []struct {
+		points []trendPoint
+		want   string
+	}{
+		{points(22, 23, 24), "up"},
+		{points(24, 23, 22), "down"},
+		{points(22, 22, 22), "stable"},
+		{points(22), "insufficient data"},
+	}
+	for _, tt := range tests {
+		if got := trendDirection(len(tt.points), trendSlope(tt.points)); got != tt.want {
+			t.Errorf("trend of %v = %q, want %q", tt.points, got, tt.want)
+		}
+	}
+}
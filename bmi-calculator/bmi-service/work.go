@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// workIterations is the refinement steps per unit of CALC_WORK_FACTOR, roughly a
+	// millisecond of CPU on a typical core
+	workIterations = 100000
+	maxWorkFactor  = 1000
+)
+
+var (
+	calcWorkFactor = clampWorkFactor(getEnvInt("CALC_WORK_FACTOR", 0))
+
+	calcWorkDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bmi_calc_work_seconds",
+		Help:    "CPU time spent on artificial CALC_WORK_FACTOR work per calculation",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+	})
+
+	// workSink keeps the compiler from optimising the artificial work away
+	workSink float64
+)
+
+func clampWorkFactor(n int) int {
+	if n < 0 || n > maxWorkFactor {
+		log.Printf("CALC_WORK_FACTOR %d out of range, clamping to [0, %d]", n, maxWorkFactor)
+		return max(0, min(n, maxWorkFactor))
+	}
+	return n
+}
+
+// simulateWork burns CPU in proportion to CALC_WORK_FACTOR by repeatedly refining
+// the square root of bmi, so bmi-service can be made CPU-bound for HPA demos.
+func simulateWork(bmi float64) {
+	if calcWorkFactor == 0 {
+		return
+	}
+	start := time.Now()
+	x := math.Max(bmi, 1)
+	for i := 0; i < calcWorkFactor*workIterations; i++ {
+		x = x - (x*x-bmi)/(2*x) + 1e-9
+	}
+	workSink = x
+	calcWorkDuration.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func workSamples(t *testing.T) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := calcWorkDuration.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// calculateLatency is the fastest of a few /calculate requests, to keep
+// scheduling noise out of the comparison.
+func calculateLatency(t *testing.T) time.Duration {
+	t.Helper()
+	fastest := time.Duration(1<<63 - 1)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		postCalculate(t, `{"weight": 70, "height": 1.75}`)
+		fastest = min(fastest, time.Since(start))
+	}
+	return fastest
+}
+
+func TestCalcWorkFactor(t *testing.T) {
+	freshStore(t)
+	defer func(old int) { calcWorkFactor = old }(calcWorkFactor)
+
+	calcWorkFactor = 0
+	before := workSamples(t)
+	baseline := calculateLatency(t)
+	if got := workSamples(t); got != before {
+		t.Errorf("bmi_calc_work_seconds recorded %d samples with CALC_WORK_FACTOR=0, want none", got-before)
+	}
+
+	calcWorkFactor = 20
+	loaded := calculateLatency(t)
+	if loaded < baseline+5*time.Millisecond {
+		t.Errorf("/calculate took %v with CALC_WORK_FACTOR=20 and %v without, want it measurably slower", loaded, baseline)
+	}
+	if got := workSamples(t); got != before+3 {
+		t.Errorf("bmi_calc_work_seconds recorded %d samples for 3 calculations, want 3", got-before)
+	}
+}
+
+func TestClampWorkFactor(t *testing.T) {
+	for in, want := range map[int]int{-5: 0, 0: 0, 10: 10, maxWorkFactor + 1: maxWorkFactor} {
+		if got := clampWorkFactor(in); got != want {
+			t.Errorf("clampWorkFactor(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
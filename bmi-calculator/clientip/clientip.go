@@ -0,0 +1,123 @@
+// Package clientip works out the address of the client behind a request,
+// optionally honouring the headers set by proxies in front of the service.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver resolves client addresses. Forwarded headers are only consulted
+// when TrustProxyHeaders is set or TrustedProxies is not empty, since any client
+// can send them. With TrustedProxies, they are also ignored unless the peer is
+// inside one of the networks, so clients reaching the service directly can't
+// spoof their address.
+type Resolver struct {
+	TrustProxyHeaders bool
+	TrustedProxies    []*net.IPNet
+}
+
+// ParseCIDRs parses a comma-separated list of CIDRs such as
+// "10.0.0.0/8,fd00::/8"; an empty list gives nil.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// FromRequest returns the client IP for r when the peer is trusted: from
+// X-Forwarded-For, else X-Real-IP, when valid. Otherwise it is the peer address.
+// With TrustedProxies, X-Forwarded-For is read from the right, skipping the
+// trusted proxies' own hops, and the first address outside them is the client;
+// anything left of it was written by that client and can't be believed. Without
+// TrustedProxies every hop is trusted, so it is the leftmost entry.
+func (res Resolver) FromRequest(r *http.Request) string {
+	if res.trusts(r.RemoteAddr) {
+		if ip := res.forwardedFor(r.Header.Values("X-Forwarded-For")); ip != "" {
+			return ip
+		}
+		if ip := parse(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	if ip := parse(r.RemoteAddr); ip != "" {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// forwardedFor picks the client out of the X-Forwarded-For header lines, or ""
+// when there is none. A malformed entry ends the walk, since the hops left of it
+// can't be told apart; the nearest valid one found is used then.
+func (res Resolver) forwardedFor(lines []string) string {
+	var hops []string
+	for _, line := range lines {
+		hops = append(hops, strings.Split(line, ",")...)
+	}
+	if len(res.TrustedProxies) == 0 {
+		if len(hops) == 0 {
+			return ""
+		}
+		return parse(hops[0])
+	}
+
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parse(hops[i])
+		if ip == "" {
+			break
+		}
+		client = ip
+		if !res.trustedIP(net.ParseIP(ip)) {
+			break
+		}
+	}
+	return client
+}
+
+// trusts reports whether forwarded headers from the peer at remoteAddr count.
+func (res Resolver) trusts(remoteAddr string) bool {
+	if len(res.TrustedProxies) == 0 {
+		return res.TrustProxyHeaders
+	}
+	return res.trustedIP(net.ParseIP(parse(remoteAddr)))
+}
+
+func (res Resolver) trustedIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range res.TrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port" and returns the
+// canonical IP, or "" when the value isn't an address.
+func parse(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		resolver Resolver
+		remote   string
+		xff      []string
+		realIP   string
+		want     string
+	}{
+		{
+			name:   "headers ignored by default",
+			remote: "203.0.113.7:5000",
+			xff:    []string{"198.51.100.1"},
+			want:   "203.0.113.7",
+		},
+		{
+			name:     "TrustProxyHeaders takes the leftmost entry",
+			resolver: Resolver{TrustProxyHeaders: true},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"198.51.100.1, 10.0.0.3"},
+			want:     "198.51.100.1",
+		},
+		{
+			name:     "trusted hops are skipped from the right",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"198.51.100.1, 10.1.2.3"},
+			want:     "198.51.100.1",
+		},
+		{
+			name:     "spoofed leftmost entry is not believed",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"1.2.3.4, 203.0.113.7, 10.1.2.3"},
+			want:     "203.0.113.7",
+		},
+		{
+			name:     "header lines are walked as one list",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"1.2.3.4", "203.0.113.7", "10.1.2.3"},
+			want:     "203.0.113.7",
+		},
+		{
+			name:     "all hops trusted gives the leftmost",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"10.5.5.5, fd00::1"},
+			want:     "10.5.5.5",
+		},
+		{
+			name:     "malformed entry stops the walk",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			xff:      []string{"1.2.3.4, not-an-ip, 10.1.2.3"},
+			want:     "10.1.2.3",
+		},
+		{
+			name:     "untrusted peer uses the socket address",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "203.0.113.9:5000",
+			xff:      []string{"1.2.3.4"},
+			realIP:   "1.2.3.4",
+			want:     "203.0.113.9",
+		},
+		{
+			name:     "X-Real-IP from a trusted peer without X-Forwarded-For",
+			resolver: Resolver{TrustedProxies: trusted},
+			remote:   "10.0.0.2:5000",
+			realIP:   "198.51.100.1",
+			want:     "198.51.100.1",
+		},
+		{
+			name:   "IPv6 peer",
+			remote: "[2001:db8::1]:5000",
+			want:   "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, line := range tt.xff {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := tt.resolver.FromRequest(r); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	if nets, err := ParseCIDRs(""); err != nil || nets != nil {
+		t.Errorf("ParseCIDRs(\"\") = %v, %v, want nil, nil", nets, err)
+	}
+	if _, err := ParseCIDRs("10.0.0.0/8,bogus"); err == nil {
+		t.Error("ParseCIDRs accepted an invalid CIDR")
+	}
+}
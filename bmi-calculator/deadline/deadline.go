@@ -0,0 +1,45 @@
+// Package deadline carries a client's time budget across services in the
+// X-Timeout-Ms header, so every hop gives up once the original caller would.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header holds the remaining budget in whole milliseconds.
+const Header = "X-Timeout-Ms"
+
+// FromRequest returns the budget r asks for, clamped to max. ok is false when the
+// header is absent; a value that is not a positive integer is an error.
+func FromRequest(r *http.Request, max time.Duration) (budget time.Duration, ok bool, err error) {
+	raw := r.Header.Get(Header)
+	if raw == "" {
+		return 0, false, nil
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false, fmt.Errorf("%s must be a positive number of milliseconds", Header)
+	}
+	if ms > max.Milliseconds() {
+		return max, true, nil
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+// Propagate sets the header on an outgoing request to what is left of ctx's
+// deadline, rounded up so a budget under a millisecond is not sent as 0.
+func Propagate(ctx context.Context, h http.Header) {
+	when, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(when)
+	if remaining <= 0 {
+		remaining = time.Millisecond
+	}
+	h.Set(Header, strconv.FormatInt((remaining+time.Millisecond-1).Milliseconds(), 10))
+}
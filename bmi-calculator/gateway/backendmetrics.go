@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"bmi-calculator/respond"
+
+	"github.com/gorilla/mux"
+)
+
+// backendMetricsHandler proxies GET /api/{service}/metrics to /metrics on one
+// backend of the named pool, picked like any other proxied request. Passing the
+// response through untouched keeps the exposition format's Content-Type. Services
+// are also known by their route prefix, so /api/bmi/metrics keeps reaching the
+// BMI service's /metrics as it did through the /api/bmi proxy.
+func backendMetricsHandler(pools map[string]*backendPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		service := mux.Vars(r)["service"]
+		pool, ok := pools[service]
+		if !ok {
+			respond.Error(w, r, http.StatusNotFound, "not_found", "unknown service "+service)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path, r2.URL.RawPath = "/metrics", ""
+		pool.ServeHTTP(w, r2)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBackendMetricsProxy(t *testing.T) {
+	const contentType = "text/plain; version=0.0.4; charset=utf-8"
+	const exposition = "# TYPE http_requests_total counter\nhttp_requests_total 7\n"
+	pool := poolFor(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(exposition))
+	})
+	r := mux.NewRouter()
+	r.Handle("/api/{service}/metrics", backendMetricsHandler(map[string]*backendPool{
+		"bmi-service": pool,
+		"bmi":         pool,
+	})).Methods("GET")
+
+	for _, path := range []string{"/api/bmi-service/metrics", "/api/bmi/metrics"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != exposition {
+			t.Errorf("GET %s = %d %q, want the backend's metrics", path, rec.Code, rec.Body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != contentType {
+			t.Errorf("GET %s Content-Type = %q, want %q", path, ct, contentType)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/nosuch/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown service = %d, want 404", rec.Code)
+	}
+}
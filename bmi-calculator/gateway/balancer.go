@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// virtualNodes is how many points each backend gets on the hash ring; more
+// points spread keys more evenly at the cost of a larger ring.
+const virtualNodes = 100
+
+type backend struct {
+	target   string
+	basePath string
+	proxy    *httputil.ReverseProxy
+	outliers *outlierStats
+	// active counts requests being proxied to the backend, for least-connections
+	active atomic.Int64
+}
+
+// backendPool spreads requests for one service across its backend URLs using
+// the configured Balancer. With outlier detection, ejected backends are skipped
+// unless every backend is ejected.
+type backendPool struct {
+	name     string
+	backends []*backend
+	balancer Balancer
+	outliers *outlierConfig
+}
+
+// newBackendPool builds a pool from a comma-separated list of backend URLs. Every
+// URL needs an http or https scheme and a host; the first that doesn't is returned
+// as an error so the gateway never starts proxying to a half-parsed target.
+// basePath, from parseBasePath, is prepended to every path sent to the backends.
+// strategy is an LB_STRATEGY name; stickyKey is the header name, or "ip" for the
+// client address, that consistent-hash hashes on. outliers is nil to disable
+// outlier detection.
+func newBackendPool(name, targets, basePath string, transport http.RoundTripper, strategy, stickyKey string, outliers *outlierConfig) (*backendPool, error) {
+	pool := &backendPool{name: name, outliers: outliers}
+	for _, target := range strings.Split(targets, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		targetURL, err := parseBackendURL(target)
+		if err != nil {
+			return nil, fmt.Errorf("backend URL %q: %w", target, err)
+		}
+		b := &backend{
+			target:   target,
+			basePath: basePath,
+			proxy:    createReverseProxy(targetURL, basePath, transport),
+		}
+		if outliers != nil {
+			b.outliers = newOutlierStats(outliers)
+		}
+		pool.backends = append(pool.backends, b)
+	}
+
+	if len(pool.backends) == 0 {
+		return nil, errors.New("no backend URLs configured")
+	}
+
+	balancer, err := newBalancer(strategy, pool.backends, stickyKey)
+	if err != nil {
+		return nil, err
+	}
+	pool.balancer = balancer
+
+	log.Printf("%s backends: %s (strategy: %s, base path: %q)", name, strings.Join(pool.targets(), ", "), strategy, basePath)
+	return pool, nil
+}
+
+// fatalf stops the gateway over a startup error; tests swap it to see the
+// refusal without exiting.
+var fatalf = log.Fatalf
+
+// mustBackendPool is newBackendPool for startup: an invalid URL list is fatal,
+// naming envVar, so a typo stops the rollout rather than proxying to nowhere.
+func mustBackendPool(envVar, name, targets, basePath string, transport http.RoundTripper, strategy, stickyKey string, outliers *outlierConfig) *backendPool {
+	pool, err := newBackendPool(name, targets, basePath, transport, strategy, stickyKey, outliers)
+	if err != nil {
+		fatalf("Invalid %s: %v", envVar, err)
+		return nil
+	}
+	return pool
+}
+
+func (p *backendPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := p.pick(r)
+	// Held until the proxied body is fully copied, and released on upstream
+	// errors too, since ErrorHandler runs inside ServeHTTP
+	b.active.Add(1)
+	defer b.active.Add(-1)
+	if p.outliers == nil {
+		b.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.serveTracked(b, w, r)
+}
+
+func (p *backendPool) pick(r *http.Request) *backend {
+	n := uint64(p.balancer.Pick(r, p.backends))
+	if p.outliers == nil {
+		return p.backends[n]
+	}
+
+	// Walk on from the balancer's choice to the first backend still in rotation.
+	// One still slow-starting is only taken with a chance equal to its weight.
+	now := time.Now()
+	var fallback *backend
+	for i := uint64(0); i < uint64(len(p.backends)); i++ {
+		b := p.backends[(n+i)%uint64(len(p.backends))]
+		weight := b.outliers.weight(p.outliers, now)
+		if weight == 0 {
+			continue
+		}
+		if weight >= 1 || rand.Float64() < weight {
+			return b
+		}
+		if fallback == nil {
+			fallback = b
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	// Everything is ejected: spreading the load beats refusing it
+	return p.backends[n]
+}
+
+// url is the address of path on the backend, under its base path; for requests
+// the gateway makes itself rather than proxies.
+func (b *backend) url(path string) string {
+	return b.target + b.basePath + path
+}
+
+func (p *backendPool) targets() []string {
+	targets := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		targets[i] = b.target
+	}
+	return targets
+}
+
+// hashRing is a consistent-hash ring: adding or removing a backend only remaps
+// the keys that fell on that backend's points.
+type hashRing struct {
+	points   []uint32
+	backends map[uint32]int
+}
+
+func newHashRing(backends []*backend) *hashRing {
+	ring := &hashRing{backends: make(map[uint32]int)}
+	for n, b := range backends {
+		for i := 0; i < virtualNodes; i++ {
+			point := hashKey(b.target + "#" + strconv.Itoa(i))
+			ring.points = append(ring.points, point)
+			ring.backends[point] = n
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// get returns the index of the backend owning key.
+func (h *hashRing) get(key string) int {
+	point := hashKey(key)
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= point })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.backends[h.points[i]]
+}
+
+// hashKey is FNV-1a followed by murmur3's finalizer: FNV alone barely moves keys
+// that differ in their last byte, like user-1 and user-2, so they would bunch up
+// on the ring instead of spreading across backends.
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
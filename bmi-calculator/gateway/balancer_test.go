@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newStubPool starts n backends that answer with their index and pools them
+// under strategy.
+func newStubPool(t *testing.T, n int, strategy, stickyKey string, outliers *outlierConfig) *backendPool {
+	t.Helper()
+	targets := make([]string, n)
+	for i := range targets {
+		i := i
+		u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, i)
+		})
+		targets[i] = u.String()
+	}
+	pool, err := newBackendPool("test", strings.Join(targets, ","), "", newTransport(), strategy, stickyKey, outliers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// served sends r through pool and returns which backend answered.
+func served(t *testing.T, pool *backendPool, r *http.Request) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestStickyRouting(t *testing.T) {
+	pool := newStubPool(t, 3, "consistent-hash", "X-User", nil)
+
+	request := func(user string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", user)
+		return r
+	}
+	owners := map[string]bool{}
+	for u := 0; u < 30; u++ {
+		user := fmt.Sprintf("user-%d", u)
+		first := served(t, pool, request(user))
+		for i := 0; i < 5; i++ {
+			if got := served(t, pool, request(user)); got != first {
+				t.Fatalf("%s went to backend %s, then %s", user, first, got)
+			}
+		}
+		owners[first] = true
+	}
+	if len(owners) < 2 {
+		t.Errorf("30 users all hashed to backends %v, want them spread", owners)
+	}
+}
+
+func TestHashRingRemapsOnlyTheRemovedBackend(t *testing.T) {
+	backends := []*backend{{target: "http://a"}, {target: "http://b"}, {target: "http://c"}}
+	full := newHashRing(backends)
+	without := newHashRing(backends[:2])
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if owner := full.get(key); owner != 2 && without.get(key) != owner {
+			t.Fatalf("%s moved from backend %d though it wasn't removed", key, owner)
+		}
+	}
+}
+
+func TestMustBackendPool(t *testing.T) {
+	defer func(old func(string, ...interface{})) { fatalf = old }(fatalf)
+	var fatal string
+	fatalf = func(format string, args ...interface{}) { fatal = fmt.Sprintf(format, args...) }
+
+	tests := []struct {
+		targets string
+		wantErr bool
+	}{
+		{"http://bmi-service:8081", false},
+		{"http://bmi-1:8081, https://bmi-2:8443", false},
+		{"bmi-service:8081", true},
+		{"ftp://bmi-service", true},
+		{"http://", true},
+		{"http://bmi-1:8081,http://bmi 2:8081", true},
+		{" , ", true},
+	}
+	for _, tt := range tests {
+		fatal = ""
+		pool := mustBackendPool("BMI_SERVICE_URL", "bmi-service", tt.targets, "", newTransport(), "round-robin", "", nil)
+		if !tt.wantErr {
+			if fatal != "" || pool == nil {
+				t.Errorf("%q: refused to start with %q, want a pool", tt.targets, fatal)
+			}
+			continue
+		}
+		if pool != nil || !strings.HasPrefix(fatal, "Invalid BMI_SERVICE_URL: ") {
+			t.Errorf("%q: fatal %q, want the gateway to refuse to start naming BMI_SERVICE_URL", tt.targets, fatal)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"bmi-calculator/deadline"
+	"bmi-calculator/respond"
+)
+
+// budgetMiddleware turns a client's X-Timeout-Ms into a deadline on the request
+// context, clamped to max. The upstream call is cancelled when it passes, and the
+// proxy forwards what is left of it so backends can stop early too.
+func budgetMiddleware(max time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget, ok, err := deadline.FromRequest(r, max)
+		if err != nil {
+			respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBudgetTimesOutSlowBackend(t *testing.T) {
+	received := make(chan string, 1)
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Timeout-Ms")
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	h := budgetMiddleware(time.Second, createReverseProxy(target, "", newTransport()))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/bmi/calculate", nil)
+	r.Header.Set("X-Timeout-Ms", "50")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("answered after %s, want soon after the 50ms budget", elapsed)
+	}
+	if ms, err := strconv.Atoi(<-received); err != nil || ms <= 0 || ms > 50 {
+		t.Errorf("backend got X-Timeout-Ms %d, %v, want what is left of the 50ms", ms, err)
+	}
+}
+
+func TestBudgetHeader(t *testing.T) {
+	var remaining time.Duration
+	h := budgetMiddleware(100*time.Millisecond, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if when, ok := r.Context().Deadline(); ok {
+			remaining = time.Until(when)
+		}
+	}))
+
+	tests := []struct {
+		header string
+		status int
+		max    time.Duration // of the deadline left, 0 for none
+	}{
+		{"", http.StatusOK, 0},
+		{"30", http.StatusOK, 30 * time.Millisecond},
+		{"999999", http.StatusOK, 100 * time.Millisecond},
+		{"-5", http.StatusBadRequest, 0},
+		{"fast", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		remaining = 0
+		r := httptest.NewRequest(http.MethodGet, "/api/bmi/calculate", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Timeout-Ms", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.status {
+			t.Errorf("X-Timeout-Ms %q: status %d, want %d", tt.header, rec.Code, tt.status)
+		}
+		if tt.max == 0 && remaining != 0 || tt.max != 0 && (remaining <= 0 || remaining > tt.max) {
+			t.Errorf("X-Timeout-Ms %q: %s left on the deadline, want up to %s", tt.header, remaining, tt.max)
+		}
+	}
+}
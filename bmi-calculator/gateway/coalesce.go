@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"middleware"
+)
+
+// maxMicrocacheEntries bounds the micro-cache; once full, new responses are only
+// cached after expired entries have been purged.
+const maxMicrocacheEntries = 1000
+
+// coalescedRoutes are the /api routes, with everything below them, whose GETs
+// only read and so may be answered for many clients by one upstream call. GET
+// /api/bmi/bmi/{weight}/{height} is left out on purpose: it stores a calculation
+// every time it is called.
+var coalescedRoutes = []string{
+	"/api/fanout",
+	"/api/versions",
+	"/api/metrics/summary",
+	"/api/health",
+	"/api/bmi/health",
+	"/api/bmi/bmi/percentile",
+	"/api/bmi/target-weight",
+	"/api/bmi/recommendations",
+	"/api/bmi/history",
+}
+
+func coalescedRoute(path string) bool {
+	for _, route := range coalescedRoutes {
+		if path == route || strings.HasPrefix(path, route+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// capturedResponse is an upstream answer recorded once and replayed to every
+// request that shares it.
+type capturedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	// vary holds the leader's values of the headers named by the response's Vary
+	vary map[string]string
+}
+
+// shareable reports whether a response may be handed to other clients: a 200
+// that sets no cookies and that its backend explicitly marked cacheable, with
+// Cache-Control: public or a positive max-age, and not Vary: *.
+func (c *capturedResponse) shareable() bool {
+	if c.status != http.StatusOK || c.header.Get("Set-Cookie") != "" || c.vary == nil {
+		return false
+	}
+	_, ok := sharedMaxAge(c.header)
+	return ok
+}
+
+// sharedMaxAge reads how long a shared cache may keep a response from its
+// Cache-Control, s-maxage before max-age; zero means public without a lifetime.
+// ok is false unless the response is explicitly cacheable by shared caches.
+func sharedMaxAge(header http.Header) (maxAge time.Duration, ok bool) {
+	public, age, sAge := false, -1, -1
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch name {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "public":
+			public = true
+		case "max-age", "s-maxage":
+			n, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				return 0, false
+			}
+			if name == "max-age" {
+				age = n
+			} else {
+				sAge = n
+			}
+		}
+	}
+	if sAge >= 0 {
+		age = sAge
+	}
+	switch {
+	case age > 0:
+		return time.Duration(age) * time.Second, true
+	case age == 0:
+		return 0, false
+	default:
+		return 0, public
+	}
+}
+
+// varyValues records r's values of the headers resp varies on; nil means the
+// response varies on everything and can't be shared.
+func varyValues(header http.Header, r *http.Request) map[string]string {
+	values := make(map[string]string)
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				values[name] = strings.Join(r.Header.Values(name), ",")
+			}
+		}
+	}
+	return values
+}
+
+// matches reports whether r agrees with the leader on every header the response
+// varies on, so the response would have been the same for it.
+func (c *capturedResponse) matches(r *http.Request) bool {
+	for name, value := range c.vary {
+		if strings.Join(r.Header.Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *capturedResponse) replay(w http.ResponseWriter, source string) {
+	for name, values := range c.header {
+		// The follower keeps its own request ID rather than the leader's
+		if name == http.CanonicalHeaderKey(middleware.RequestIDHeader) {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Gateway-Cache", source)
+	w.WriteHeader(c.status)
+	w.Write(c.body)
+}
+
+type flight struct {
+	done chan struct{}
+	once sync.Once
+	resp *capturedResponse
+}
+
+type cacheEntry struct {
+	resp    *capturedResponse
+	expires time.Time
+}
+
+// coalescer collapses concurrent identical GET and HEAD requests to the
+// coalescedRoutes into a single upstream call and, with a TTL, keeps the answer
+// for that long, or for its max-age when shorter, so hot read paths are served
+// without reaching the backends at all. Only responses the backend marked
+// cacheable are shared; requests that get anything else go upstream themselves.
+type coalescer struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]*flight
+	cache    map[string]cacheEntry
+}
+
+func newCoalescer(ttl time.Duration) *coalescer {
+	log.Printf("Coalescing identical GET requests (micro-cache TTL: %s)", ttl)
+	return &coalescer{
+		ttl:      ttl,
+		inFlight: make(map[string]*flight),
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+func (c *coalescer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Credentialed requests may get per-user answers, so they always go upstream
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !coalescedRoute(r.URL.Path) ||
+			r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Conditional requests are keyed apart, so a 200 is never replayed to a
+		// client that would have got a 304 or the other way round
+		key := strings.Join([]string{r.Method, r.URL.RequestURI(), r.Header.Get("X-Client-CN"),
+			r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")}, "\n")
+
+		c.mu.Lock()
+		if entry, ok := c.cache[key]; ok && time.Now().Before(entry.expires) && entry.resp.matches(r) {
+			c.mu.Unlock()
+			entry.resp.replay(w, "HIT")
+			return
+		}
+		if f, ok := c.inFlight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-f.done:
+			case <-r.Context().Done():
+				return
+			}
+			if f.resp.shareable() && f.resp.matches(r) {
+				f.resp.replay(w, "COALESCED")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		f := &flight{done: make(chan struct{})}
+		c.inFlight[key] = f
+		c.mu.Unlock()
+
+		// finish hands resp to the waiting requests; a streamed response releases
+		// them as soon as its headers are known, since it won't end any time soon
+		finish := func(resp *capturedResponse) {
+			f.once.Do(func() {
+				if resp.header != nil {
+					resp.vary = varyValues(resp.header, r)
+				}
+				f.resp = resp
+				c.mu.Lock()
+				delete(c.inFlight, key)
+				if c.ttl > 0 && resp.shareable() {
+					c.storeLocked(key, resp)
+				}
+				c.mu.Unlock()
+				close(f.done)
+			})
+		}
+
+		rec := &captureWriter{ResponseWriter: w, resp: &capturedResponse{header: make(http.Header)}}
+		rec.onStream = func() { finish(&capturedResponse{}) }
+		next.ServeHTTP(rec, r)
+		if rec.resp.status == 0 {
+			rec.resp.status = http.StatusOK
+		}
+		finish(rec.resp)
+	})
+}
+
+func (c *coalescer) storeLocked(key string, resp *capturedResponse) {
+	ttl := c.ttl
+	if maxAge, _ := sharedMaxAge(resp.header); maxAge > 0 && maxAge < ttl {
+		ttl = maxAge
+	}
+	now := time.Now()
+	if len(c.cache) >= maxMicrocacheEntries {
+		for k, entry := range c.cache {
+			if now.After(entry.expires) {
+				delete(c.cache, k)
+			}
+		}
+	}
+	if len(c.cache) < maxMicrocacheEntries {
+		c.cache[key] = cacheEntry{resp: resp, expires: now.Add(ttl)}
+	}
+}
+
+// captureWriter passes the leader's response through to its own client while
+// keeping a copy for the requests waiting on it.
+type captureWriter struct {
+	http.ResponseWriter
+	resp        *capturedResponse
+	onStream    func()
+	wroteHeader bool
+	streaming   bool
+	body        bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.resp.status = status
+		w.resp.header = w.Header().Clone()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			w.streaming = true
+			w.resp.status = 0
+			w.onStream()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.streaming {
+		w.body.Write(b)
+		w.resp.body = w.body.Bytes()
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
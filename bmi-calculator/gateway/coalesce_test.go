@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBackend answers every request after delay with cacheControl set, and
+// counts how many requests reached it.
+func countingBackend(calls *atomic.Int64, delay time.Duration, cacheControl string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(delay)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(`{"ok":true}`))
+	})
+}
+
+// fireConcurrently sends n identical GETs for target through h at once and
+// returns how many were answered 200.
+func fireConcurrently(h http.Handler, n int, target string) int64 {
+	var ok atomic.Int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code == http.StatusOK {
+				ok.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return ok.Load()
+}
+
+func TestCoalescerCollapsesConcurrentGETs(t *testing.T) {
+	const n = 50
+	var calls atomic.Int64
+	h := newCoalescer(0).Middleware(countingBackend(&calls, 200*time.Millisecond, "public, max-age=60"))
+
+	if ok := fireConcurrently(h, n, "/api/bmi/target-weight?height=1.75&bmi=22"); ok != n {
+		t.Fatalf("%d of %d requests answered 200", ok, n)
+	}
+	if got := calls.Load(); got > n/10 {
+		t.Errorf("backend saw %d of %d concurrent identical GETs, want far fewer", got, n)
+	}
+}
+
+func TestCoalescerOnlySharesCacheableReads(t *testing.T) {
+	const n = 20
+	tests := []struct {
+		name         string
+		target       string
+		cacheControl string
+	}{
+		{"no cache-control", "/api/bmi/target-weight?height=1.75&bmi=22", ""},
+		{"max-age=0", "/api/bmi/target-weight?height=1.75&bmi=22", "public, max-age=0"},
+		{"private", "/api/bmi/target-weight?height=1.75&bmi=22", "private, max-age=60"},
+		{"side-effecting route", "/api/bmi/bmi/70/1.75", "public, max-age=60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			h := newCoalescer(0).Middleware(countingBackend(&calls, 50*time.Millisecond, tt.cacheControl))
+			fireConcurrently(h, n, tt.target)
+			if got := calls.Load(); got != n {
+				t.Errorf("backend saw %d of %d requests, want all of them", got, n)
+			}
+		})
+	}
+}
+
+func TestMicrocacheHonoursVaryAndConditionals(t *testing.T) {
+	var calls atomic.Int64
+	h := newCoalescer(time.Minute).Middleware(countingBackend(&calls, 0, "public, max-age=60"))
+
+	get := func(headers map[string]string) string {
+		r := httptest.NewRequest(http.MethodGet, "/api/bmi/recommendations?weight=70&height=1.75", nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Header().Get("X-Gateway-Cache")
+	}
+
+	if got := get(map[string]string{"Accept-Language": "en"}); got != "" {
+		t.Errorf("first request X-Gateway-Cache = %q, want a miss", got)
+	}
+	if got := get(map[string]string{"Accept-Language": "en"}); got != "HIT" {
+		t.Errorf("repeat request X-Gateway-Cache = %q, want HIT", got)
+	}
+	if got := get(map[string]string{"Accept-Language": "pt-BR"}); got != "" {
+		t.Errorf("request with another Accept-Language X-Gateway-Cache = %q, want a miss", got)
+	}
+	if got := get(map[string]string{"Accept-Language": "pt-BR", "If-None-Match": `"abc"`}); got != "" {
+		t.Errorf("conditional request X-Gateway-Cache = %q, want a miss", got)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("backend saw %d requests, want 3", got)
+	}
+}
+
+func TestSharedMaxAge(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+		ok           bool
+	}{
+		{"", 0, false},
+		{"public", 0, true},
+		{"max-age=30", 30 * time.Second, true},
+		{"public, max-age=60, s-maxage=5", 5 * time.Second, true},
+		{"public, max-age=0", 0, false},
+		{"public, no-cache", 0, false},
+		{"max-age=60, private", 0, false},
+		{"max-age=soon", 0, false},
+	}
+	for _, tt := range tests {
+		header := http.Header{"Cache-Control": {tt.cacheControl}}
+		got, ok := sharedMaxAge(header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("sharedMaxAge(%q) = %v, %t, want %v, %t", tt.cacheControl, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// bodyLogger logs request and response bodies for troubleshooting. Bodies are
+// captured as they stream through, so the proxied request is never consumed
+// early, and at most max bytes of each are kept.
+type bodyLogger struct {
+	max    int
+	redact []*regexp.Regexp
+}
+
+func newBodyLogger(max int, redactFields string) *bodyLogger {
+	bl := &bodyLogger{max: max}
+	for _, field := range strings.Split(redactFields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		// Matches "field": "value" or "field": 123 so truncated JSON is redacted too
+		bl.redact = append(bl.redact, regexp.MustCompile(`("(?i:`+regexp.QuoteMeta(field)+`)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\s]+)`))
+	}
+	log.Printf("Debug body logging enabled (max %d bytes, redacting %q)", max, redactFields)
+	return bl
+}
+
+func (bl *bodyLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody := &cappedBuffer{max: bl.max}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, reqBody), r.Body}
+		}
+
+		rec := &bodyRecorder{ResponseWriter: w, body: &cappedBuffer{max: bl.max}}
+		next.ServeHTTP(rec, r)
+
+		log.Printf("Request body: %s %s: %s", r.Method, r.URL.Path, bl.format(reqBody))
+		log.Printf("Response body: %s %s (%d): %s", r.Method, r.URL.Path, rec.status, bl.format(rec.body))
+	})
+}
+
+func (bl *bodyLogger) format(b *cappedBuffer) string {
+	out := b.buf.String()
+	for _, re := range bl.redact {
+		out = re.ReplaceAllString(out, `${1}"[REDACTED]"`)
+	}
+	if b.truncated {
+		out += "...(truncated)"
+	}
+	return out
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.max - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+			c.truncated = true
+		} else {
+			c.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		c.truncated = true
+	}
+	return len(p), nil
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	body   *cappedBuffer
+	status int
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *bodyRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *bodyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
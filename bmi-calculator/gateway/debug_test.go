@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodyLogger(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	bl := newBodyLogger(16, "password")
+	var upstream string
+	h := bl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		upstream = string(b)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+	}))
+
+	tests := []struct {
+		name   string
+		body   string
+		logged string
+	}{
+		{"under the cap", `{"weight":70}`, `{"weight":70}`},
+		{"truncated", `{"weight":70,"height":1.75}`, `{"weight":70,"he...(truncated)`},
+		{"redacted", `{"password":"x"}`, `{"password":"[REDACTED]"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(tt.body)))
+
+			if upstream != tt.body || rec.Body.String() != tt.body {
+				t.Errorf("upstream read %q and the client got %q, want the whole body %q both ways", upstream, rec.Body, tt.body)
+			}
+			for _, want := range []string{
+				"Request body: POST /api/calculate: " + tt.logged + "\n",
+				"Response body: POST /api/calculate (201): " + tt.logged + "\n",
+			} {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log = %q, want it to contain %q", logs.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"bmi-calculator/deadline"
+	"bmi-calculator/respond"
+
+	"middleware"
+)
+
+// propagatedHeaders are copied from the incoming request onto every fan-out call
+// so request IDs and W3C trace context follow the request downstream.
+var propagatedHeaders = []string{"X-Request-ID", "traceparent", "tracestate"}
+
+type fanoutCall struct {
+	name string
+	pool *backendPool
+	path string
+}
+
+type fanoutResult struct {
+	URL       string          `json:"url"`
+	Status    int             `json:"status,omitempty"`
+	LatencyMS int64           `json:"latency_ms"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// fanoutHandler calls every backend concurrently under one deadline and merges
+// their answers, so a single slow backend bounds, rather than stalls, the response.
+// It answers 502 when any call failed, still including the calls that succeeded.
+func fanoutHandler(client *http.Client, timeout time.Duration, calls []fanoutCall) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		results := make(map[string]fanoutResult, len(calls))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, call := range calls {
+			call := call
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				callStart := time.Now()
+				result := fetch(ctx, client, call.pool.pick(r).url(call.path), r.Header)
+				result.LatencyMS = time.Since(callStart).Milliseconds()
+				mu.Lock()
+				results[call.name] = result
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, result := range results {
+			if result.Error != "" {
+				status = http.StatusBadGateway
+			}
+		}
+
+		respond.JSON(w, r, status, map[string]interface{}{
+			"request_id":       middleware.RequestIDFrom(r),
+			"results":          results,
+			"total_latency_ms": time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+func fetch(ctx context.Context, client *http.Client, url string, incoming http.Header) fanoutResult {
+	result := fanoutResult{URL: url}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, name := range propagatedHeaders {
+		if value := incoming.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	deadline.Propagate(ctx, req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case resp.StatusCode >= 400:
+		result.Error = fmt.Sprintf("backend returned %d", resp.StatusCode)
+	}
+	if json.Valid(body) {
+		result.Body = body
+	}
+	return result
+}
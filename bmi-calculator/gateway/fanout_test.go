@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// poolFor pools a single backend served by handler.
+func poolFor(t *testing.T, handler http.HandlerFunc) *backendPool {
+	t.Helper()
+	u, _ := newBackend(t, handler)
+	pool, err := newBackendPool("test", u.String(), "", newTransport(), "round-robin", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestFanoutMergesBackends(t *testing.T) {
+	seen := make(chan http.Header, 2)
+	answer := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			seen <- r.Header.Clone()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}
+	}
+	calls := []fanoutCall{
+		{name: "bmi-service", pool: poolFor(t, answer(`{"status":"healthy"}`)), path: "/health"},
+		{name: "health-service", pool: poolFor(t, answer(`{"overall":"healthy"}`)), path: "/health/services"},
+	}
+	h := fanoutHandler(&http.Client{}, time.Second, calls)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	r := httptest.NewRequest(http.MethodGet, "/api/fanout", nil)
+	r.Header.Set("X-Request-ID", "req-42")
+	r.Header.Set("traceparent", traceparent)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Results map[string]struct {
+			Status int             `json:"status"`
+			Body   json.RawMessage `json:"body"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"bmi-service": `{"status":"healthy"}`, "health-service": `{"overall":"healthy"}`} {
+		if result := got.Results[name]; result.Status != http.StatusOK || string(result.Body) != want {
+			t.Errorf("%s = %d %s, want 200 %s", name, result.Status, result.Body, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if h := <-seen; h.Get("X-Request-ID") != "req-42" || h.Get("traceparent") != traceparent {
+			t.Errorf("backend got X-Request-ID %q and traceparent %q, want them propagated", h.Get("X-Request-ID"), h.Get("traceparent"))
+		}
+	}
+}
+
+func TestFanoutDeadlineBoundsSlowBackend(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	calls := []fanoutCall{
+		{name: "fast", pool: poolFor(t, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) }), path: "/health"},
+		{name: "slow", pool: poolFor(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}), path: "/health"},
+	}
+	h := fanoutHandler(&http.Client{}, 50*time.Millisecond, calls)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/fanout", nil))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("fan-out took %v, want the 50ms deadline to cut the slow call short", elapsed)
+	}
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d with a timed-out call, want 502", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// securityHeaders holds the response headers added when SECURITY_HEADERS=true.
+// Each default can be overridden through its SECURITY_HEADER_* variable, or
+// dropped by setting that variable to "off".
+type securityHeaders struct {
+	headers map[string]string
+	hsts    string
+}
+
+func newSecurityHeaders() *securityHeaders {
+	sh := &securityHeaders{headers: make(map[string]string)}
+	defaults := []struct{ name, env, value string }{
+		{"X-Content-Type-Options", "SECURITY_HEADER_X_CONTENT_TYPE_OPTIONS", "nosniff"},
+		{"X-Frame-Options", "SECURITY_HEADER_X_FRAME_OPTIONS", "DENY"},
+		{"Referrer-Policy", "SECURITY_HEADER_REFERRER_POLICY", "strict-origin-when-cross-origin"},
+	}
+	for _, h := range defaults {
+		if value := getEnv(h.env, h.value); value != "off" {
+			sh.headers[h.name] = value
+		}
+	}
+	if value := getEnv("SECURITY_HEADER_HSTS", "max-age=31536000; includeSubDomains"); value != "off" {
+		sh.hsts = value
+	}
+
+	log.Printf("Security headers enabled: %v (HSTS over TLS: %q)", sh.headers, sh.hsts)
+	return sh
+}
+
+func (sh *securityHeaders) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&securityHeadersWriter{ResponseWriter: w, sh: sh, tls: r.TLS != nil}, r)
+	})
+}
+
+// securityHeadersWriter adds the headers just before the status line goes out, so
+// anything a backend already set wins instead of being duplicated.
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	sh          *securityHeaders
+	tls         bool
+	wroteHeader bool
+}
+
+func (w *securityHeadersWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		for name, value := range w.sh.headers {
+			if h.Get(name) == "" {
+				h.Set(name, value)
+			}
+		}
+		if w.tls && w.sh.hsts != "" && h.Get("Strict-Transport-Security") == "" {
+			h.Set("Strict-Transport-Security", w.sh.hsts)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *securityHeadersWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *securityHeadersWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
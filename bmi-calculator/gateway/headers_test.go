@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		// A backend that needs to be framed by its own pages keeps its choice
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.Write([]byte("ok"))
+	})
+	sh := newSecurityHeaders()
+	proxied := sh.Middleware(createReverseProxy(target, "", newTransport()))
+	local := sh.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		tls     bool
+		want    map[string]string
+	}{
+		{"local", local, false, map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+			"Strict-Transport-Security": "",
+		}},
+		{"local over TLS", local, true, map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		}},
+		{"proxied", proxied, false, map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "SAMEORIGIN",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			for name, want := range tt.want {
+				if got := rec.Header().Values(name); len(got) > 1 || rec.Header().Get(name) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
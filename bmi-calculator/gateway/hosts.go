@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+// hostAllowlist rejects requests whose Host header isn't listed, guarding against
+// host-header attacks and cache poisoning. Entries are exact host names or
+// "*.example.com", which matches any subdomain of example.com but not the apex.
+type hostAllowlist struct {
+	exact    map[string]bool
+	suffixes []string
+}
+
+// probePaths skip the check: kubelet and Prometheus address pods by IP.
+var probePaths = map[string]bool{"/health": true, "/ready": true, "/metrics": true}
+
+func newHostAllowlist(spec string) *hostAllowlist {
+	hl := &hostAllowlist{exact: make(map[string]bool)}
+	for _, host := range strings.Split(spec, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		switch {
+		case host == "":
+		case strings.HasPrefix(host, "*."):
+			hl.suffixes = append(hl.suffixes, host[1:])
+		default:
+			hl.exact[host] = true
+		}
+	}
+	log.Printf("Allowed hosts: %s", spec)
+	return hl
+}
+
+func (hl *hostAllowlist) allowed(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if hl.exact[host] {
+		return true
+	}
+	for _, suffix := range hl.suffixes {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hl *hostAllowlist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !probePaths[r.URL.Path] && !hl.allowed(r.Host) {
+			log.Printf("Rejected: %s %s for host %q from %s", r.Method, r.URL.Path, r.Host, clientIPs.FromRequest(r))
+			respond.Error(w, r, http.StatusBadRequest, "host_not_allowed", "host not allowed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
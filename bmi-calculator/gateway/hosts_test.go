@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostAllowlist(t *testing.T) {
+	h := newHostAllowlist("bmi.example.com, *.demo.local").Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	tests := []struct {
+		host, path string
+		want       int
+	}{
+		{"bmi.example.com", "/api/calculate", http.StatusOK},
+		{"BMI.example.com:8080", "/api/calculate", http.StatusOK},
+		{"bmi.example.com.", "/api/calculate", http.StatusOK},
+		{"evil.example.com", "/api/calculate", http.StatusBadRequest},
+		{"canary.demo.local", "/api/calculate", http.StatusOK},
+		{"a.b.demo.local", "/api/calculate", http.StatusOK},
+		{"demo.local", "/api/calculate", http.StatusBadRequest},
+		{"notdemo.local", "/api/calculate", http.StatusBadRequest},
+		{"10.0.0.7:8080", "/health", http.StatusOK},
+		{"10.0.0.7:8080", "/metrics", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Host = tt.host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("Host %q %s = %d, want %d", tt.host, tt.path, rec.Code, tt.want)
+		}
+	}
+}
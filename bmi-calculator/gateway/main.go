@@ -1,18 +1,51 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
+	"strconv"
 	"time"
 
+	"bmi-calculator/clientip"
+	"bmi-calculator/identity"
+	"bmi-calculator/listen"
+	"bmi-calculator/logging"
+	"bmi-calculator/profiling"
+	"bmi-calculator/respond"
+
+	"config"
+	"middleware"
+
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	clientIPs = clientip.Resolver{TrustProxyHeaders: getEnv("TRUST_PROXY_HEADERS", "false") == "true"}
+
+	inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	})
 )
 
 func main() {
+	if err := logging.Setup(getEnv("LOG_FILE", ""), getEnvInt("LOG_MAX_SIZE_MB", 100), getEnvInt("LOG_MAX_BACKUPS", 3), getEnv("LOG_CONSOLE", "true") == "true"); err != nil {
+		log.Fatalf("Invalid LOG_FILE: %v", err)
+	}
+	profiling.Start(getEnv("ENABLE_PPROF", "false") == "true", getEnv("ADMIN_PORT", "6060"))
+	respond.Pretty = getEnv("PRETTY_JSON", "false") == "true"
+
+	trusted, err := clientip.ParseCIDRs(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	clientIPs.TrustedProxies = trusted
+
 	r := mux.NewRouter()
 
 	bmiServiceURL := getEnv("BMI_SERVICE_URL", "http://bmi-service:8081")
@@ -21,45 +54,257 @@ func main() {
 	log.Printf("BMI Service URL: %s", bmiServiceURL)
 	log.Printf("Health Service URL: %s", healthServiceURL)
 
-	bmiProxy := createReverseProxy(bmiServiceURL)
-	healthProxy := createReverseProxy(healthServiceURL)
+	transport := newTransport()
+	stickyKey := getEnv("STICKY_KEY", "")
+	// STICKY_KEY on its own keeps meaning consistent hashing, as before LB_STRATEGY
+	defaultStrategy := "round-robin"
+	if stickyKey != "" {
+		defaultStrategy = "consistent-hash"
+	}
+	strategy := getEnv("LB_STRATEGY", defaultStrategy)
+	if err := checkStrategy(strategy, stickyKey); err != nil {
+		log.Fatalf("Invalid LB_STRATEGY: %v", err)
+	}
+	if stickyKey != "" && strategy != "consistent-hash" {
+		log.Printf("Warning: STICKY_KEY is only used by LB_STRATEGY=consistent-hash, ignoring it for %s", strategy)
+	}
+	var outliers *outlierConfig
+	if threshold := getEnvFloat("OUTLIER_THRESHOLD", 0); threshold > 0 {
+		outliers = &outlierConfig{
+			threshold:   threshold,
+			window:      getEnvDuration("OUTLIER_WINDOW", 30*time.Second),
+			cooldown:    getEnvDuration("OUTLIER_COOLDOWN", 30*time.Second),
+			minRequests: max(getEnvInt("OUTLIER_MIN_REQUESTS", 5), 1),
+			slowStart:   getEnvDuration("SLOW_START_WINDOW", 0),
+		}
+		log.Printf("Outlier detection: eject above %.0f%% errors over %s for %s", threshold*100, outliers.window, outliers.cooldown)
+	}
+	bmiBasePath, err := parseBasePath(getEnv("BMI_BASE_PATH", ""))
+	if err != nil {
+		log.Fatalf("Invalid BMI_BASE_PATH: %v", err)
+	}
+	healthBasePath, err := parseBasePath(getEnv("HEALTH_BASE_PATH", ""))
+	if err != nil {
+		log.Fatalf("Invalid HEALTH_BASE_PATH: %v", err)
+	}
 
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":        "healthy",
-			"service":       "gateway",
-			"image_version": getEnv("IMAGE_VERSION", "unknown"),
-		})
-	}).Methods("GET")
+	bmiProxy := mustBackendPool("BMI_SERVICE_URL", "bmi-service", bmiServiceURL, bmiBasePath, transport, strategy, stickyKey, outliers)
+	healthProxy := mustBackendPool("HEALTH_SERVICE_URL", "health-service", healthServiceURL, healthBasePath, transport, strategy, stickyKey, outliers)
 
-	r.PathPrefix("/api/health").Handler(loggingMiddleware(http.StripPrefix("/api", healthProxy)))
+	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.HandleFunc("/ready", readyHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.Handle("/config", config.Handler(respond.JSON)).Methods("GET")
+	r.Handle("/whoami", identity.Handler("gateway")).Methods("GET")
+	r.Handle("/version", identity.VersionHandler("gateway", getEnv("IMAGE_VERSION", "unknown"))).Methods("GET")
+	r.HandleFunc("/admin/maintenance", requireAdmin(maintenanceHandler)).Methods("GET", "POST")
 
-	r.PathPrefix("/api/bmi").Handler(loggingMiddleware(http.StripPrefix("/api/bmi", bmiProxy)))
+	var bodies *bodyLogger
+	if getEnv("DEBUG_BODIES", "false") == "true" {
+		bodies = newBodyLogger(getEnvInt("DEBUG_BODY_MAX", 1024), getEnv("DEBUG_REDACT_FIELDS", "password,token,secret"))
+	}
 
-	port := getEnv("PORT", "8080")
-	log.Printf("Gateway starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
-}
+	var coalesce *coalescer
+	if ttl := getEnvDuration("MICROCACHE_TTL", 0); ttl > 0 || getEnv("COALESCE_GETS", "false") == "true" {
+		coalesce = newCoalescer(ttl)
+	}
+
+	maxBudget := getEnvDuration("MAX_REQUEST_TIMEOUT", 30*time.Second)
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-		log.Printf("Completed: %s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	// api wraps every proxied /api route with the same middleware
+	api := func(h http.Handler) http.Handler {
+		if coalesce != nil {
+			h = coalesce.Middleware(h)
+		}
+		h = budgetMiddleware(maxBudget, h)
+		h = clientCNMiddleware(h)
+		if bodies != nil {
+			h = bodies.Middleware(h)
+		}
+		return maintenanceMiddleware(h)
+	}
+
+	fanout := fanoutHandler(&http.Client{Transport: transport}, getEnvDuration("FANOUT_TIMEOUT", 2*time.Second), []fanoutCall{
+		{name: "bmi-service", pool: bmiProxy, path: "/health"},
+		{name: "health-service", pool: healthProxy, path: "/health/services"},
 	})
+	r.Handle("/api/fanout", api(fanout)).Methods("GET")
+
+	versions := versionsHandler(&http.Client{Transport: transport}, identity.NewVersion("gateway", getEnv("IMAGE_VERSION", "unknown")),
+		[]*backendPool{bmiProxy, healthProxy}, max(getEnvInt("VERSIONS_CONCURRENCY", 4), 1), getEnvDuration("VERSIONS_TIMEOUT", 2*time.Second))
+	r.Handle("/api/versions", api(versions)).Methods("GET")
+
+	summary := metricsSummaryHandler(&http.Client{Transport: transport}, []*backendPool{bmiProxy, healthProxy},
+		parseMetricNames(getEnv("SUMMARY_METRICS", "http_requests_total,http_requests_in_flight,go_goroutines,process_resident_memory_bytes")),
+		getEnvDuration("SUMMARY_TIMEOUT", 2*time.Second))
+	r.Handle("/api/metrics/summary", api(summary)).Methods("GET")
+
+	// Registered before the /api/health and /api/bmi prefixes, which would also match
+	// /api/health-service/... and /api/bmi-service/...
+	r.Handle("/api/{service}/metrics", api(backendMetricsHandler(map[string]*backendPool{
+		bmiProxy.name:    bmiProxy,
+		"bmi":            bmiProxy,
+		healthProxy.name: healthProxy,
+		"health":         healthProxy,
+	}))).Methods("GET")
+
+	methods := parseMethodAllowlist(getEnv("PROXY_ALLOWED_METHODS", ""))
+	r.PathPrefix("/api/health").Handler(api(methods.Middleware(healthProxy.name, http.StripPrefix("/api", healthProxy))))
+
+	r.PathPrefix("/api/bmi").Handler(api(methods.Middleware(bmiProxy.name, http.StripPrefix("/api/bmi", bmiProxy))))
+
+	if getEnv("PREWARM", "false") == "true" {
+		go prewarm(&http.Client{Transport: transport}, []*backendPool{bmiProxy, healthProxy},
+			max(getEnvInt("PREWARM_CONNS", 4), 1), getEnvDuration("PREWARM_TIMEOUT", 10*time.Second))
+	} else {
+		ready.Store(true)
+	}
+
+	var handler http.Handler = r
+	if hosts := getEnv("ALLOWED_HOSTS", ""); hosts != "" {
+		handler = newHostAllowlist(hosts).Middleware(handler)
+	}
+	rateLimit := getEnvFloat("RATE_LIMIT_RPS", 0)
+	limiter := middleware.NewRateLimiter(rateLimit, getEnvInt("RATE_LIMIT_BURST", 0), clientIPs.FromRequest)
+	if limiter != nil {
+		log.Printf("Rate limiting each client to %g requests/s", rateLimit)
+	}
+	shedder := middleware.NewLoadShedder(getEnvInt("MAX_CONCURRENT", 256), inFlightGauge)
+	handler = middleware.Chain(middleware.Standard(middleware.Stack{
+		ClientIP: clientIPs.FromRequest,
+		Error:    respond.Error,
+		Metrics:  middleware.NewMetrics(prometheus.DefaultRegisterer),
+		Limiter:  limiter,
+		Shedder:  shedder,
+	})...)(handler)
+	if getEnv("SECURITY_HEADERS", "false") == "true" {
+		handler = newSecurityHeaders().Middleware(handler)
+	}
+
+	port := getEnv("PORT", "8080")
+	bindAddr := getEnv("BIND_ADDR", "0.0.0.0")
+	addr, err := listen.Addr(bindAddr, port)
+	if err != nil {
+		log.Fatalf("Invalid listen address: %v", err)
+	}
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Listen on %s: %v", addr, err)
+	}
+	if getEnv("PROXY_PROTOCOL", "false") == "true" {
+		// Any peer could otherwise claim any client address
+		if len(trusted) == 0 {
+			log.Fatalf("PROXY_PROTOCOL requires TRUSTED_PROXIES to name the load balancers allowed to send a header; set it to 0.0.0.0/0,::/0 to really trust every peer")
+		}
+		listener = newProxyProtoListener(listener, trusted, getEnvDuration("PROXY_PROTOCOL_TIMEOUT", 5*time.Second))
+		log.Printf("Reading PROXY protocol headers on %s", addr)
+	}
+
+	certFile, keyFile := getEnv("TLS_CERT_FILE", ""), getEnv("TLS_KEY_FILE", "")
+	if certFile == "" && keyFile == "" {
+		log.Printf("Gateway starting on %s", addr)
+		log.Fatal(server.Serve(listener))
+	}
+
+	tlsConfig, err := newTLSConfig(certFile, keyFile, getEnv("TLS_MIN_VERSION", "1.2"))
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	server.TLSConfig = tlsConfig
+
+	if caFile := getEnv("MTLS_CA_FILE", ""); caFile != "" {
+		if err := requireClientCerts(tlsConfig, caFile); err != nil {
+			log.Fatalf("Invalid mTLS configuration: %v", err)
+		}
+		log.Printf("Requiring client certificates signed by %s", caFile)
+
+		// Kubernetes probes can't present client certificates, so /health and /ready get their own plain listener
+		if healthPort := getEnv("HEALTH_PORT", ""); healthPort != "" {
+			healthAddr, err := listen.Addr(bindAddr, healthPort)
+			if err != nil {
+				log.Fatalf("Invalid HEALTH_PORT: %v", err)
+			}
+			go func() {
+				health := http.NewServeMux()
+				health.HandleFunc("/health", healthHandler)
+				health.HandleFunc("/ready", readyHandler)
+				log.Printf("Health endpoint listening without client certificates on %s", healthAddr)
+				log.Fatal(http.ListenAndServe(healthAddr, health))
+			}()
+		} else {
+			log.Printf("Warning: mTLS enabled without HEALTH_PORT; probes must present a client certificate")
+		}
+	}
+
+	if redirectPort := getEnv("HTTP_REDIRECT_PORT", ""); redirectPort != "" {
+		redirectAddr, err := listen.Addr(bindAddr, redirectPort)
+		if err != nil {
+			log.Fatalf("Invalid HTTP_REDIRECT_PORT: %v", err)
+		}
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", redirectAddr)
+			log.Fatal(http.ListenAndServe(redirectAddr, redirectToHTTPS(port)))
+		}()
+	}
+
+	log.Printf("Gateway starting on %s with TLS", addr)
+	log.Fatal(server.ServeTLS(listener, "", ""))
 }
 
-func createReverseProxy(target string) *httputil.ReverseProxy {
-	targetURL, _ := url.Parse(target)
-	return httputil.NewSingleHostReverseProxy(targetURL)
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, r, http.StatusOK, map[string]string{
+		"status":        "healthy",
+		"service":       "gateway",
+		"image_version": getEnv("IMAGE_VERSION", "unknown"),
+	})
 }
 
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
+		config.Record(key, value)
 		return value
 	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			config.Record(key, n)
+			return n
+		}
+		log.Printf("Invalid %s %q, using default %d", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err == nil && d > 0 {
+			config.Record(key, d)
+			return d
+		}
+		log.Printf("Invalid %s %q, using default %s", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			config.Record(key, f)
+			return f
+		}
+		log.Printf("Invalid %s %q, using default %v", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
 	return defaultValue
 }
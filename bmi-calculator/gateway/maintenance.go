@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"bmi-calculator/respond"
+)
+
+// maintenanceState is what POST /admin/maintenance last set. It lives in memory
+// only, so a restarted gateway always comes back serving traffic.
+type maintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retry_after_seconds,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+const defaultMaintenanceMessage = "the service is down for planned maintenance"
+
+var (
+	adminToken  = getEnv("ADMIN_TOKEN", "")
+	maintenance atomic.Pointer[maintenanceState]
+)
+
+// requireAdmin only lets requests through with ADMIN_TOKEN as a bearer token;
+// without ADMIN_TOKEN the admin endpoints are disabled.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			respond.Error(w, r, http.StatusForbidden, "forbidden", "ADMIN_TOKEN is not configured")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			respond.Error(w, r, http.StatusUnauthorized, "unauthorized", "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// maintenanceHandler turns maintenance mode on or off with ?enabled=true|false,
+// optionally with a ?message= for clients and a ?retry_after= duration sent as
+// Retry-After. GET reports the current state.
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		state, err := parseMaintenance(r)
+		if err != nil {
+			respond.Error(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		maintenance.Store(state)
+		log.Printf("Maintenance mode enabled=%t set from %s", state.Enabled, clientIPs.FromRequest(r))
+	}
+	respond.JSON(w, r, http.StatusOK, currentMaintenance())
+}
+
+func parseMaintenance(r *http.Request) (*maintenanceState, error) {
+	q := r.URL.Query()
+	enabled, err := strconv.ParseBool(q.Get("enabled"))
+	if err != nil {
+		return nil, errors.New("enabled must be true or false")
+	}
+	if !enabled {
+		return &maintenanceState{}, nil
+	}
+
+	state := &maintenanceState{Enabled: true, Message: q.Get("message")}
+	if state.Message == "" {
+		state.Message = defaultMaintenanceMessage
+	}
+	if raw := q.Get("retry_after"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			return nil, errors.New("retry_after must be a duration of at least 1s, e.g. 10m")
+		}
+		state.RetryAfter = int(d.Seconds())
+	}
+	now := time.Now()
+	state.Since = &now
+	return state, nil
+}
+
+func currentMaintenance() maintenanceState {
+	if state := maintenance.Load(); state != nil {
+		return *state
+	}
+	return maintenanceState{}
+}
+
+// maintenanceMiddleware answers 503 while maintenance mode is on, without
+// calling the backends.
+func maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := maintenance.Load()
+		if state == nil || !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if state.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+		}
+		respond.Error(w, r, http.StatusServiceUnavailable, "maintenance", state.Message)
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bmi-calculator/respond"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	defer func(old string) { adminToken = old }(adminToken)
+	defer maintenance.Store(maintenance.Load())
+	adminToken = "secret"
+	maintenance.Store(nil)
+
+	var hits int
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) { hits++ })
+	r := mux.NewRouter()
+	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.HandleFunc("/admin/maintenance", requireAdmin(maintenanceHandler)).Methods("GET", "POST")
+	r.PathPrefix("/api/bmi").Handler(maintenanceMiddleware(createReverseProxy(target, "", newTransport())))
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/admin/maintenance?enabled=true", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("toggle with a wrong token = %d, want 401", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/maintenance?enabled=true&retry_after=10m&message=upgrading", "secret"); rec.Code != http.StatusOK {
+		t.Fatalf("enabling maintenance = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := do(http.MethodGet, "/api/bmi/history", "")
+	var body respond.ErrorBody
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusServiceUnavailable || body.Code != "maintenance" || body.Message != "upgrading" {
+		t.Errorf("/api during maintenance = %d %+v, want 503 with the message", rec.Code, body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "600" {
+		t.Errorf("Retry-After = %q, want 600", got)
+	}
+	if hits != 0 {
+		t.Errorf("backend called %d times during maintenance, want none", hits)
+	}
+	if rec := do(http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("/health during maintenance = %d, want 200", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/admin/maintenance?enabled=false", "secret"); rec.Code != http.StatusOK {
+		t.Fatalf("disabling maintenance = %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/bmi/history", ""); rec.Code != http.StatusOK || hits != 1 {
+		t.Errorf("/api after maintenance = %d with %d backend calls, want 200 reaching it", rec.Code, hits)
+	}
+
+	adminToken = ""
+	if rec := do(http.MethodPost, "/admin/maintenance?enabled=true", "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("toggle without ADMIN_TOKEN = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"bmi-calculator/respond"
+)
+
+// methodAllowlist limits which methods each proxied route passes to its backend,
+// keyed by the backend pool's name. Routes without an entry allow every method.
+type methodAllowlist map[string]map[string]bool
+
+// parseMethodAllowlist reads "route=METHOD,METHOD;route=METHOD", e.g.
+// "bmi-service=GET,POST;health-service=GET".
+func parseMethodAllowlist(spec string) methodAllowlist {
+	allow := make(methodAllowlist)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, methods, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			log.Printf("Ignoring invalid PROXY_ALLOWED_METHODS entry %q, expected route=METHOD,...", entry)
+			continue
+		}
+		allow[route] = make(map[string]bool)
+		for _, m := range strings.Split(methods, ",") {
+			if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+				allow[route][m] = true
+			}
+		}
+		log.Printf("Proxy route %s allows only %s", route, strings.ToUpper(methods))
+	}
+	return allow
+}
+
+// Middleware answers 405 at the edge for methods route doesn't allow, so they never
+// reach the backend.
+func (a methodAllowlist) Middleware(route string, next http.Handler) http.Handler {
+	methods, ok := a[route]
+	if !ok {
+		return next
+	}
+	allowed := make([]string, 0, len(methods))
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	allowHeader := strings.Join(allowed, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !methods[r.Method] {
+			log.Printf("Rejected: %s %s, method not allowed for %s", r.Method, r.URL.Path, route)
+			w.Header().Set("Allow", allowHeader)
+			respond.Error(w, r, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on this route")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
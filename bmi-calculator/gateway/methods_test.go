@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodAllowlist(t *testing.T) {
+	var hits int
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte(r.Method))
+	})
+	proxy := createReverseProxy(target, "", newTransport())
+	allow := parseMethodAllowlist("bmi-service=get, post; =PUT; bogus")
+	bmi := allow.Middleware("bmi-service", proxy)
+	health := allow.Middleware("health-service", proxy)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		status  int
+	}{
+		{"allowed GET", bmi, http.MethodGet, http.StatusOK},
+		{"allowed POST", bmi, http.MethodPost, http.StatusOK},
+		{"disallowed DELETE", bmi, http.MethodDelete, http.StatusMethodNotAllowed},
+		{"route without an entry", health, http.MethodDelete, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits = 0
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/api/bmi/history/1", nil))
+			if rec.Code != tt.status {
+				t.Fatalf("%s = %d, want %d", tt.method, rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.method {
+				t.Errorf("backend saw %q, want %s", rec.Body, tt.method)
+			}
+			if tt.status == http.StatusMethodNotAllowed {
+				if allowHeader := rec.Header().Get("Allow"); allowHeader != "GET, POST" {
+					t.Errorf("Allow = %q, want GET, POST", allowHeader)
+				}
+				if hits != 0 {
+					t.Error("the rejected request reached the backend")
+				}
+			}
+		})
+	}
+	if len(allow) != 1 {
+		t.Errorf("parsed %d routes, want the invalid entries skipped", len(allow))
+	}
+}
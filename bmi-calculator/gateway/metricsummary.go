@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"bmi-calculator/respond"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricSummary is one metric summed over every backend of a service. Errors
+// counts the samples whose status or code label is 5xx, for metrics that have one.
+type metricSummary struct {
+	Value  float64  `json:"value"`
+	Errors *float64 `json:"errors,omitempty"`
+}
+
+type serviceSummary struct {
+	Backends int                       `json:"backends"`
+	Scraped  int                       `json:"scraped"`
+	Metrics  map[string]*metricSummary `json:"metrics"`
+	Errors   []string                  `json:"errors,omitempty"`
+}
+
+// metricsSummaryHandler scrapes /metrics on every backend of pools under one
+// deadline and sums the metrics named in names per service, a quick cluster-wide
+// view without Prometheus. A backend that can't be scraped is listed under the
+// service's errors and left out of the sums; the response is still a 200.
+func metricsSummaryHandler(client *http.Client, pools []*backendPool, names []string, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		services := make(map[string]*serviceSummary, len(pools))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, pool := range pools {
+			summary := &serviceSummary{Backends: len(pool.backends), Metrics: map[string]*metricSummary{}}
+			services[pool.name] = summary
+			for _, b := range pool.backends {
+				b := b
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					families, err := scrapeMetrics(ctx, client, b.url("/metrics"))
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", b.target, err))
+						return
+					}
+					summary.Scraped++
+					for _, name := range names {
+						if family, ok := families[name]; ok {
+							addFamily(summary.Metrics, name, family)
+						}
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		respond.JSON(w, r, http.StatusOK, map[string]interface{}{
+			"services": services,
+		})
+	}
+}
+
+// parseMetricNames reads a comma-separated list of metric names.
+func parseMetricNames(spec string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func scrapeMetrics(ctx context.Context, client *http.Client, url string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Ask for the text format; the parser does not read protobuf or OpenMetrics
+	req.Header.Set("Accept", string(expfmt.FmtText))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics endpoint returned %d", resp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing metrics: %w", err)
+	}
+	return families, nil
+}
+
+// addFamily adds every sample of family to summaries[name]. Histograms and
+// summaries contribute their observation count.
+func addFamily(summaries map[string]*metricSummary, name string, family *dto.MetricFamily) {
+	summary, ok := summaries[name]
+	if !ok {
+		summary = &metricSummary{}
+		summaries[name] = summary
+	}
+	for _, m := range family.GetMetric() {
+		value := sampleValue(m)
+		summary.Value += value
+		for _, label := range m.GetLabel() {
+			if label.GetName() != "status" && label.GetName() != "code" {
+				continue
+			}
+			if summary.Errors == nil {
+				summary.Errors = new(float64)
+			}
+			if strings.HasPrefix(label.GetValue(), "5") {
+				*summary.Errors += value
+			}
+		}
+	}
+}
+
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Untyped != nil:
+		return m.Untyped.GetValue()
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount())
+	case m.Summary != nil:
+		return float64(m.Summary.GetSampleCount())
+	default:
+		return 0
+	}
+}
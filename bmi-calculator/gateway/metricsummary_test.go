@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsSummary(t *testing.T) {
+	metrics := func(body string) string {
+		u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Write([]byte(body))
+		})
+		return u.String()
+	}
+	noMetrics, _ := newBackend(t, http.NotFound)
+
+	bmi, err := newBackendPool("bmi-service", strings.Join([]string{
+		metrics("# TYPE http_requests_total counter\n" +
+			`http_requests_total{status="200"} 10` + "\n" +
+			`http_requests_total{status="503"} 2` + "\n" +
+			"# TYPE unrelated_total counter\nunrelated_total 99\n"),
+		metrics("# TYPE http_requests_total counter\n" +
+			`http_requests_total{status="200"} 5` + "\n" +
+			`http_requests_total{status="500"} 1` + "\n" +
+			"# TYPE request_duration_seconds histogram\n" +
+			`request_duration_seconds_bucket{le="+Inf"} 6` + "\n" +
+			"request_duration_seconds_sum 1.5\nrequest_duration_seconds_count 6\n"),
+	}, ","), "", newTransport(), "round-robin", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	health, err := newBackendPool("health-service", noMetrics.String(), "", newTransport(), "round-robin", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := metricsSummaryHandler(&http.Client{}, []*backendPool{bmi, health},
+		parseMetricNames(" http_requests_total, request_duration_seconds ,"), time.Second)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/summary", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 even with a backend lacking /metrics: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Services map[string]serviceSummary `json:"services"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	s := got.Services["bmi-service"]
+	if s.Backends != 2 || s.Scraped != 2 || len(s.Errors) != 0 {
+		t.Errorf("bmi-service scraped %d of %d backends with errors %v, want both", s.Scraped, s.Backends, s.Errors)
+	}
+	if m := s.Metrics["http_requests_total"]; m == nil || m.Value != 18 || m.Errors == nil || *m.Errors != 3 {
+		t.Errorf("http_requests_total = %+v, want 18 requests with 3 errors", m)
+	}
+	if m := s.Metrics["request_duration_seconds"]; m == nil || m.Value != 6 || m.Errors != nil {
+		t.Errorf("request_duration_seconds = %+v, want a count of 6 and no error split", m)
+	}
+	if _, ok := s.Metrics["unrelated_total"]; ok {
+		t.Error("summary includes unrelated_total, which was not asked for")
+	}
+
+	s = got.Services["health-service"]
+	if s.Backends != 1 || s.Scraped != 0 || len(s.Errors) != 1 || len(s.Metrics) != 0 {
+		t.Errorf("health-service = %+v, want its missing /metrics listed as an error", s)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"middleware"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var backendEjectedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_backend_ejected",
+	Help: "1 while outlier detection keeps a backend out of rotation",
+}, []string{"service", "backend"})
+
+// outlierConfig ejects a backend whose share of failed requests over window
+// exceeds threshold, once it has served at least minRequests in that window, and
+// reinstates it after cooldown. A failure is a 5xx answer, including the 502 the
+// proxy writes when the backend can't be reached. With slowStart set, a reinstated
+// backend's share of traffic ramps up from slowStartMinWeight over that long.
+type outlierConfig struct {
+	threshold   float64
+	window      time.Duration
+	cooldown    time.Duration
+	minRequests int
+	slowStart   time.Duration
+}
+
+// slowStartMinWeight is the share of its normal traffic a backend gets the moment
+// it comes back from ejection.
+const slowStartMinWeight = 0.1
+
+// outlierStats counts one backend's requests in one-second buckets covering the window.
+type outlierStats struct {
+	mu           sync.Mutex
+	buckets      []outlierBucket
+	ejectedUntil time.Time
+}
+
+type outlierBucket struct {
+	second        int64
+	total, failed int
+}
+
+func newOutlierStats(cfg *outlierConfig) *outlierStats {
+	seconds := int((cfg.window + time.Second - 1) / time.Second)
+	return &outlierStats{buckets: make([]outlierBucket, max(seconds, 1))}
+}
+
+// record counts one request and reports whether it tipped the backend over the
+// threshold, in which case it is now ejected and its counts start over.
+func (s *outlierStats) record(cfg *outlierConfig, failed bool, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	second := now.Unix()
+	b := &s.buckets[second%int64(len(s.buckets))]
+	if b.second != second {
+		*b = outlierBucket{second: second}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+
+	if now.Before(s.ejectedUntil) {
+		return false
+	}
+	var total, failures int
+	for _, b := range s.buckets {
+		if second-b.second < int64(len(s.buckets)) {
+			total += b.total
+			failures += b.failed
+		}
+	}
+	if total < cfg.minRequests || float64(failures)/float64(total) <= cfg.threshold {
+		return false
+	}
+	s.ejectedUntil = now.Add(cfg.cooldown)
+	for i := range s.buckets {
+		s.buckets[i] = outlierBucket{}
+	}
+	return true
+}
+
+func (s *outlierStats) ejected(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.ejectedUntil)
+}
+
+// weight is the share of its normal traffic the backend should get: 0 while
+// ejected, rising linearly from slowStartMinWeight to 1 over cfg.slowStart once
+// reinstated, and 1 otherwise.
+func (s *outlierStats) weight(cfg *outlierConfig, now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Before(s.ejectedUntil) {
+		return 0
+	}
+	since := now.Sub(s.ejectedUntil)
+	if s.ejectedUntil.IsZero() || since >= cfg.slowStart {
+		return 1
+	}
+	return slowStartMinWeight + (1-slowStartMinWeight)*float64(since)/float64(cfg.slowStart)
+}
+
+// serveTracked proxies r to b and feeds the outcome into its outlier stats.
+func (p *backendPool) serveTracked(b *backend, w http.ResponseWriter, r *http.Request) {
+	rec := &middleware.StatusWriter{ResponseWriter: w}
+	b.proxy.ServeHTTP(rec, r)
+
+	if b.outliers.record(p.outliers, rec.Status() >= 500, time.Now()) {
+		log.Printf("%s: ejecting %s for %s, error rate above %.0f%% over %s", p.name, b.target, p.outliers.cooldown, p.outliers.threshold*100, p.outliers.window)
+		backendEjectedGauge.WithLabelValues(p.name, b.target).Set(1)
+		time.AfterFunc(p.outliers.cooldown, func() {
+			if p.outliers.slowStart > 0 {
+				log.Printf("%s: reinstating %s, ramping up over %s", p.name, b.target, p.outliers.slowStart)
+			} else {
+				log.Printf("%s: reinstating %s", p.name, b.target)
+			}
+			backendEjectedGauge.WithLabelValues(p.name, b.target).Set(0)
+		})
+	}
+}
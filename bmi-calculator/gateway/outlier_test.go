@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOutlierEjection(t *testing.T) {
+	cfg := &outlierConfig{threshold: 0.5, window: 10 * time.Second, cooldown: time.Minute, minRequests: 5}
+	hits := make([]int, 3)
+	targets := make([]string, len(hits))
+	for i := range targets {
+		i := i
+		u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+			if i == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			fmt.Fprint(w, i)
+		})
+		targets[i] = u.String()
+	}
+	pool, err := newBackendPool("outlier-test", strings.Join(targets, ","), "", newTransport(), "round-robin", "", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := 0
+	for i := 0; i < 60; i++ {
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bmi", nil))
+		if rec.Code != http.StatusOK {
+			failures++
+		}
+	}
+
+	// It's ejected as soon as it has served minRequests, all of them failures
+	if hits[1] != cfg.minRequests || failures != cfg.minRequests {
+		t.Errorf("failing backend served %d requests, %d failed, want it ejected after %d", hits[1], failures, cfg.minRequests)
+	}
+	if hits[0]+hits[2] != 60-cfg.minRequests {
+		t.Errorf("healthy backends served %d and %d requests, want the other %d", hits[0], hits[2], 60-cfg.minRequests)
+	}
+	if got := testutil.ToFloat64(backendEjectedGauge.WithLabelValues("outlier-test", targets[1])); got != 1 {
+		t.Errorf("ejected gauge = %v, want 1", got)
+	}
+}
+
+func TestOutlierStats(t *testing.T) {
+	cfg := &outlierConfig{threshold: 0.5, window: 10 * time.Second, cooldown: 30 * time.Second, minRequests: 4}
+	s := newOutlierStats(cfg)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Two failures in four is not above the threshold
+	for i, failed := range []bool{true, false, true, false} {
+		if s.record(cfg, failed, now) {
+			t.Fatalf("ejected on request %d at a 50%% error rate", i+1)
+		}
+	}
+	// Failures that fell out of the window no longer count
+	later := now.Add(cfg.window)
+	for i := 0; i < cfg.minRequests-1; i++ {
+		if s.record(cfg, true, later) {
+			t.Fatalf("ejected after %d requests in the window, want %d first", i+1, cfg.minRequests)
+		}
+	}
+	if !s.record(cfg, true, later) {
+		t.Fatal("not ejected at a 100% error rate")
+	}
+	if !s.ejected(later.Add(cfg.cooldown - time.Second)) {
+		t.Error("reinstated before the cooldown")
+	}
+	if s.ejected(later.Add(cfg.cooldown)) {
+		t.Error("still ejected after the cooldown")
+	}
+}
+
+func TestAllEjectedFallsBackToEveryBackend(t *testing.T) {
+	cfg := &outlierConfig{threshold: 0.5, window: 10 * time.Second, cooldown: time.Minute, minRequests: 1}
+	var targets []string
+	hits := make([]int, 2)
+	for i := range hits {
+		i := i
+		u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		targets = append(targets, u.String())
+	}
+	pool, err := newBackendPool("outlier-fallback-test", strings.Join(targets, ","), "", newTransport(), "round-robin", "", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		pool.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/bmi", nil))
+	}
+	if hits[0]+hits[1] != 10 || hits[0] == 0 || hits[1] == 0 {
+		t.Errorf("backends served %v with both ejected, want all 10 requests spread over them", hits)
+	}
+}
+
+func TestSlowStartRampsTrafficUp(t *testing.T) {
+	cfg := &outlierConfig{threshold: 0.5, window: 10 * time.Second, cooldown: time.Minute, minRequests: 5, slowStart: 10 * time.Second}
+	pool := newStubPool(t, 2, "round-robin", "", cfg)
+	recovering := pool.backends[1]
+	r := httptest.NewRequest(http.MethodGet, "/api/bmi", nil)
+
+	// The weight goes 0.1, 0.55, 1 so its share of picks is half that
+	last := -1.0
+	for _, since := range []time.Duration{0, 5 * time.Second, 10 * time.Second} {
+		recovering.outliers.mu.Lock()
+		recovering.outliers.ejectedUntil = time.Now().Add(-since)
+		recovering.outliers.mu.Unlock()
+
+		picked := 0
+		const picks = 4000
+		for i := 0; i < picks; i++ {
+			if pool.pick(r) == recovering {
+				picked++
+			}
+		}
+		share := float64(picked) / picks
+		if share <= last+0.1 {
+			t.Errorf("%s after reinstatement: share %.2f, want well above the %.2f before", since, share, last)
+		}
+		last = share
+	}
+	if last < 0.45 || last > 0.55 {
+		t.Errorf("share once slow start is over = %.2f, want about half", last)
+	}
+}
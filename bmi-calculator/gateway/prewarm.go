@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bmi-calculator/respond"
+)
+
+// ready flips once startup work that should finish before real traffic arrives
+// is done; without PREWARM it is set straight away.
+var ready atomic.Bool
+
+// prewarm opens conns connections to every backend of pools by sending that many
+// concurrent GET /health requests, so the shared transport has idle connections
+// waiting when the first real requests arrive. It gives up after timeout; the
+// gateway becomes ready either way.
+func prewarm(client *http.Client, pools []*backendPool, conns int, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, pool := range pools {
+		for _, b := range pool.backends {
+			pool, b := pool, b
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				ok := prewarmBackend(ctx, client, b.url("/health"), conns)
+				log.Printf("Prewarm %s %s: %d/%d connections in %s", pool.name, b.target, ok, conns, time.Since(start).Round(time.Millisecond))
+			}()
+		}
+	}
+	wg.Wait()
+	ready.Store(true)
+}
+
+// prewarmBackend returns how many of the conns concurrent requests to url got an answer.
+func prewarmBackend(ctx context.Context, client *http.Client, url string, conns int) int {
+	var ok atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return
+			}
+			// Draining the body lets the connection go back to the idle pool
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			ok.Add(1)
+		}()
+	}
+	wg.Wait()
+	return int(ok.Load())
+}
+
+// readyHandler answers 503 until the gateway is ready, so a rollout keeps sending
+// traffic to the old pods while a new one is still warming up.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		respond.Error(w, r, http.StatusServiceUnavailable, "not_ready", "prewarming backend connections")
+		return
+	}
+	respond.JSON(w, r, http.StatusOK, map[string]string{
+		"status":  "ready",
+		"service": "gateway",
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readyStatus is what GET /ready answers right now.
+func readyStatus() int {
+	rec := httptest.NewRecorder()
+	readyHandler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	return rec.Code
+}
+
+func TestReadyWaitsForPrewarm(t *testing.T) {
+	defer func(old bool) { ready.Store(old) }(ready.Load())
+	const backends, conns = 2, 3
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		answer  bool // whether the backends answer before the timeout
+	}{
+		{"backends answer", time.Minute, true},
+		{"backends hang until the timeout", 500 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready.Store(false)
+			arrived := make(chan struct{}, backends*conns)
+			release := make(chan struct{})
+			var targets []string
+			for i := 0; i < backends; i++ {
+				u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+					arrived <- struct{}{}
+					select {
+					case <-release:
+					case <-r.Context().Done():
+					}
+				})
+				targets = append(targets, u.String())
+			}
+			transport := newTransport()
+			pool, err := newBackendPool("test", strings.Join(targets, ","), "", transport, "round-robin", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				prewarm(&http.Client{Transport: transport}, []*backendPool{pool}, conns, tt.timeout)
+				close(done)
+			}()
+
+			// Every warmup request is parked in a backend, so prewarm can't be done yet
+			for i := 0; i < backends*conns; i++ {
+				<-arrived
+			}
+			if code := readyStatus(); code != http.StatusServiceUnavailable {
+				t.Fatalf("/ready = %d while prewarming, want 503", code)
+			}
+
+			if tt.answer {
+				close(release)
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("prewarm did not finish")
+			}
+			if code := readyStatus(); code != http.StatusOK {
+				t.Errorf("/ready = %d after prewarm, want 200", code)
+			}
+			if !tt.answer {
+				close(release)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"bmi-calculator/deadline"
+	"bmi-calculator/respond"
+
+	"middleware"
+)
+
+// newTransport builds the connection pool shared by every reverse proxy. The
+// DefaultTransport keeps only two idle connections per host, which causes
+// constant reconnects once a backend is scaled out behind one Service.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = getEnvInt("MAX_IDLE_CONNS", 100)
+	transport.MaxIdleConnsPerHost = getEnvInt("MAX_IDLE_CONNS_PER_HOST", 32)
+	transport.IdleConnTimeout = getEnvDuration("IDLE_CONN_TIMEOUT", 90*time.Second)
+
+	log.Printf("Upstream transport: max_idle_conns=%d max_idle_conns_per_host=%d idle_conn_timeout=%s",
+		transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	return transport
+}
+
+// preserveHost forwards the client's Host header instead of the backend's, for
+// backends that route on the public host name.
+var preserveHost = getEnv("PRESERVE_HOST", "false") == "true"
+
+// parseBackendURL accepts only absolute http(s) URLs with a host; url.Parse alone
+// takes "bmi-service:8081" as a scheme and "" as a path.
+func parseBackendURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing host")
+	}
+	return u, nil
+}
+
+// parseBasePath checks a backend base path such as /bmi/v1 and returns it without
+// a trailing slash; "" and "/" mean none. Segments are limited to unreserved URL
+// characters, so the path needs no escaping, and "." or ".." are refused since
+// they would climb out of it.
+func parseBasePath(raw string) (string, error) {
+	path := strings.TrimSuffix(raw, "/")
+	if path == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", errors.New("must start with /")
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid segment %q", segment)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~", c)) {
+				return "", fmt.Errorf("segment %q may only use letters, digits and -._~", segment)
+			}
+		}
+	}
+	return path, nil
+}
+
+// createReverseProxy proxies to targetURL, prepending basePath to the forwarded
+// path after the gateway has stripped its route prefix, so /api/bmi/calculate
+// reaches /bmi/v1/calculate with a basePath of /bmi/v1.
+func createReverseProxy(targetURL *url.URL, basePath string, transport http.RoundTripper) *httputil.ReverseProxy {
+	target := targetURL.String() + basePath
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.Transport = transport
+	// The stock director rewrites the URL but leaves Host as the client sent it
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		// Prepended before the stock director joins the path onto the target URL's
+		if basePath != "" {
+			req.URL.Path = basePath + req.URL.Path
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = basePath + req.URL.RawPath
+			}
+		}
+		director(req)
+		if !preserveHost {
+			req.Host = targetURL.Host
+		}
+		deadline.Propagate(req.Context(), req.Header)
+	}
+	// Backends echo the X-Request-ID the gateway sent; drop it so the response
+	// doesn't carry the ID twice
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Del(middleware.RequestIDHeader)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy error: %s %s to %s: %v", r.Method, r.URL.Path, target, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			respond.Error(w, r, http.StatusGatewayTimeout, "timeout", "upstream did not answer within the request's timeout")
+			return
+		}
+		respond.Error(w, r, http.StatusBadGateway, "bad_gateway", "upstream unavailable")
+	}
+	return proxy
+}
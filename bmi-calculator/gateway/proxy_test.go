@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"bmi-calculator/respond"
+)
+
+// newBackend starts a backend and reports how many connections it accepted.
+func newBackend(t *testing.T, handler http.HandlerFunc) (*url.URL, *atomic.Int64) {
+	t.Helper()
+	var conns atomic.Int64
+	backend := httptest.NewUnstartedServer(handler)
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	backend.Start()
+	t.Cleanup(backend.Close)
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, &conns
+}
+
+func TestProxyReusesKeepAliveConnections(t *testing.T) {
+	target, conns := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	proxy := createReverseProxy(target, "", newTransport())
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i+1, rec.Code)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("backend accepted %d connections for two sequential requests, want 1 kept alive", n)
+	}
+}
+
+func TestProxyErrorEnvelope(t *testing.T) {
+	// A port that was just released has nothing listening on it
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &url.URL{Scheme: "http", Host: closed.Addr().String()}
+	closed.Close()
+
+	rec := httptest.NewRecorder()
+	createReverseProxy(target, "", newTransport()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bmi", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body respond.ErrorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Status != http.StatusBadGateway || body.Code != "bad_gateway" || body.Message == "" {
+		t.Errorf("body = %q, want the shared error envelope", rec.Body)
+	}
+}
+
+func TestProxyHost(t *testing.T) {
+	defer func(old bool) { preserveHost = old }(preserveHost)
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	})
+
+	for _, tt := range []struct {
+		preserve bool
+		want     string
+	}{
+		{false, target.Host},
+		{true, "bmi.example.com"},
+	} {
+		preserveHost = tt.preserve
+		r := httptest.NewRequest(http.MethodGet, "/api/bmi", nil)
+		r.Host = "bmi.example.com"
+		rec := httptest.NewRecorder()
+		createReverseProxy(target, "", newTransport()).ServeHTTP(rec, r)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("PRESERVE_HOST=%v: backend saw Host %q, want %q", tt.preserve, got, tt.want)
+		}
+	}
+}
+
+func TestProxyBasePath(t *testing.T) {
+	target, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	})
+	for _, tt := range []struct {
+		basePath, path, want string
+	}{
+		{"/bmi/v1", "/api/bmi/calculate", "/bmi/v1/calculate"},
+		{"/bmi/v1", "/api/bmi/history?limit=5", "/bmi/v1/history?limit=5"},
+		{"", "/api/bmi/calculate", "/calculate"},
+	} {
+		pool, err := newBackendPool("bmi-service", target.String(), tt.basePath, newTransport(), "round-robin", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		http.StripPrefix("/api/bmi", pool).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("base path %q: %s reached the backend as %q, want %q", tt.basePath, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseBasePath(t *testing.T) {
+	for _, tt := range []struct {
+		raw, want string
+		wantErr   bool
+	}{
+		{raw: "", want: ""},
+		{raw: "/", want: ""},
+		{raw: "/bmi/v1", want: "/bmi/v1"},
+		{raw: "/bmi/v1/", want: "/bmi/v1"},
+		{raw: "bmi/v1", wantErr: true},
+		{raw: "/bmi//v1", wantErr: true},
+		{raw: "/bmi/../admin", wantErr: true},
+		{raw: "/bmi v1", wantErr: true},
+		{raw: "/bmi?v=1", wantErr: true},
+	} {
+		got, err := parseBasePath(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseBasePath(%q) = %q, %v; want %q, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
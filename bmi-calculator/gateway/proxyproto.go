@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxProxyV1Header is the longest v1 line the spec allows, CRLF included.
+const maxProxyV1Header = 107
+
+// proxyProtoListener reads the PROXY protocol header that TCP load balancers such
+// as an AWS NLB or HAProxy put in front of a connection, and reports the client
+// it names as the connection's remote address, so logs and anything keyed on the
+// client see the real one rather than the balancer. A connection without a header
+// is served as it is, which keeps probes that connect directly working. Only
+// peers inside trusted may send a header, as anyone else could name any address;
+// with trusted empty, none may.
+type proxyProtoListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+func newProxyProtoListener(inner net.Listener, trusted []*net.IPNet, timeout time.Duration) net.Listener {
+	return &proxyProtoListener{Listener: inner, trusted: trusted, timeout: timeout}
+}
+
+// Accept returns at once; the header is read by the connection's own goroutine on
+// its first Read or RemoteAddr, so a slow client can't hold up the accept loop.
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoConn{Conn: conn, listener: l, reader: bufio.NewReader(conn)}, nil
+}
+
+func (l *proxyProtoListener) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range l.trusted {
+		if ipNet.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyProtoConn struct {
+	net.Conn
+	listener *proxyProtoListener
+	reader   *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.listener.timeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	remote, err := parseProxyHeader(c.reader)
+	if err == nil && remote != nil && !c.listener.trusts(c.Conn.RemoteAddr()) {
+		err = fmt.Errorf("PROXY header from untrusted peer %s", c.Conn.RemoteAddr())
+	}
+	if err != nil {
+		log.Printf("Rejecting connection from %s: %v", c.Conn.RemoteAddr(), err)
+		c.err = err
+		c.Conn.Close()
+		return
+	}
+	c.remote = remote
+}
+
+// parseProxyHeader consumes a v1 or v2 header from r and returns the source
+// address it carries. It returns nil without error when there is no header, or
+// when the header says the connection is the balancer's own (v1 UNKNOWN, v2
+// LOCAL); the socket's address applies then.
+func parseProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	// A short peek, e.g. a client that closed at once, is left for the HTTP server
+	peek, _ := r.Peek(len(proxyV2Signature))
+	switch {
+	case bytes.Equal(peek, proxyV2Signature):
+		return parseProxyV2(r)
+	case bytes.HasPrefix(peek, []byte("PROXY ")):
+		return parseProxyV1(r)
+	default:
+		return nil, nil
+	}
+}
+
+func parseProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1Header {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("reading PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			return parseProxyV1Line(string(line[:len(line)-2]))
+		}
+	}
+	return nil, errors.New("PROXY v1 header too long")
+}
+
+// parseProxyV1Line parses "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080".
+func parseProxyV1Line(line string) (net.Addr, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("invalid source address %q in PROXY v1 header", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port %q in PROXY v1 header", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func parseProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 header: %w", err)
+	}
+	verCmd, family := header[12], header[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("reading PROXY v2 addresses: %w", err)
+	}
+
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL: health checks from the balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", verCmd&0x0f)
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if len(body) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		// AF_UNSPEC or AF_UNIX carry no usable client IP
+		return nil, nil
+	}
+}
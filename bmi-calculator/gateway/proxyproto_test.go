@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"bmi-calculator/clientip"
+)
+
+// proxyV2 builds a v2 header with the given command, family and address block.
+func proxyV2(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	ipv4 := append(net.ParseIP("203.0.113.7").To4(), net.ParseIP("10.0.0.1").To4()...)
+	ipv4 = append(ipv4, 0xc8, 0x22, 0x1f, 0x90) // ports 51234, 8080
+	ipv6 := append(net.ParseIP("2001:db8::7").To16(), net.ParseIP("fd00::1").To16()...)
+	ipv6 = append(ipv6, 0xc8, 0x22, 0x1f, 0x90)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string // the source address, "" for none
+		wantErr bool
+	}{
+		{name: "v1 TCP4", input: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n"), want: "203.0.113.7:51234"},
+		{name: "v1 TCP6", input: []byte("PROXY TCP6 2001:db8::7 fd00::1 51234 8080\r\n"), want: "[2001:db8::7]:51234"},
+		{name: "v1 UNKNOWN", input: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 UNKNOWN with addresses", input: []byte("PROXY UNKNOWN 203.0.113.7 10.0.0.1 51234 8080\r\n")},
+		{name: "v1 missing fields", input: []byte("PROXY TCP4 203.0.113.7\r\n"), wantErr: true},
+		{name: "v1 family mismatch", input: []byte("PROXY TCP4 2001:db8::7 fd00::1 51234 8080\r\n"), wantErr: true},
+		{name: "v1 bad port", input: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 99999 8080\r\n"), wantErr: true},
+		{name: "v1 too long", input: []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), wantErr: true},
+		{name: "v1 unterminated", input: []byte("PROXY TCP4 203.0.113.7"), wantErr: true},
+		{name: "v2 IPv4", input: proxyV2(0x1, 0x11, ipv4), want: "203.0.113.7:51234"},
+		{name: "v2 IPv6", input: proxyV2(0x1, 0x21, ipv6), want: "[2001:db8::7]:51234"},
+		{name: "v2 LOCAL", input: proxyV2(0x0, 0x11, ipv4)},
+		{name: "v2 AF_UNSPEC", input: proxyV2(0x1, 0x00, nil)},
+		{name: "v2 short IPv4 block", input: proxyV2(0x1, 0x11, ipv4[:8]), wantErr: true},
+		{name: "v2 short IPv6 block", input: proxyV2(0x1, 0x21, ipv6[:20]), wantErr: true},
+		{name: "v2 unknown command", input: proxyV2(0x2, 0x11, ipv4), wantErr: true},
+		{name: "v2 truncated", input: proxyV2(0x1, 0x11, ipv4)[:20], wantErr: true},
+		{name: "no header", input: []byte("GET / HTTP/1.1\r\n\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A valid header is followed by the request, which must be left unread;
+			// a broken one stands alone, so it can't borrow the request's bytes
+			const rest = "GET / HTTP/1.1\r\n"
+			input := tt.input
+			if !tt.wantErr {
+				input = append(append([]byte{}, input...), rest...)
+			}
+			r := bufio.NewReader(bytes.NewReader(input))
+			addr, err := parseProxyHeader(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseProxyHeader() = %v, want an error", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProxyHeader() error = %v", err)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("source = %q, want %q", got, tt.want)
+			}
+			wantRest := rest
+			if tt.name == "no header" {
+				wantRest = string(tt.input) + rest
+			}
+			if after, _ := io.ReadAll(r); string(after) != wantRest {
+				t.Errorf("left %q after the header, want %q", after, wantRest)
+			}
+		})
+	}
+}
+
+func TestProxyProtoListener(t *testing.T) {
+	loopback, err := clientip.ParseCIDRs("127.0.0.0/8, ::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	elsewhere, err := clientip.ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		header  string
+		want    string // the client address the handler sees, "" if the connection is refused
+	}{
+		{"v1 header from a trusted peer", loopback, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n", "203.0.113.7:51234"},
+		{"no header keeps the socket address", loopback, "", "127.0.0.1"},
+		{"UNKNOWN keeps the socket address", loopback, "PROXY UNKNOWN\r\n", "127.0.0.1"},
+		{"header from an untrusted peer is refused", elsewhere, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n", ""},
+		{"no trusted proxies refuses every header", nil, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n", ""},
+		{"malformed header is refused", loopback, "PROXY TCP4 nonsense\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(chan string, 1)
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen <- r.RemoteAddr
+			})}
+			go server.Serve(newProxyProtoListener(inner, tt.trusted, time.Second))
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			io.WriteString(conn, tt.header+"GET / HTTP/1.0\r\n\r\n")
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			io.ReadAll(conn)
+
+			select {
+			case got := <-seen:
+				if tt.want == "" {
+					t.Fatalf("request served as from %s, want the connection refused", got)
+				}
+				if got != tt.want && !strings.HasPrefix(got, tt.want+":") {
+					t.Errorf("client address = %s, want %s", got, tt.want)
+				}
+			default:
+				if tt.want != "" {
+					t.Fatalf("request not served, want it from %s", tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Balancer chooses which backend of a pool serves a request. Pick returns an
+// index into backends; with outlier detection the pool walks on from there to
+// the first backend still in rotation, so every strategy gets ejection for free.
+type Balancer interface {
+	Pick(r *http.Request, backends []*backend) int
+}
+
+// balancers maps each LB_STRATEGY value to its constructor.
+var balancers = map[string]func(backends []*backend, stickyKey string) Balancer{
+	"round-robin":       func([]*backend, string) Balancer { return &roundRobin{} },
+	"random":            func([]*backend, string) Balancer { return randomBalancer{} },
+	"least-connections": func([]*backend, string) Balancer { return &leastConnections{} },
+	"consistent-hash": func(backends []*backend, stickyKey string) Balancer {
+		return &consistentHash{ring: newHashRing(backends), stickyKey: stickyKey}
+	},
+}
+
+// checkStrategy reports whether strategy names a known balancer and has what it
+// needs; consistent-hash needs a sticky key to hash on.
+func checkStrategy(strategy, stickyKey string) error {
+	if _, ok := balancers[strategy]; !ok {
+		return fmt.Errorf("unknown strategy %q, expected one of %s", strategy, strings.Join(balancerNames(), ", "))
+	}
+	if strategy == "consistent-hash" && stickyKey == "" {
+		return errors.New("consistent-hash needs STICKY_KEY set to a header name or ip")
+	}
+	return nil
+}
+
+// newBalancer builds the strategy named by LB_STRATEGY for backends.
+func newBalancer(strategy string, backends []*backend, stickyKey string) (Balancer, error) {
+	if err := checkStrategy(strategy, stickyKey); err != nil {
+		return nil, err
+	}
+	return balancers[strategy](backends, stickyKey), nil
+}
+
+func balancerNames() []string {
+	names := make([]string, 0, len(balancers))
+	for name := range balancers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// roundRobin hands requests to each backend in turn.
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Pick(_ *http.Request, backends []*backend) int {
+	return int((b.next.Add(1) - 1) % uint64(len(backends)))
+}
+
+// randomBalancer picks a backend uniformly at random; over many requests the
+// spread matches round-robin, but short bursts can pile onto one backend.
+type randomBalancer struct{}
+
+func (randomBalancer) Pick(_ *http.Request, backends []*backend) int {
+	return rand.Intn(len(backends))
+}
+
+// leastConnections sends each request to the backend with the fewest requests
+// in flight, so a slow backend that holds on to requests gets fewer new ones.
+// Ties are broken round-robin, or an idle pool would always pick the first.
+type leastConnections struct {
+	next atomic.Uint64
+}
+
+func (b *leastConnections) Pick(_ *http.Request, backends []*backend) int {
+	start := int((b.next.Add(1) - 1) % uint64(len(backends)))
+	best := start
+	for i := 1; i < len(backends); i++ {
+		n := (start + i) % len(backends)
+		if backends[n].active.Load() < backends[best].active.Load() {
+			best = n
+		}
+	}
+	return best
+}
+
+// consistentHash sends requests with the same sticky key to the same backend
+// while the set is stable; requests without the key are round-robined.
+type consistentHash struct {
+	ring      *hashRing
+	stickyKey string
+	fallback  roundRobin
+}
+
+func (b *consistentHash) Pick(r *http.Request, backends []*backend) int {
+	if key := affinityKey(r, b.stickyKey); key != "" {
+		return b.ring.get(key)
+	}
+	return b.fallback.Pick(r, backends)
+}
+
+// affinityKey is the client address when stickyKey is "ip", else the value of
+// the stickyKey header.
+func affinityKey(r *http.Request, stickyKey string) string {
+	if stickyKey == "ip" {
+		return clientIPs.FromRequest(r)
+	}
+	return r.Header.Get(stickyKey)
+}
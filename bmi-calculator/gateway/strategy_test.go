@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStrategySelection(t *testing.T) {
+	get := func() *http.Request { return httptest.NewRequest(http.MethodGet, "/", nil) }
+
+	t.Run("round-robin", func(t *testing.T) {
+		pool := newStubPool(t, 3, "round-robin", "", nil)
+		var order []string
+		for i := 0; i < 6; i++ {
+			order = append(order, served(t, pool, get()))
+		}
+		if got := strings.Join(order, ""); got != "012012" {
+			t.Errorf("served in order %s, want 012012", got)
+		}
+	})
+
+	t.Run("random", func(t *testing.T) {
+		pool := newStubPool(t, 3, "random", "", nil)
+		counts := map[string]int{}
+		for i := 0; i < 300; i++ {
+			counts[served(t, pool, get())]++
+		}
+		// Each backend expects 100; under 50 is many standard deviations out
+		for _, b := range []string{"0", "1", "2"} {
+			if counts[b] < 50 {
+				t.Errorf("backend %s served %d of 300, want roughly a third: %v", b, counts[b], counts)
+			}
+		}
+	})
+
+	t.Run("least-connections", func(t *testing.T) {
+		pool := newStubPool(t, 3, "least-connections", "", nil)
+		pool.backends[0].active.Store(2)
+		pool.backends[2].active.Store(1)
+		for i := 0; i < 3; i++ {
+			if got := pool.balancer.Pick(get(), pool.backends); got != 1 {
+				t.Errorf("picked backend %d with in-flight %d/%d/%d, want the idle 1", got,
+					pool.backends[0].active.Load(), pool.backends[1].active.Load(), pool.backends[2].active.Load())
+			}
+		}
+		// With every backend equally busy, ties rotate instead of piling on one
+		pool.backends[0].active.Store(0)
+		pool.backends[2].active.Store(0)
+		seen := map[int]bool{}
+		for i := 0; i < 3; i++ {
+			seen[pool.balancer.Pick(get(), pool.backends)] = true
+		}
+		if len(seen) != 3 {
+			t.Errorf("idle pool picked %v over three requests, want every backend", seen)
+		}
+	})
+
+	t.Run("consistent-hash", func(t *testing.T) {
+		pool := newStubPool(t, 3, "consistent-hash", "X-User", nil)
+		keyed := func() *http.Request {
+			r := get()
+			r.Header.Set("X-User", "alice")
+			return r
+		}
+		first := served(t, pool, keyed())
+		for i := 0; i < 5; i++ {
+			if got := served(t, pool, keyed()); got != first {
+				t.Fatalf("alice went to backend %s, then %s", first, got)
+			}
+		}
+		// Requests without the key fall back to round-robin
+		var order []string
+		for i := 0; i < 3; i++ {
+			order = append(order, served(t, pool, get()))
+		}
+		if got := strings.Join(order, ""); got != "012" {
+			t.Errorf("unkeyed requests served in order %s, want 012", got)
+		}
+	})
+}
+
+func TestNewBalancer(t *testing.T) {
+	for _, tt := range []struct {
+		strategy, stickyKey string
+		wantErr             bool
+	}{
+		{"round-robin", "", false},
+		{"random", "", false},
+		{"least-connections", "", false},
+		{"consistent-hash", "X-User", false},
+		{"consistent-hash", "", true},
+		{"fastest", "", true},
+	} {
+		b, err := newBalancer(tt.strategy, nil, tt.stickyKey)
+		if (err != nil) != tt.wantErr || (err == nil) != (b != nil) {
+			t.Errorf("newBalancer(%q, %q) = %v, %v; want error %v", tt.strategy, tt.stickyKey, b, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLeastConnectionsFavoursFasterBackend(t *testing.T) {
+	release := make(chan struct{})
+	slowArrived := make(chan struct{}, 10)
+	slow, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		slowArrived <- struct{}{}
+		<-release
+		w.Write([]byte("slow"))
+	})
+	fast, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	})
+	pool, err := newBackendPool("test", slow.String()+","+fast.String(), "", newTransport(), "least-connections", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each request either finishes on the fast backend or is held by the slow one
+	// before the next starts, so the in-flight counts the balancer sees are exact
+	const requests = 10
+	done := make(chan string, requests)
+	heldBySlow := 0
+	for i := 0; i < requests; i++ {
+		go func() {
+			rec := httptest.NewRecorder()
+			pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			done <- rec.Body.String()
+		}()
+		select {
+		case <-slowArrived:
+			heldBySlow++
+		case got := <-done:
+			if got != "fast" {
+				t.Fatalf("request %d answered %q before the slow backend was released", i+1, got)
+			}
+		}
+	}
+	close(release)
+	for i := 0; i < heldBySlow; i++ {
+		<-done
+	}
+
+	if heldBySlow != 1 {
+		t.Errorf("slow backend took %d of %d requests, want only the first while it was busy", heldBySlow, requests)
+	}
+	for i, b := range pool.backends {
+		if n := b.active.Load(); n != 0 {
+			t.Errorf("backend %d still counts %d in flight after every request finished", i, n)
+		}
+	}
+}
+
+func TestLeastConnectionsCountsFailedRequests(t *testing.T) {
+	// A port that was just released has nothing listening on it
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "http://" + closed.Addr().String()
+	closed.Close()
+	pool, err := newBackendPool("test", target, "", newTransport(), "least-connections", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	pool.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	if n := pool.backends[0].active.Load(); n != 0 {
+		t.Errorf("in-flight count is %d after an upstream error, want 0", n)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig loads the certificate pair up front so a bad cert or key fails
+// the pod at startup instead of on the first handshake.
+func newTLSConfig(certFile, keyFile, minVersion string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must both be set")
+	}
+
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("TLS_MIN_VERSION %q is not one of 1.0, 1.1, 1.2, 1.3", minVersion)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS key pair (%s, %s): %w", certFile, keyFile, err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   version,
+	}, nil
+}
+
+// requireClientCerts makes the handshake fail for clients without a certificate signed
+// by one of the CAs in caFile.
+func requireClientCerts(config *tls.Config, caFile string) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("reading MTLS_CA_FILE: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("MTLS_CA_FILE %s contains no PEM certificates", caFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// clientCNMiddleware forwards the verified client certificate's common name to the
+// backends as X-Client-CN, dropping any value the client sent itself.
+func clientCNMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("X-Client-CN")
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r.Header.Set("X-Client-CN", r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain-HTTP clients to the same host and path on the TLS port.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, both on disk as PEM.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert issues a certificate for cn, signed by parent or self-signed when
+// parent is nil. A self-signed one is a CA, so it can issue others.
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	tc := &testCert{cert: cert, key: key, certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem")}
+	writePEM(t, tc.certFile, "CERTIFICATE", der)
+	writePEM(t, tc.keyFile, "EC PRIVATE KEY", keyDER)
+	return tc
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves h over TLS with config the way main does, returning the URL.
+func serveTLS(t *testing.T, config *tls.Config, h http.Handler) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: h, TLSConfig: config}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// clientFor trusts roots and, when cert is set, presents it.
+func clientFor(roots *testCert, cert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(roots.cert)
+	config := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func TestServeHTTPS(t *testing.T) {
+	server := newTestCert(t, "gateway", nil)
+	config, err := newTLSConfig(server.certFile, server.keyFile, "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serveTLS(t, config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	resp, err := clientFor(server, nil).Get(url + "/health")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("status = %d, TLS = %v, want 200 over TLS 1.2 or later", resp.StatusCode, resp.TLS)
+	}
+}
+
+func TestNewTLSConfigFailsFast(t *testing.T) {
+	server := newTestCert(t, "gateway", nil)
+	other := newTestCert(t, "other", nil)
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		minVersion        string
+	}{
+		{"missing key", server.certFile, "", "1.2"},
+		{"unknown version", server.certFile, server.keyFile, "1.4"},
+		{"mismatched pair", server.certFile, other.keyFile, "1.2"},
+		{"missing file", filepath.Join(t.TempDir(), "nope.pem"), server.keyFile, "1.2"},
+	}
+	for _, tt := range tests {
+		if _, err := newTLSConfig(tt.certFile, tt.keyFile, tt.minVersion); err == nil {
+			t.Errorf("%s: newTLSConfig() succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct{ port, want string }{
+		{"8443", "https://gateway.local:8443/api/history?limit=5"},
+		{"443", "https://gateway.local/api/history?limit=5"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.port).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://gateway.local:8080/api/history?limit=5", nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.want {
+			t.Errorf("port %s: %d to %q, want 308 to %q", tt.port, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCert(t, "demo-ca", nil)
+	server := newTestCert(t, "gateway", ca)
+	config, err := newTLSConfig(server.certFile, server.keyFile, "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := requireClientCerts(config, ca.certFile); err != nil {
+		t.Fatal(err)
+	}
+	url := serveTLS(t, config, clientCNMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Client-CN")))
+	})))
+
+	keyPair := func(c *testCert) *tls.Certificate {
+		pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pair
+	}
+	tests := []struct {
+		name   string
+		cert   *tls.Certificate
+		wantCN string // "" when the handshake must fail
+	}{
+		{"signed by the CA", keyPair(newTestCert(t, "billing", ca)), "billing"},
+		{"signed by another CA", keyPair(newTestCert(t, "intruder", newTestCert(t, "rogue-ca", nil))), ""},
+		{"self-signed", keyPair(newTestCert(t, "selfie", nil)), ""},
+		{"no certificate", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url+"/api/history", nil)
+			req.Header.Set("X-Client-CN", "spoofed")
+			resp, err := clientFor(ca, tt.cert).Do(req)
+			if tt.wantCN == "" {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("request accepted with status %d, want the handshake rejected", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request rejected: %v", err)
+			}
+			defer resp.Body.Close()
+			if cn, _ := io.ReadAll(resp.Body); string(cn) != tt.wantCN {
+				t.Errorf("upstream saw X-Client-CN %q, want %q", cn, tt.wantCN)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"bmi-calculator/identity"
+	"bmi-calculator/respond"
+)
+
+type versionResult struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Version   string `json:"version,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// versionsHandler asks every backend of pools for its /version, at most
+// concurrency at a time and all under one deadline, and lists the answers per
+// service next to the gateway's own. Unlike /api/fanout it calls each backend
+// URL, not one picked per pool, so a half-finished rollout shows up. It answers
+// 502 when any backend was unreachable or has no /version.
+func versionsHandler(client *http.Client, self identity.Version, pools []*backendPool, concurrency int, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		services := map[string][]versionResult{
+			self.Service: {{URL: "self", Reachable: true, Version: self.Version, GoVersion: self.GoVersion}},
+		}
+		for _, pool := range pools {
+			services[pool.name] = make([]versionResult, len(pool.backends))
+		}
+
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, pool := range pools {
+			for i, b := range pool.backends {
+				results, i, b := services[pool.name], i, b
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					results[i] = fetchVersion(ctx, client, b.url(""), r.Header)
+				}()
+			}
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		consistent := true
+		// consistent is per service: every reachable replica reports the same version
+		for _, results := range services {
+			version := ""
+			for _, result := range results {
+				switch {
+				case !result.Reachable:
+					status = http.StatusBadGateway
+				case version == "":
+					version = result.Version
+				case result.Version != version:
+					consistent = false
+				}
+			}
+		}
+
+		respond.JSON(w, r, status, map[string]interface{}{
+			"services":   services,
+			"consistent": consistent,
+		})
+	}
+}
+
+func fetchVersion(ctx context.Context, client *http.Client, target string, incoming http.Header) versionResult {
+	result := versionResult{URL: target}
+	fetched := fetch(ctx, client, target+"/version", incoming)
+	if fetched.Error != "" {
+		result.Error = fetched.Error
+		return result
+	}
+
+	var v identity.Version
+	if err := json.Unmarshal(fetched.Body, &v); err != nil || v.Version == "" {
+		result.Error = "no version in response"
+		return result
+	}
+	result.Reachable = true
+	result.Version = v.Version
+	result.GoVersion = v.GoVersion
+	return result
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bmi-calculator/identity"
+)
+
+// versionBackend answers /version as service at version.
+func versionBackend(t *testing.T, service, version string) string {
+	t.Helper()
+	u, _ := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(identity.Version{Service: service, Version: version, GoVersion: "go1.21.0"})
+	})
+	return u.String()
+}
+
+func TestVersionsAggregation(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + closed.Addr().String()
+	closed.Close()
+
+	bmiV1, bmiV2 := versionBackend(t, "bmi-service", "1.0.0"), versionBackend(t, "bmi-service", "1.1.0")
+	health := versionBackend(t, "health-service", "1.0.0")
+
+	tests := []struct {
+		name       string
+		bmi        []string
+		health     []string
+		status     int
+		consistent bool
+	}{
+		{"one revision everywhere", []string{bmiV1}, []string{health}, http.StatusOK, true},
+		{"rollout half done", []string{bmiV1, bmiV2}, []string{health}, http.StatusOK, false},
+		{"backend unreachable", []string{bmiV1}, []string{health, unreachable}, http.StatusBadGateway, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pools []*backendPool
+			for _, p := range []struct {
+				name    string
+				targets []string
+			}{{"bmi-service", tt.bmi}, {"health-service", tt.health}} {
+				pool, err := newBackendPool(p.name, strings.Join(p.targets, ","), "", newTransport(), "round-robin", "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pools = append(pools, pool)
+			}
+			handler := versionsHandler(http.DefaultClient, identity.NewVersion("gateway", "1.0.0"), pools, 2, 2*time.Second)
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/api/versions", nil))
+			var body struct {
+				Services   map[string][]versionResult `json:"services"`
+				Consistent bool                       `json:"consistent"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.status || body.Consistent != tt.consistent {
+				t.Errorf("status %d, consistent %v, want %d and %v", rec.Code, body.Consistent, tt.status, tt.consistent)
+			}
+			if gw := body.Services["gateway"]; len(gw) != 1 || gw[0].Version != "1.0.0" {
+				t.Errorf("gateway = %+v, want its own version", gw)
+			}
+			for service, targets := range map[string][]string{"bmi-service": tt.bmi, "health-service": tt.health} {
+				results := body.Services[service]
+				if len(results) != len(targets) {
+					t.Fatalf("%s: %d results for %d backends", service, len(results), len(targets))
+				}
+				for i, result := range results {
+					want := map[string]string{bmiV1: "1.0.0", bmiV2: "1.1.0", health: "1.0.0"}[targets[i]]
+					if result.URL != targets[i] || result.Reachable != (want != "") || result.Version != want {
+						t.Errorf("%s backend %d = %+v, want %s reporting %q", service, i, result, targets[i], want)
+					}
+					if !result.Reachable && result.Error == "" {
+						t.Errorf("%s backend %d unreachable without an error", service, i)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+var (
+	downstreams = parseDownstreams(getEnv("HEALTH_DOWNSTREAMS", "gateway=http://gateway:8080,bmi-service=http://bmi-service:8081"))
+
+	probeConcurrency = max(getEnvInt("HEALTH_PROBE_CONCURRENCY", 10), 1)
+)
+
+// parseDownstreams reads "name=baseURL" pairs separated by commas. Entries
+// without a name or URL are skipped.
+func parseDownstreams(spec string) []downstream {
+	var out []downstream
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, baseURL, ok := strings.Cut(entry, "=")
+		name, baseURL = strings.TrimSpace(name), strings.TrimRight(strings.TrimSpace(baseURL), "/")
+		if !ok || name == "" || baseURL == "" {
+			log.Printf("Ignoring invalid downstream %q, expected name=url", entry)
+			continue
+		}
+		out = append(out, downstream{Name: name, BaseURL: baseURL})
+	}
+	return out
+}
+
+// checkDownstreams probes every downstream in parallel, at most
+// HEALTH_PROBE_CONCURRENCY at a time so a long list can't flood a shared
+// dependency. Results keep the order of the list.
+func checkDownstreams(list []downstream) []ServiceCheck {
+	services := make([]ServiceCheck, len(list))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i, d := range list {
+		i, d := i, d
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			services[i] = checkDownstream(d)
+		}()
+	}
+	wg.Wait()
+	return services
+}
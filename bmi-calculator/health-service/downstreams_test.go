@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckDownstreamsBoundsConcurrency(t *testing.T) {
+	defer func(old int) { probeConcurrency = old }(probeConcurrency)
+	defer func(old bool) { metricsScrape = old }(metricsScrape)
+	probeConcurrency = 5
+	metricsScrape = false
+
+	var running, peak atomic.Int64
+	var list []downstream
+	for i := 0; i < 20; i++ {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			// Hold the slot long enough for the other probes to pile up
+			time.Sleep(20 * time.Millisecond)
+		}))
+		t.Cleanup(backend.Close)
+		list = append(list, downstream{Name: fmt.Sprintf("svc-%d", i), BaseURL: backend.URL})
+	}
+
+	services := checkDownstreams(list)
+
+	if p := peak.Load(); p > 5 {
+		t.Errorf("%d probes ran at once, want at most 5", p)
+	} else if p < 2 {
+		t.Errorf("at most %d probe ran at once, want them in parallel", p)
+	}
+	if len(services) != len(list) {
+		t.Fatalf("got %d results for %d downstreams", len(services), len(list))
+	}
+	for i, s := range services {
+		if s.Name != list[i].Name || s.Status != "healthy" {
+			t.Errorf("result %d = %s %s, want %s healthy", i, s.Name, s.Status, list[i].Name)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// maxHealthJitterMS caps HEALTH_JITTER_MS so a typo can't hang probes for minutes.
+const maxHealthJitterMS = 10000
+
+// healthJitter delays each request by a random 0..maxMS milliseconds drawn from
+// rng, to show how a probe timeout tighter than the jitter makes a healthy pod flap.
+func healthJitter(maxMS int, rng *rand.Rand) func(http.Handler) http.Handler {
+	if maxMS > maxHealthJitterMS {
+		log.Printf("HEALTH_JITTER_MS %d exceeds %d, capping", maxMS, maxHealthJitterMS)
+		maxMS = maxHealthJitterMS
+	}
+	return func(next http.Handler) http.Handler {
+		if maxMS <= 0 {
+			return next
+		}
+		log.Printf("Health jitter enabled: /health delayed by up to %dms", maxMS)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delay := time.Duration(rng.Intn(maxMS+1)) * time.Millisecond
+			log.Printf("Health jitter: delaying %s by %s", r.URL.Path, delay)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chaos"
+)
+
+func TestHealthJitterWithinRange(t *testing.T) {
+	const maxMS = 40
+	h := healthJitter(maxMS, chaos.NewRand(1))(http.HandlerFunc(healthHandler))
+
+	var slowest time.Duration
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		elapsed := time.Since(start)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		// The timer never fires early; allow some scheduling slack above the cap
+		if elapsed > maxMS*time.Millisecond+50*time.Millisecond {
+			t.Errorf("/health took %v, want at most HEALTH_JITTER_MS=%d", elapsed, maxMS)
+		}
+		slowest = max(slowest, elapsed)
+	}
+	if slowest < 5*time.Millisecond {
+		t.Errorf("slowest of 20 jittered requests took %v, want some delay", slowest)
+	}
+}
+
+func TestHealthJitterOff(t *testing.T) {
+	next := http.HandlerFunc(healthHandler)
+	for _, maxMS := range []int{0, -1} {
+		start := time.Now()
+		healthJitter(maxMS, chaos.NewRand(1))(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+		if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+			t.Errorf("HEALTH_JITTER_MS=%d: /health took %v, want no delay", maxMS, elapsed)
+		}
+	}
+}
@@ -1,14 +1,28 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 
+	"bmi-calculator/clientip"
+	"bmi-calculator/identity"
+	"bmi-calculator/listen"
+	"bmi-calculator/logging"
+	"bmi-calculator/profiling"
+	"bmi-calculator/respond"
+
+	"chaos"
+	"config"
+	"middleware"
+
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type HealthStatus struct {
@@ -28,37 +42,88 @@ type SystemInfo struct {
 }
 
 type ServiceCheck struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
-	URL    string `json:"url,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	StatusCode int      `json:"status_code,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	ErrorRatio *float64 `json:"error_ratio,omitempty"`
+	UptimePct  *float64 `json:"uptime_pct,omitempty"`
+	Simulated  bool     `json:"simulated,omitempty"`
+}
+
+// downstream is a service whose /health (and optionally /metrics) is checked.
+type downstream struct {
+	Name    string
+	BaseURL string
 }
 
 var startTime = time.Now()
 
+var (
+	clientIPs = clientip.Resolver{TrustProxyHeaders: getEnv("TRUST_PROXY_HEADERS", "false") == "true"}
+
+	inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	})
+
+	uptime = newUptimeTracker(getEnvDuration("UPTIME_WINDOW", 5*time.Minute))
+)
+
 func main() {
-	r := mux.NewRouter()
+	if err := logging.Setup(getEnv("LOG_FILE", ""), getEnvInt("LOG_MAX_SIZE_MB", 100), getEnvInt("LOG_MAX_BACKUPS", 3), getEnv("LOG_CONSOLE", "true") == "true"); err != nil {
+		log.Fatalf("Invalid LOG_FILE: %v", err)
+	}
+	profiling.Start(getEnv("ENABLE_PPROF", "false") == "true", getEnv("ADMIN_PORT", "6060"))
+	respond.Pretty = getEnv("PRETTY_JSON", "false") == "true"
+
+	behavior, err := chaos.Parse(getEnv("HEALTH_BEHAVIOR", string(chaos.Normal)))
+	if err != nil {
+		log.Fatalf("Invalid HEALTH_BEHAVIOR: %v", err)
+	}
+	rng, err := chaos.SeededRand(getEnv("RAND_SEED", ""))
+	if err != nil {
+		log.Fatalf("Invalid RAND_SEED: %v", err)
+	}
+	simulate := middleware.Chaos(behavior, rng, respond.Error)
 
-	r.Use(loggingMiddleware)
+	go uptime.Run(getEnvDuration("UPTIME_SAMPLE_INTERVAL", 30*time.Second))
+
+	r := mux.NewRouter()
 
-	r.HandleFunc("/health", healthHandler).Methods("GET")
-	r.HandleFunc("/health/detailed", detailedHealthHandler).Methods("GET")
-	r.HandleFunc("/health/services", servicesHealthHandler).Methods("GET")
+	jitter := healthJitter(getEnvInt("HEALTH_JITTER_MS", 0), rng)
+	r.Handle("/health", jitter(simulate(http.HandlerFunc(healthHandler)))).Methods("GET")
+	r.Handle("/health/detailed", simulate(http.HandlerFunc(detailedHealthHandler))).Methods("GET")
+	r.Handle("/health/services", simulate(http.HandlerFunc(servicesHealthHandler))).Methods("GET")
 	r.HandleFunc("/ready", readinessHandler).Methods("GET")
 	r.HandleFunc("/live", livenessHandler).Methods("GET")
+	r.HandleFunc("/livez", kubeProbe("livez", livezChecks)).Methods("GET")
+	r.HandleFunc("/readyz", kubeProbe("readyz", readyzChecks)).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.Handle("/config", config.Handler(respond.JSON)).Methods("GET")
+	r.Handle("/whoami", identity.Handler("health-service")).Methods("GET")
+	r.Handle("/version", identity.VersionHandler("health-service", getEnv("IMAGE_VERSION", "unknown"))).Methods("GET")
 
-	port := getEnv("PORT", "8082")
-	log.Printf("Health Service starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
-}
-
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-		log.Printf("Completed: %s %s in %v", r.Method, r.URL.Path, time.Since(start))
-	})
+	addr, err := listen.Addr(getEnv("BIND_ADDR", "0.0.0.0"), getEnv("PORT", "8082"))
+	if err != nil {
+		log.Fatalf("Invalid listen address: %v", err)
+	}
+	log.Printf("Simulated behavior: %s", behavior)
+	log.Printf("Health Service starting on %s", addr)
+	rateLimit := getEnvFloat("RATE_LIMIT_RPS", 0)
+	limiter := middleware.NewRateLimiter(rateLimit, getEnvInt("RATE_LIMIT_BURST", 0), clientIPs.FromRequest)
+	if limiter != nil {
+		log.Printf("Rate limiting each client to %g requests/s", rateLimit)
+	}
+	shedder := middleware.NewLoadShedder(getEnvInt("MAX_CONCURRENT", 256), inFlightGauge)
+	log.Fatal(http.ListenAndServe(addr, middleware.Chain(middleware.Standard(middleware.Stack{
+		ClientIP: clientIPs.FromRequest,
+		Error:    respond.Error,
+		Metrics:  middleware.NewMetrics(prometheus.DefaultRegisterer),
+		Limiter:  limiter,
+		Shedder:  shedder,
+	})...)(r)))
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,8 +141,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	respond.JSON(w, r, http.StatusOK, status)
 }
 
 func detailedHealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -101,67 +165,92 @@ func detailedHealthHandler(w http.ResponseWriter, r *http.Request) {
 		"environment": getEnvironmentVars(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	respond.JSON(w, r, http.StatusOK, status)
 }
 
 func servicesHealthHandler(w http.ResponseWriter, r *http.Request) {
-	services := []ServiceCheck{
-		{
-			Name:   "gateway",
-			Status: checkServiceHealth("http://gateway:8080/health"),
-			URL:    "http://gateway:8080/health",
-		},
-		{
-			Name:   "bmi-service",
-			Status: checkServiceHealth("http://bmi-service:8081/health"),
-			URL:    "http://bmi-service:8081/health",
-		},
+	services := checkDownstreams(downstreams)
+	now := time.Now()
+	for i := range services {
+		if pct, ok := uptime.Percent(services[i].Name, now); ok {
+			services[i].UptimePct = &pct
+		}
 	}
 
+	simulated := applySimulatedStatuses(services)
+
 	response := map[string]interface{}{
 		"timestamp": time.Now().Format(time.RFC3339),
 		"services":  services,
 		"overall":   getOverallStatus(services),
 	}
+	if simulated {
+		response["simulated"] = true
+	}
+
+	respond.JSON(w, r, http.StatusOK, response)
+}
+
+// checkDownstream probes a service's /health and, when METRICS_SCRAPE is on, marks a
+// healthy service degraded if its scraped error ratio exceeds the threshold.
+func checkDownstream(d downstream) ServiceCheck {
+	check := ServiceCheck{Name: d.Name, URL: d.BaseURL + "/health"}
+	check.Status, check.StatusCode = checkServiceHealth(check.URL)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if !metricsScrape {
+		return check
+	}
+
+	ratio, err := scrapeErrorRatio(d.BaseURL + "/metrics")
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.ErrorRatio = &ratio
+	if check.Status == "healthy" && ratio > metricsThreshold {
+		check.Status = "degraded"
+	}
+	return check
 }
 
 func readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	respond.JSON(w, r, http.StatusOK, map[string]string{
 		"status":  "ready",
 		"service": "health-service",
 	})
 }
 
 func livenessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	respond.JSON(w, r, http.StatusOK, map[string]string{
 		"status":  "alive",
 		"service": "health-service",
 	})
 }
 
-func checkServiceHealth(url string) string {
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+// checkServiceHealth probes url and classifies the answer: 2xx is healthy, a
+// redirect or 429 is degraded (the service is up but not serving this probe
+// normally), and anything else, including no answer, is unhealthy. The status code
+// is 0 when the request failed.
+func checkServiceHealth(url string) (string, int) {
+	resp, err := probe(url)
 	if err != nil {
-		return "unhealthy"
+		return "unhealthy", 0
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		return "healthy"
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return "healthy", code
+	case code >= 300 && code < 400, code == http.StatusTooManyRequests:
+		return "degraded", code
+	default:
+		return "unhealthy", code
 	}
-	return "unhealthy"
 }
 
 func getOverallStatus(services []ServiceCheck) string {
 	for _, service := range services {
-		if service.Status == "unhealthy" {
+		if service.Status != "healthy" {
 			return "degraded"
 		}
 	}
@@ -189,7 +278,48 @@ func getMemoryStats() runtime.MemStats {
 
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
+		config.Record(key, value)
 		return value
 	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			config.Record(key, f)
+			return f
+		}
+		log.Printf("Invalid %s %q, using default %v", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err == nil && d > 0 {
+			config.Record(key, d)
+			return d
+		}
+		log.Printf("Invalid %s %q, using default %s", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			config.Record(key, n)
+			return n
+		}
+		log.Printf("Invalid %s %q, using default %d", key, value, defaultValue)
+	}
+	config.Record(key, defaultValue)
 	return defaultValue
 }
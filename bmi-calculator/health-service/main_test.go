@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckServiceHealth(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusOK, "healthy"},
+		{http.StatusMovedPermanently, "degraded"},
+		{http.StatusTooManyRequests, "degraded"},
+		{http.StatusInternalServerError, "unhealthy"},
+	}
+	for _, tt := range tests {
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.status == http.StatusMovedPermanently {
+				// Followed, this would land on a healthy page and hide the redirect
+				http.Redirect(w, r, "/elsewhere", tt.status)
+				return
+			}
+			w.WriteHeader(tt.status)
+		}))
+		status, code := checkServiceHealth(stub.URL + "/health")
+		stub.Close()
+		if status != tt.want || code != tt.status {
+			t.Errorf("downstream answering %d: checkServiceHealth() = %q, %d, want %q, %d", tt.status, status, code, tt.want, tt.status)
+		}
+	}
+
+	stub := httptest.NewServer(http.NotFoundHandler())
+	url := stub.URL
+	stub.Close()
+	if status, code := checkServiceHealth(url + "/health"); status != "unhealthy" || code != 0 {
+		t.Errorf("unreachable downstream: checkServiceHealth() = %q, %d, want unhealthy, 0", status, code)
+	}
+}
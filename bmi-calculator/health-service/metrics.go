@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	metricsScrape    = getEnv("METRICS_SCRAPE", "false") == "true"
+	metricsName      = getEnv("METRICS_NAME", "http_requests_total")
+	metricsThreshold = getEnvFloat("METRICS_ERROR_THRESHOLD", 0.1)
+)
+
+// scrapeErrorRatio fetches a downstream's Prometheus endpoint and returns the share of
+// the configured request counter whose status label is 5xx. The label is "code" on
+// the shared middleware's counter and "status" on the rollouts demo app's.
+func scrapeErrorRatio(metricsURL string) (float64, error) {
+	resp, err := probe(metricsURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("metrics endpoint returned %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("parsing metrics: %w", err)
+	}
+
+	family, ok := families[metricsName]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not exposed", metricsName)
+	}
+
+	return errorRatio(family), nil
+}
+
+func errorRatio(family *dto.MetricFamily) float64 {
+	var total, errors float64
+	for _, m := range family.GetMetric() {
+		value := sampleValue(m)
+		total += value
+		for _, label := range m.GetLabel() {
+			if (label.GetName() == "code" || label.GetName() == "status") && strings.HasPrefix(label.GetValue(), "5") {
+				errors += value
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return errors / total
+}
+
+func sampleValue(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Untyped != nil:
+		return m.Untyped.GetValue()
+	default:
+		return 0
+	}
+}
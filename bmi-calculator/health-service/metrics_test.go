@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestErrorRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		want    float64
+	}{
+		{
+			name: "code label",
+			metrics: `http_requests_total{method="GET",code="200"} 10
+http_requests_total{method="POST",code="500"} 12
+`,
+			want: 12.0 / 22,
+		},
+		{
+			name: "status label",
+			metrics: `http_requests_total{method="GET",endpoint="/",status="200"} 3
+http_requests_total{method="GET",endpoint="/",status="503"} 1
+`,
+			want: 0.25,
+		},
+		{
+			name: "4xx are not errors",
+			metrics: `http_requests_total{code="404"} 5
+http_requests_total{code="200"} 5
+`,
+			want: 0,
+		},
+		{
+			name:    "no traffic",
+			metrics: "http_requests_total{code=\"500\"} 0\n",
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parser expfmt.TextParser
+			families, err := parser.TextToMetricFamilies(strings.NewReader(tt.metrics))
+			if err != nil {
+				t.Fatalf("parsing metrics: %v", err)
+			}
+			family, ok := families["http_requests_total"]
+			if !ok {
+				t.Fatal("http_requests_total not parsed")
+			}
+			if got := errorRatio(family); got != tt.want {
+				t.Errorf("errorRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// stubDownstream answers /health with 200 and /metrics with the given exposition.
+func stubDownstream(t *testing.T, metrics string) downstream {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, metrics)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return downstream{Name: "stub", BaseURL: server.URL}
+}
+
+func TestCheckDownstreamErrorRatio(t *testing.T) {
+	defer func(scrape bool, threshold float64) {
+		metricsScrape, metricsThreshold = scrape, threshold
+	}(metricsScrape, metricsThreshold)
+	metricsScrape, metricsThreshold = true, 0.1
+
+	tests := []struct {
+		name    string
+		metrics string
+		want    string
+	}{
+		{"high error ratio", "http_requests_total{code=\"200\"} 5\nhttp_requests_total{code=\"500\"} 5\n", "degraded"},
+		{"low error ratio", "http_requests_total{code=\"200\"} 99\nhttp_requests_total{code=\"500\"} 1\n", "healthy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkDownstream(stubDownstream(t, tt.metrics))
+			if check.Status != tt.want {
+				t.Errorf("status = %q, want %q", check.Status, tt.want)
+			}
+			if check.ErrorRatio == nil {
+				t.Fatal("error_ratio missing from the check")
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// simulatedStatuses force the reported status of named downstreams on
+// /health/services, so a degraded aggregate can be shown without breaking a
+// backend. Readiness and uptime keep using the real probe results.
+var simulatedStatuses = parseSimulatedStatuses(getEnv("HEALTH_SIMULATE", ""))
+
+// parseSimulatedStatuses reads "name=status" pairs separated by commas, e.g.
+// "bmi-service=unhealthy". Entries with an unknown status are skipped.
+func parseSimulatedStatuses(spec string) map[string]string {
+	statuses := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, status, ok := strings.Cut(entry, "=")
+		name, status = strings.TrimSpace(name), strings.TrimSpace(status)
+		if !ok || name == "" || (status != "healthy" && status != "degraded" && status != "unhealthy") {
+			log.Printf("Ignoring invalid simulated status %q, expected name=healthy|degraded|unhealthy", entry)
+			continue
+		}
+		statuses[name] = status
+		log.Printf("Simulating %s as %s on /health/services", name, status)
+	}
+	return statuses
+}
+
+// applySimulatedStatuses overrides the checks named in HEALTH_SIMULATE and
+// reports whether any was overridden.
+func applySimulatedStatuses(services []ServiceCheck) bool {
+	simulated := false
+	for i := range services {
+		if status, ok := simulatedStatuses[services[i].Name]; ok {
+			services[i].Status = status
+			services[i].Simulated = true
+			simulated = true
+		}
+	}
+	return simulated
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimulatedOutage(t *testing.T) {
+	defer func(old []downstream) { downstreams = old }(downstreams)
+	defer func(old map[string]string) { simulatedStatuses = old }(simulatedStatuses)
+	defer func(old bool) { metricsScrape = old }(metricsScrape)
+	metricsScrape = false
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	downstreams = []downstream{{Name: "gateway", BaseURL: up.URL}, {Name: "bmi-service", BaseURL: up.URL}}
+
+	tests := []struct {
+		name      string
+		spec      string
+		overall   string
+		simulated bool
+	}{
+		{"not set", "", "healthy", false},
+		{"bmi-service forced unhealthy", "bmi-service=unhealthy", "degraded", true},
+		{"invalid entries ignored", "bmi-service=broken, =unhealthy", "healthy", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simulatedStatuses = parseSimulatedStatuses(tt.spec)
+			rec := httptest.NewRecorder()
+			servicesHealthHandler(rec, httptest.NewRequest(http.MethodGet, "/health/services", nil))
+			var body struct {
+				Overall   string         `json:"overall"`
+				Simulated bool           `json:"simulated"`
+				Services  []ServiceCheck `json:"services"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Overall != tt.overall || body.Simulated != tt.simulated {
+				t.Errorf("overall %q, simulated %v, want %q and %v", body.Overall, body.Simulated, tt.overall, tt.simulated)
+			}
+			for _, s := range body.Services {
+				forced := tt.simulated && s.Name == "bmi-service"
+				if s.Simulated != forced || (forced && s.Status != "unhealthy") || (!forced && s.Status != "healthy") {
+					t.Errorf("%s = %s, simulated %v", s.Name, s.Status, s.Simulated)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// probeUserAgent lets downstreams tell health-service probes apart from real traffic
+	probeUserAgent = "health-service/" + getEnv("IMAGE_VERSION", "unknown")
+	probeHeaders   = parseProbeHeaders(getEnv("HEALTH_PROBE_HEADERS", ""))
+)
+
+// probeClient does not follow redirects, so a probe reports the status the
+// downstream actually answered with.
+var probeClient = &http.Client{
+	Timeout: 2 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// parseProbeHeaders reads "Name=value" pairs separated by commas, e.g.
+// "X-Synthetic=true,Authorization=Bearer abc". Entries without a name are skipped.
+func parseProbeHeaders(spec string) http.Header {
+	headers := make(http.Header)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			log.Printf("Ignoring invalid probe header %q, expected Name=value", entry)
+			continue
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers
+}
+
+// probe sends a GET to a downstream with the probe user agent and any
+// HEALTH_PROBE_HEADERS, which may override the user agent too.
+func probe(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", probeUserAgent)
+	for name, values := range probeHeaders {
+		req.Header[name] = values
+	}
+	return probeClient.Do(req)
+}
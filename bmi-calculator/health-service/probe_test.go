@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeHeaders(t *testing.T) {
+	defer func(ua string, headers http.Header) { probeUserAgent, probeHeaders = ua, headers }(probeUserAgent, probeHeaders)
+	probeUserAgent = "health-service/1.2.3"
+
+	var got http.Header
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer stub.Close()
+
+	tests := []struct {
+		name string
+		spec string
+		want map[string]string
+	}{
+		{"user agent only", "", map[string]string{"User-Agent": "health-service/1.2.3"}},
+		{"extra headers", "X-Synthetic=true, Authorization=Bearer abc, =skipped, bogus", map[string]string{
+			"User-Agent":    "health-service/1.2.3",
+			"X-Synthetic":   "true",
+			"Authorization": "Bearer abc",
+		}},
+		{"user agent overridden", "User-Agent=synthetic-probe", map[string]string{"User-Agent": "synthetic-probe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probeHeaders = parseProbeHeaders(tt.spec)
+			resp, err := probe(stub.URL + "/health")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			for name, want := range tt.want {
+				if got.Get(name) != want {
+					t.Errorf("%s = %q, want %q", name, got.Get(name), want)
+				}
+			}
+		})
+	}
+}
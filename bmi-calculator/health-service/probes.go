@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// namedCheck is one line of a Kubernetes-style /livez or /readyz report.
+type namedCheck struct {
+	name string
+	err  error
+}
+
+// livezChecks only cover the process itself: a liveness probe that depends on
+// downstreams restarts healthy pods whenever a neighbour is down.
+func livezChecks() []namedCheck {
+	return []namedCheck{{name: "ping"}}
+}
+
+// readyzChecks add one check per downstream, failing when it is unhealthy;
+// degraded still answers and counts as ready.
+func readyzChecks() []namedCheck {
+	checks := livezChecks()
+	for _, c := range checkDownstreams(downstreams) {
+		check := namedCheck{name: "downstream-" + c.Name}
+		if c.Status == "unhealthy" {
+			if c.StatusCode != 0 {
+				check.err = fmt.Errorf("%s returned %d", c.URL, c.StatusCode)
+			} else {
+				check.err = fmt.Errorf("%s unreachable", c.URL)
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// kubeProbe serves checks the way kube-apiserver serves /livez and /readyz: plain
+// text "ok" when everything passes, or one "[+]name ok" / "[-]name failed: reason"
+// line per check with ?verbose or whenever a check fails, then a summary line.
+// Any failure answers 503.
+func kubeProbe(probe string, checks func() []namedCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results := checks()
+		failed := false
+		for _, c := range results {
+			if c.err != nil {
+				failed = true
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		status := http.StatusOK
+		if failed {
+			status = http.StatusServiceUnavailable
+		}
+
+		_, verbose := r.URL.Query()["verbose"]
+		if !verbose && !failed {
+			w.WriteHeader(status)
+			fmt.Fprint(w, "ok")
+			return
+		}
+
+		var b strings.Builder
+		for _, c := range results {
+			if c.err != nil {
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", c.name, c.err)
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", c.name)
+			}
+		}
+		if failed {
+			fmt.Fprintf(&b, "%s check failed\n", probe)
+		} else {
+			fmt.Fprintf(&b, "%s check passed\n", probe)
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, b.String())
+	}
+}
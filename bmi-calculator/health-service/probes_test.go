@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKubeProbe(t *testing.T) {
+	healthy := func() []namedCheck {
+		return []namedCheck{{name: "ping"}, {name: "downstream-gateway"}}
+	}
+	failing := func() []namedCheck {
+		return []namedCheck{{name: "ping"}, {name: "downstream-gateway", err: errors.New("http://gateway:8080/health returned 500")}}
+	}
+
+	tests := []struct {
+		name   string
+		checks func() []namedCheck
+		path   string
+		status int
+		body   string
+	}{
+		{"healthy terse", healthy, "/readyz", http.StatusOK, "ok"},
+		{"healthy verbose", healthy, "/readyz?verbose", http.StatusOK,
+			"[+]ping ok\n[+]downstream-gateway ok\nreadyz check passed\n"},
+		// A failure is always spelled out, verbose or not
+		{"failing terse", failing, "/readyz", http.StatusServiceUnavailable,
+			"[+]ping ok\n[-]downstream-gateway failed: http://gateway:8080/health returned 500\nreadyz check failed\n"},
+		{"failing verbose", failing, "/readyz?verbose=1", http.StatusServiceUnavailable,
+			"[+]ping ok\n[-]downstream-gateway failed: http://gateway:8080/health returned 500\nreadyz check failed\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			kubeProbe("readyz", tt.checks)(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status || rec.Body.String() != tt.body {
+				t.Errorf("%s = %d %q, want %d %q", tt.path, rec.Code, rec.Body, tt.status, tt.body)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("Content-Type = %q, want plain text", ct)
+			}
+		})
+	}
+}
+
+func TestReadyzChecksMapDownstreams(t *testing.T) {
+	defer func(old []downstream) { downstreams = old }(downstreams)
+	defer func(old bool) { metricsScrape = old }(metricsScrape)
+	metricsScrape = false
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	downstreams = []downstream{{Name: "gateway", BaseURL: up.URL}, {Name: "bmi-service", BaseURL: down.URL}}
+
+	checks := readyzChecks()
+	if len(checks) != 3 || checks[0].name != "ping" || checks[1].name != "downstream-gateway" || checks[2].name != "downstream-bmi-service" {
+		t.Fatalf("checks = %v, want ping then one per downstream", checks)
+	}
+	if checks[1].err != nil {
+		t.Errorf("healthy gateway check failed: %v", checks[1].err)
+	}
+	if checks[2].err == nil || !strings.Contains(checks[2].err.Error(), "returned 500") {
+		t.Errorf("bmi-service check error = %v, want it to report the 500", checks[2].err)
+	}
+	for _, c := range livezChecks() {
+		if c.name != "ping" {
+			t.Errorf("livez includes %s, want only the process's own checks", c.name)
+		}
+	}
+}
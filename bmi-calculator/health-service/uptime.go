@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var uptimeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "downstream_uptime_percent",
+	Help: "Share of background probes that found the downstream up over UPTIME_WINDOW",
+}, []string{"service"})
+
+type uptimeSample struct {
+	at time.Time
+	up bool
+}
+
+// uptimeTracker keeps the probe results of each downstream seen within window,
+// oldest first.
+type uptimeTracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples map[string][]uptimeSample
+}
+
+func newUptimeTracker(window time.Duration) *uptimeTracker {
+	return &uptimeTracker{window: window, samples: make(map[string][]uptimeSample)}
+}
+
+// Record stores one round of checks taken at now. Services missing from checks
+// have left the downstream list and are forgotten, metric included.
+func (t *uptimeTracker) Record(checks []ServiceCheck, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]bool, len(checks))
+	for _, c := range checks {
+		seen[c.Name] = true
+		// degraded still answers, so only unhealthy counts against uptime
+		samples := append(t.samples[c.Name], uptimeSample{at: now, up: c.Status != "unhealthy"})
+		t.samples[c.Name] = trimSamples(samples, now.Add(-t.window))
+		uptimeGauge.WithLabelValues(c.Name).Set(percentUp(t.samples[c.Name]))
+	}
+	for name := range t.samples {
+		if !seen[name] {
+			delete(t.samples, name)
+			uptimeGauge.DeleteLabelValues(name)
+		}
+	}
+}
+
+// Percent returns the share of name's samples within the window that were up, and
+// false when there are none yet.
+func (t *uptimeTracker) Percent(name string, now time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples := trimSamples(t.samples[name], now.Add(-t.window))
+	if len(samples) == 0 {
+		return 0, false
+	}
+	return percentUp(samples), true
+}
+
+// Run records a round of checks of every downstream each interval, forever.
+func (t *uptimeTracker) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		t.Record(checkDownstreams(downstreams), time.Now())
+	}
+}
+
+// trimSamples drops the samples taken before cutoff.
+func trimSamples(samples []uptimeSample, cutoff time.Time) []uptimeSample {
+	i := 0
+	for i < len(samples) && samples[i].at.Before(cutoff) {
+		i++
+	}
+	return samples[i:]
+}
+
+func percentUp(samples []uptimeSample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	up := 0
+	for _, s := range samples {
+		if s.up {
+			up++
+		}
+	}
+	return 100 * float64(up) / float64(len(samples))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUptimeTracker(t *testing.T) {
+	tracker := newUptimeTracker(5 * time.Minute)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// One sample a minute: gateway is down for 2 of 8, bmi-service only degraded
+	gateway := []string{"healthy", "unhealthy", "healthy", "healthy", "unhealthy", "healthy", "healthy", "healthy"}
+	for i, status := range gateway {
+		tracker.Record([]ServiceCheck{
+			{Name: "gateway", Status: status},
+			{Name: "bmi-service", Status: "degraded"},
+		}, start.Add(time.Duration(i)*time.Minute))
+	}
+	now := start.Add(7 * time.Minute)
+
+	// The window holds minutes 2..7: five up, one down at minute 4
+	want := 100 * 5.0 / 6
+	if got, ok := tracker.Percent("gateway", now); !ok || got != want {
+		t.Errorf("gateway uptime = %v, %v, want %v", got, ok, want)
+	}
+	if got := testutil.ToFloat64(uptimeGauge.WithLabelValues("gateway")); got != want {
+		t.Errorf("gateway gauge = %v, want %v", got, want)
+	}
+	if got, ok := tracker.Percent("bmi-service", now); !ok || got != 100 {
+		t.Errorf("degraded bmi-service uptime = %v, %v, want 100", got, ok)
+	}
+	if _, ok := tracker.Percent("gateway", now.Add(time.Hour)); ok {
+		t.Error("uptime reported once every sample left the window")
+	}
+
+	// bmi-service leaves the downstream list
+	tracker.Record([]ServiceCheck{{Name: "gateway", Status: "healthy"}}, now.Add(time.Minute))
+	if _, ok := tracker.Percent("bmi-service", now.Add(time.Minute)); ok {
+		t.Error("removed service still tracked")
+	}
+	if n := testutil.CollectAndCount(uptimeGauge); n != 1 {
+		t.Errorf("uptime gauge has %d series, want only gateway's", n)
+	}
+}
@@ -0,0 +1,73 @@
+// Package identity reports which pod served a request and what version it runs,
+// to follow traffic across replicas during a rollout.
+package identity
+
+import (
+	"net/http"
+	"os"
+	"runtime"
+
+	"bmi-calculator/respond"
+)
+
+// Info identifies the running pod. Fields other than Hostname come from the
+// downward API variables POD_IP, NODE_NAME and NAMESPACE, and are "unknown" when
+// those are unset.
+type Info struct {
+	Service   string `json:"service"`
+	Hostname  string `json:"hostname"`
+	PodIP     string `json:"pod_ip"`
+	NodeName  string `json:"node_name"`
+	Namespace string `json:"namespace"`
+}
+
+// Current returns the identity of this process.
+func Current(service string) Info {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return Info{
+		Service:   service,
+		Hostname:  hostname,
+		PodIP:     envOrUnknown("POD_IP"),
+		NodeName:  envOrUnknown("NODE_NAME"),
+		Namespace: envOrUnknown("NAMESPACE"),
+	}
+}
+
+// Handler serves Current as JSON.
+func Handler(service string) http.Handler {
+	info := Current(service)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond.JSON(w, r, http.StatusOK, info)
+	})
+}
+
+// Version is what a service reports on /version, to check which revision a
+// replica runs during a rollout.
+type Version struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewVersion returns the Version of this process; version is usually IMAGE_VERSION.
+func NewVersion(service, version string) Version {
+	return Version{Service: service, Version: version, GoVersion: runtime.Version()}
+}
+
+// VersionHandler serves NewVersion as JSON.
+func VersionHandler(service, version string) http.Handler {
+	v := NewVersion(service, version)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond.JSON(w, r, http.StatusOK, v)
+	})
+}
+
+func envOrUnknown(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return "unknown"
+}
@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Info
+	}{
+		{
+			name: "downward API set",
+			env:  map[string]string{"POD_IP": "10.1.2.3", "NODE_NAME": "node-a", "NAMESPACE": "bmi"},
+			want: Info{Service: "gateway", Hostname: hostname, PodIP: "10.1.2.3", NodeName: "node-a", Namespace: "bmi"},
+		},
+		{
+			name: "downward API unset",
+			env:  map[string]string{"POD_IP": "", "NODE_NAME": "", "NAMESPACE": ""},
+			want: Info{Service: "gateway", Hostname: hostname, PodIP: "unknown", NodeName: "unknown", Namespace: "unknown"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			rec := httptest.NewRecorder()
+			Handler("gateway").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+			var got Info
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("/whoami = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Package listen builds the address a service's HTTP server binds to.
+package listen
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Addr joins BIND_ADDR and PORT into a listen address. bind must be an IP
+// literal, such as 0.0.0.0 for every interface or 127.0.0.1 to accept only
+// connections from inside the pod.
+func Addr(bind, port string) (string, error) {
+	if net.ParseIP(bind) == nil {
+		return "", fmt.Errorf("bind address %q is not an IP address", bind)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("port %q is not a valid port number", port)
+	}
+	return net.JoinHostPort(bind, port), nil
+}
@@ -0,0 +1,77 @@
+package listen
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAddr(t *testing.T) {
+	tests := []struct {
+		bind, port string
+		want       string // "" when Addr must fail
+	}{
+		{"0.0.0.0", "8080", "0.0.0.0:8080"},
+		{"127.0.0.1", "0", "127.0.0.1:0"},
+		{"::1", "8080", "[::1]:8080"},
+		{"localhost", "8080", ""},
+		{"", "8080", ""},
+		{"127.0.0.1", "http", ""},
+		{"127.0.0.1", "65536", ""},
+	}
+	for _, tt := range tests {
+		got, err := Addr(tt.bind, tt.port)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("Addr(%q, %q) = %q, want an error", tt.bind, tt.port, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Addr(%q, %q) = %q, %v, want %q", tt.bind, tt.port, got, err, tt.want)
+		}
+	}
+}
+
+// otherAddr returns a non-loopback IPv4 address of this host, or "" if it has none.
+func otherAddr() string {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.String()
+		}
+	}
+	return ""
+}
+
+func TestLoopbackBind(t *testing.T) {
+	addr, err := Addr("127.0.0.1", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})}
+	go server.Serve(l)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get("http://127.0.0.1:" + port + "/")
+	if err != nil {
+		t.Fatalf("server bound to 127.0.0.1 unreachable there: %v", err)
+	}
+	resp.Body.Close()
+
+	other := otherAddr()
+	if other == "" {
+		t.Skip("no non-loopback address to check the bind against")
+	}
+	if resp, err := client.Get("http://" + net.JoinHostPort(other, port) + "/"); err == nil {
+		resp.Body.Close()
+		t.Errorf("server bound to 127.0.0.1 answered on %s", other)
+	}
+}
@@ -0,0 +1,127 @@
+// Package logging points the standard logger at the console, a size-rotated
+// file, or both, for environments without a log collector.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an io.Writer appending to a file that is rotated once it would
+// grow past maxBytes: path becomes path.1, path.1 becomes path.2 and so on, and
+// backups beyond maxBackups are removed. It is safe for concurrent use.
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending. A maxBytes of zero disables rotation.
+func OpenRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	if rf.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(rf.path, 0); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+// CheckWritable reports whether writes still land where they should, without
+// writing to the file: it must still open for appending, which catches one that was
+// deleted or made read-only since, and when rotation renames backups its directory
+// must accept a new file too, which permission bits alone miss on read-only mounts.
+func (rf *RotatingFile) CheckWritable() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if rf.maxBytes == 0 || rf.maxBackups == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(rf.path), ".rotate-check-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// Close closes the underlying file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+// Setup sends the standard logger to path, rotated at maxSizeMB, and keeps the
+// console (stderr, the logger's default) as well when console is set. An empty
+// path leaves logging untouched.
+func Setup(path string, maxSizeMB, maxBackups int, console bool) error {
+	if path == "" {
+		return nil
+	}
+	rf, err := OpenRotatingFile(path, int64(maxSizeMB)<<20, maxBackups)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = rf
+	if console {
+		out = io.MultiWriter(os.Stderr, rf)
+	}
+	log.SetOutput(out)
+	return nil
+}
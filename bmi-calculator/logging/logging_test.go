@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lines reads path, or nil when it doesn't exist.
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := OpenRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	// 35 ten-byte lines fill the file three times over, so the oldest are rotated out
+	for i := 0; i < 35; i++ {
+		fmt.Fprintf(rf, "line %04d\n", i)
+	}
+
+	want := map[string][2]int{ // first and last line in each file
+		path:        {30, 34},
+		path + ".1": {20, 29},
+		path + ".2": {10, 19},
+	}
+	for file, span := range want {
+		got := lines(t, file)
+		if len(got) != span[1]-span[0]+1 || got[0] != fmt.Sprintf("line %04d", span[0]) || got[len(got)-1] != fmt.Sprintf("line %04d", span[1]) {
+			t.Errorf("%s holds %q, want lines %d to %d", filepath.Base(file), got, span[0], span[1])
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most LOG_MAX_BACKUPS=2 backups", filepath.Base(path))
+	}
+}
+
+func TestRotationWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := OpenRotatingFile(path, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for i := 0; i < 15; i++ {
+		fmt.Fprintf(rf, "line %04d\n", i)
+	}
+	if got := lines(t, path); len(got) != 5 || got[0] != "line 0010" {
+		t.Errorf("app.log holds %q, want it truncated to the last 5 lines", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("app.log.1 exists with LOG_MAX_BACKUPS=0")
+	}
+}
+
+func TestReopenCountsExistingSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 95)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := OpenRotatingFile(path, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	fmt.Fprint(rf, "new line\n")
+	if got := lines(t, path); len(got) != 1 || got[0] != "new line" {
+		t.Errorf("app.log holds %q, want only the new line after rotating the full file", got)
+	}
+	if got := lines(t, path+".1"); len(got) != 1 || len(got[0]) != 95 {
+		t.Errorf("app.log.1 holds %q, want the line that was already there", got)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rf, err := OpenRotatingFile(path, 1000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	const writers, perWriter = 10, 100
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				fmt.Fprintf(rf, "writer %d line %03d\n", w, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	files, _ := filepath.Glob(path + "*")
+	for _, file := range files {
+		for _, line := range lines(t, file) {
+			var w, i int
+			if n, _ := fmt.Sscanf(line, "writer %d line %d", &w, &i); n != 2 {
+				t.Fatalf("%s has a torn line %q", filepath.Base(file), line)
+			}
+			total++
+		}
+	}
+	if total != writers*perWriter {
+		t.Errorf("%d lines across %d files, want %d", total, len(files), writers*perWriter)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	if err := Setup("", 1, 1, false); err != nil {
+		t.Errorf("Setup with no LOG_FILE: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := Setup(path, 1, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	log.Print("to the file")
+	if got := lines(t, path); len(got) != 1 || !strings.HasSuffix(got[0], "to the file") {
+		t.Errorf("app.log holds %q, want the logged line", got)
+	}
+
+	if err := Setup(filepath.Join(t.TempDir(), "missing", "app.log"), 1, 1, false); err == nil {
+		t.Error("Setup succeeded with a LOG_FILE in a directory that doesn't exist")
+	}
+}
@@ -0,0 +1,33 @@
+// Package profiling exposes net/http/pprof on a dedicated admin listener so
+// profiles are never reachable through a service's public port.
+package profiling
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Handler returns a mux serving the pprof endpoints under /debug/pprof/.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Start serves Handler on the given port in the background when enabled.
+func Start(enabled bool, port string) {
+	if !enabled {
+		return
+	}
+	go func() {
+		log.Printf("pprof listening on admin port %s", port)
+		if err := http.ListenAndServe(":"+port, Handler()); err != nil {
+			log.Printf("pprof server error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,60 @@
+package profiling
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing is listening on.
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+// getGoroutines fetches the goroutine profile from port, retrying briefly while
+// the listener comes up.
+func getGoroutines(port string) (*http.Response, error) {
+	client := &http.Client{Timeout: time.Second}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://127.0.0.1:" + port + "/debug/pprof/goroutine?debug=1"); err == nil {
+			return resp, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, err
+}
+
+func TestStart(t *testing.T) {
+	port := freePort(t)
+	Start(true, port)
+	resp, err := getGoroutines(port)
+	if err != nil {
+		t.Fatalf("pprof enabled but unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	io.Copy(&body, resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body.String(), "goroutine profile") {
+		t.Errorf("GET /debug/pprof/goroutine = %d, want the goroutine profile", resp.StatusCode)
+	}
+
+	port = freePort(t)
+	Start(false, port)
+	time.Sleep(50 * time.Millisecond)
+	if resp, err := http.Get("http://127.0.0.1:" + port + "/debug/pprof/goroutine"); err == nil {
+		resp.Body.Close()
+		t.Errorf("pprof disabled but the admin port answered %d", resp.StatusCode)
+	}
+}
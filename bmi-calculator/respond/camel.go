@@ -0,0 +1,80 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// CamelCase renders object keys in camelCase instead of the snake_case the
+// struct tags use, as JSON_CASE=camel does, for client stacks that expect it.
+// Only keys made of lowercase letters, digits and underscores are converted;
+// values are never touched.
+var CamelCase bool
+
+// Marshal is json.Marshal honoring CamelCase, for responses that are not written
+// through JSON, such as stream events.
+func Marshal(v interface{}) ([]byte, error) {
+	if CamelCase {
+		var err error
+		if v, err = camelKeys(v); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// camelKeys round-trips v through JSON so struct tags, omitempty and custom
+// marshalers are applied first, then renames the keys of every object in it.
+// Numbers stay json.Number, so they come out exactly as they went in.
+func camelKeys(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return renameKeys(generic), nil
+}
+
+func renameKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			renamed[snakeToCamel(key)] = renameKeys(value)
+		}
+		return renamed
+	case []interface{}:
+		for i, value := range v {
+			v[i] = renameKeys(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// snakeToCamel turns bmr_kcal into bmrKcal. Keys that aren't plain snake_case,
+// like "GET /calculate" or "BMI_STANDARD", are returned as they are.
+func snakeToCamel(key string) string {
+	if !strings.Contains(key, "_") || strings.HasPrefix(key, "_") || strings.HasSuffix(key, "_") {
+		return key
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return key
+		}
+	}
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,61 @@
+package respond
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCamelCase(t *testing.T) {
+	defer func(old bool) { CamelCase = old }(CamelCase)
+	type recommendation struct {
+		BMRKcal    float64 `json:"bmr_kcal"`
+		TDEEKcal   int     `json:"tdee_kcal"`
+		Category   string  `json:"category"`
+		MaybeEmpty string  `json:"maybe_empty,omitempty"`
+	}
+	payload := map[string]interface{}{
+		"user_id":   "u_1",
+		"endpoints": map[string]int{"GET /history/{user_id}": 2},
+		"results":   []recommendation{{BMRKcal: 1649.25, TDEEKcal: 2556, Category: "Normal_weight"}},
+	}
+
+	for _, tt := range []struct {
+		camel bool
+		want  string
+	}{
+		{false, `{"endpoints":{"GET /history/{user_id}":2},"results":[{"bmr_kcal":1649.25,"tdee_kcal":2556,"category":"Normal_weight"}],"user_id":"u_1"}` + "\n"},
+		// Values, and keys that aren't plain snake_case, are left as they are
+		{true, `{"endpoints":{"GET /history/{user_id}":2},"results":[{"bmrKcal":1649.25,"category":"Normal_weight","tdeeKcal":2556}],"userId":"u_1"}` + "\n"},
+	} {
+		CamelCase = tt.camel
+		rec := httptest.NewRecorder()
+		JSON(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, payload)
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("CamelCase=%v: JSON() = %s, want %s", tt.camel, got, tt.want)
+		}
+		marshaled, err := Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(marshaled) + "\n"; got != tt.want {
+			t.Errorf("CamelCase=%v: Marshal() = %s, want %s", tt.camel, got, tt.want)
+		}
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	for key, want := range map[string]string{
+		"bmi":          "bmi",
+		"bmr_kcal":     "bmrKcal",
+		"client_ip_v4": "clientIpV4",
+		"_private":     "_private",
+		"trailing_":    "trailing_",
+		"BMI_STANDARD": "BMI_STANDARD",
+		"GET /x_y":     "GET /x_y",
+	} {
+		if got := snakeToCamel(key); got != want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package respond writes JSON responses, errors included, the same way in every
+// service.
+package respond
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Pretty makes responses indented by default, as PRETTY_JSON=true does. A request
+// can still choose with ?pretty=true or ?pretty=false.
+var Pretty bool
+
+// maxPooledBuffer stops a single large batch response from pinning a big buffer
+// in the pool.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// JSON encodes v into a pooled buffer before writing, so large responses reuse
+// memory and carry an exact Content-Length. The Content-Type is application/json
+// whether or not the output is indented.
+func JSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	enc := json.NewEncoder(buf)
+	if pretty(r) {
+		enc.SetIndent("", "  ")
+	}
+	var err error
+	if CamelCase {
+		v, err = camelKeys(v)
+	}
+	if err == nil {
+		err = enc.Encode(v)
+	}
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":500,"code":"encoding_failed","error":"failed to encode response"}` + "\n"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// ErrorBody is the shape of every error response. Code is a stable snake_case
+// identifier clients can match on; Message is meant for people.
+type ErrorBody struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// Error writes an ErrorBody with the given status.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	JSON(w, r, status, ErrorBody{Status: status, Code: code, Message: message})
+}
+
+func pretty(r *http.Request) bool {
+	if r == nil {
+		return Pretty
+	}
+	if value, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+		return value
+	}
+	return Pretty
+}
@@ -0,0 +1,150 @@
+package respond
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// discardWriter is a ResponseWriter that keeps nothing, so benchmarks measure
+// the encoding rather than a recorder growing its buffer.
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// batchPayload resembles a bmi-service batch response of n results.
+func batchPayload(n int) map[string]interface{} {
+	results := make([]map[string]interface{}, n)
+	for i := range results {
+		results[i] = map[string]interface{}{
+			"index": i,
+			"calculation": map[string]interface{}{
+				"weight": 70.0, "height": 1.75, "bmi": 22.86, "category": "Normal weight",
+				"timestamp": "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+	return map[string]interface{}{"results": results, "errors": []interface{}{}}
+}
+
+// encodeUnpooled is JSON without the pool: a new buffer per response, grown
+// from empty every time, to get the same exact Content-Length.
+func encodeUnpooled(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty(r) {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// BenchmarkJSON compares pooled buffers with a fresh one per response; run with
+// -benchmem to see the allocations the pool saves.
+func BenchmarkJSON(b *testing.B) {
+	payload := batchPayload(50)
+	r := httptest.NewRequest(http.MethodPost, "/calculate/batch", nil)
+	w := &discardWriter{header: make(http.Header)}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			JSON(w, r, http.StatusOK, payload)
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			encodeUnpooled(w, r, http.StatusOK, payload)
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JSON(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusCreated, map[string]int{"count": 3})
+	if rec.Code != http.StatusCreated || rec.Body.String() != "{\"count\":3}\n" {
+		t.Errorf("JSON() = %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Content-Length = %s for a %d-byte body", got, rec.Body.Len())
+	}
+}
+
+func TestJSONEncodingFailure(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JSON(rec, nil, http.StatusOK, map[string]float64{"bmi": math.NaN()})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d for an unencodable value, want 500", rec.Code)
+	}
+
+	// Whatever was half-encoded into the pooled buffer must not leak into the next response
+	rec = httptest.NewRecorder()
+	JSON(rec, nil, http.StatusOK, map[string]string{"status": "ok"})
+	if rec.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("response after a failed encode = %q", rec.Body)
+	}
+}
+
+func TestJSONPretty(t *testing.T) {
+	defer func(old bool) { Pretty = old }(Pretty)
+	payload := map[string]interface{}{"bmi": 22.86, "category": map[string]string{"name": "Normal weight"}}
+
+	tests := []struct {
+		name   string
+		def    bool
+		path   string
+		indent bool
+	}{
+		{"compact by default", false, "/", false},
+		{"pretty on request", false, "/?pretty=true", true},
+		{"PRETTY_JSON default", true, "/", true},
+		{"request opts out", true, "/?pretty=false", false},
+		{"unparsable value keeps the default", false, "/?pretty=yes", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Pretty = tt.def
+			rec := httptest.NewRecorder()
+			JSON(rec, httptest.NewRequest(http.MethodGet, tt.path, nil), http.StatusOK, payload)
+
+			body := strings.TrimSuffix(rec.Body.String(), "\n")
+			if indented := strings.Contains(body, "\n  \""); indented != tt.indent {
+				t.Errorf("indented = %v, want %v in %q", indented, tt.indent, body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil || decoded["bmi"] != 22.86 {
+				t.Errorf("body does not decode to the payload: %v, %v", decoded, err)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusNotFound, "not_found", "no calculations for user 42")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	want := `{"status":404,"code":"not_found","error":"no calculations for user 42"}` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("body = %s, want %s", rec.Body, want)
+	}
+}
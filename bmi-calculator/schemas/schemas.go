@@ -0,0 +1,182 @@
+// Package schemas embeds the JSON Schemas describing the services' request
+// bodies and validates payloads against them.
+//
+// Only the subset of JSON Schema used by the embedded files is supported:
+// type, required, properties, additionalProperties, enum, minimum,
+// exclusiveMinimum, maximum and exclusiveMaximum.
+package schemas
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed *.json
+var files embed.FS
+
+// CalculateRequest is the schema for bmi-service's POST /calculate body.
+var CalculateRequest = MustLoad("calculate_request.json")
+
+type Schema struct {
+	Type                 string             `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum"`
+}
+
+// Violation describes one way a payload breaks its schema.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func Load(name string) (*Schema, error) {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing schema %s: %w", name, err)
+	}
+	return &s, nil
+}
+
+func MustLoad(name string) *Schema {
+	s, err := Load(name)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate checks a raw JSON document and returns every violation found, or
+// nil when the document conforms.
+func (s *Schema) Validate(data []byte) []Violation {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []Violation{{Field: "", Message: "body must be valid JSON: " + err.Error()}}
+	}
+	var violations []Violation
+	s.validate("", doc, &violations)
+	return violations
+}
+
+func (s *Schema) validate(path string, value interface{}, violations *[]Violation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		add("must be of type %s, got %s", s.Type, typeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		add("must be one of %s", formatEnum(s.Enum))
+	}
+
+	if n, ok := value.(float64); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			add("must be >= %v", *s.Minimum)
+		}
+		if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+			add("must be > %v", *s.ExclusiveMinimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			add("must be <= %v", *s.Maximum)
+		}
+		if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+			add("must be < %v", *s.ExclusiveMaximum)
+		}
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, name := range s.Required {
+		if _, present := obj[name]; !present {
+			*violations = append(*violations, Violation{Field: join(path, name), Message: "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prop, known := s.Properties[name]; known {
+			prop.validate(join(path, name), obj[name], violations)
+		} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			*violations = append(*violations, Violation{Field: join(path, name), Message: "is not allowed"})
+		}
+	}
+}
+
+func hasType(value interface{}, want string) bool {
+	switch want {
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	default:
+		return typeName(value) == want
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	parts := make([]string, len(enum))
+	for i, v := range enum {
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,60 @@
+package schemas
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCalculateRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Violation
+	}{
+		{
+			name: "valid",
+			body: `{"weight": 70, "height": 1.75, "unit": "metric", "user_id": "u1"}`,
+		},
+		{
+			name: "missing fields",
+			body: `{}`,
+			want: []Violation{{"weight", "is required"}, {"height", "is required"}},
+		},
+		{
+			name: "wrong types",
+			body: `{"weight": "70", "height": true}`,
+			want: []Violation{
+				{"height", "must be of type number, got boolean"},
+				{"weight", "must be of type number, got string"},
+			},
+		},
+		{
+			name: "out of range and unknown values",
+			body: `{"weight": 0, "height": 1.75, "unit": "stone", "extra": 1}`,
+			want: []Violation{
+				{"extra", "is not allowed"},
+				{"unit", "must be one of metric, imperial"},
+				{"weight", "must be > 0"},
+			},
+		},
+		{
+			name: "not an object",
+			body: `[70, 1.75]`,
+			want: []Violation{{"", "must be of type object, got array"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateRequest.Validate([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	got := CalculateRequest.Validate([]byte(`{"weight":`))
+	if len(got) != 1 || got[0].Field != "" {
+		t.Errorf("Validate() = %v, want one violation for the whole body", got)
+	}
+}
@@ -192,8 +192,9 @@ build_image() {
     
     echo "Building $service_name image..."
     
+    # The repository root is the context, so the shared chaos, config and middleware modules are included
     cd "$APP_DIR"
-    docker build -t "${image_name}:${TAG}" -f "$dockerfile_path" .
+    docker build -t "${image_name}:${TAG}" -f "$dockerfile_path" "$SCRIPT_DIR"
     
     if [[ "$PUSH_IMAGES" == true ]]; then
         echo "Tagging $service_name for registry..."
@@ -0,0 +1,172 @@
+// Package chaos is the simulated-behavior engine behind the rollouts demo app's
+// BEHAVIOR and the BMI services' BMI_BEHAVIOR and HEALTH_BEHAVIOR: it adds latency
+// and injects errors so rollouts have something to analyse. It is a module of its
+// own so both can import it; their go.mod files replace it with this directory.
+//
+// Every random decision is drawn from a *rand.Rand the caller passes in, so a
+// generator from NewRand with a fixed seed replays the same run.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Behavior selects how requests are degraded.
+type Behavior string
+
+const (
+	Normal     Behavior = "normal"
+	Slow       Behavior = "slow"
+	ErrorProne Behavior = "error-prone"
+	Chaotic    Behavior = "chaotic"
+)
+
+// Behaviors lists every known behavior.
+var Behaviors = []Behavior{Normal, Slow, ErrorProne, Chaotic}
+
+// Known reports whether b is one of Behaviors.
+func (b Behavior) Known() bool {
+	for _, known := range Behaviors {
+		if b == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse validates a behavior name; an empty string means Normal.
+func Parse(s string) (Behavior, error) {
+	if s == "" {
+		return Normal, nil
+	}
+	if b := Behavior(s); b.Known() {
+		return b, nil
+	}
+	return "", fmt.Errorf("unknown behavior %q, expected normal, slow, error-prone or chaotic", s)
+}
+
+// Delay draws the simulated latency for one request.
+func (b Behavior) Delay(rng *rand.Rand) time.Duration {
+	switch b {
+	case Slow:
+		return time.Duration(200+rng.Intn(800)) * time.Millisecond
+	case Chaotic:
+		if rng.Float32() < 0.3 {
+			return time.Duration(500+rng.Intn(1000)) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// Status draws the simulated outcome for one request: http.StatusOK to carry on,
+// or the error status to answer with instead.
+func (b Behavior) Status(rng *rand.Rand) int {
+	switch b {
+	case ErrorProne:
+		if rng.Float32() < 0.5 {
+			return http.StatusInternalServerError
+		}
+	case Chaotic:
+		if rng.Float32() < 0.4 {
+			return http.StatusInternalServerError
+		}
+	}
+	return http.StatusOK
+}
+
+// Apply waits out the simulated latency and returns the simulated status, drawing
+// both like Delay then Status. It returns ctx's error instead if ctx ends first.
+func (b Behavior) Apply(ctx context.Context, rng *rand.Rand) (int, error) {
+	if d := b.Delay(rng); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	return b.Status(rng), nil
+}
+
+var messages = map[Behavior][]string{
+	Normal: {
+		"Service operating normally!!",
+		"All systems functional",
+		"Request processed successfully",
+	},
+	Slow: {
+		"Service is experiencing delays",
+		"Processing taking longer than usual",
+		"High latency detected",
+	},
+	ErrorProne: {
+		"Service unstable",
+		"Errors may occur",
+		"Degraded performance",
+	},
+	Chaotic: {
+		"Unpredictable behavior",
+		"System under stress",
+		"Erratic performance",
+	},
+}
+
+// Message returns one of the status messages for b.
+func (b Behavior) Message(rng *rand.Rand) string {
+	msgs := messages[b]
+	if len(msgs) == 0 {
+		return "Unknown state"
+	}
+	return msgs[rng.Intn(len(msgs))]
+}
+
+// FailFunc answers a request that Middleware failed; status is the simulated
+// error status, or http.StatusGatewayTimeout when the request's deadline passed
+// during the latency.
+type FailFunc func(w http.ResponseWriter, r *http.Request, status int)
+
+// Middleware applies b, drawing from rng, before every request reaches next.
+// Failed requests are answered by fail, or with a plain-text error when fail is
+// nil; requests whose client goes away during the latency are dropped.
+func Middleware(b Behavior, rng *rand.Rand, fail FailFunc) func(http.Handler) http.Handler {
+	if fail == nil {
+		fail = func(w http.ResponseWriter, r *http.Request, status int) {
+			http.Error(w, http.StatusText(status), status)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status, err := b.Apply(r.Context(), rng)
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				fail(w, r, http.StatusGatewayTimeout)
+			case err != nil:
+				// The client has gone away; there is nobody to answer
+			case status != http.StatusOK:
+				fail(w, r, status)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// SeededRand returns a generator for a RAND_SEED setting: seeded with the integer
+// seed when one is given, so runs repeat, else from the clock.
+func SeededRand(seed string) (*rand.Rand, error) {
+	if seed == "" {
+		return NewRand(time.Now().UnixNano()), nil
+	}
+	n, err := strconv.ParseInt(seed, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("seed %q is not an integer", seed)
+	}
+	return NewRand(n), nil
+}
@@ -0,0 +1,172 @@
+package chaos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, b := range Behaviors {
+		if got, err := Parse(string(b)); err != nil || got != b {
+			t.Errorf("Parse(%q) = %q, %v", b, got, err)
+		}
+	}
+	if got, err := Parse(""); err != nil || got != Normal {
+		t.Errorf("Parse(\"\") = %q, %v, want normal", got, err)
+	}
+	if _, err := Parse("flaky"); err == nil {
+		t.Error("Parse accepted an unknown behavior")
+	}
+}
+
+func TestBehaviors(t *testing.T) {
+	const n = 2000
+	tests := []struct {
+		behavior           Behavior
+		minDelay, maxDelay time.Duration
+		delayed, errored   [2]float64 // share of requests, min and max
+	}{
+		{Normal, 0, 0, [2]float64{0, 0}, [2]float64{0, 0}},
+		{Slow, 200 * time.Millisecond, time.Second, [2]float64{1, 1}, [2]float64{0, 0}},
+		{ErrorProne, 0, 0, [2]float64{0, 0}, [2]float64{0.45, 0.55}},
+		{Chaotic, 500 * time.Millisecond, 1500 * time.Millisecond, [2]float64{0.25, 0.35}, [2]float64{0.35, 0.45}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.behavior), func(t *testing.T) {
+			rng := NewRand(1)
+			delayed, errored := 0, 0
+			for i := 0; i < n; i++ {
+				if d := tt.behavior.Delay(rng); d > 0 {
+					delayed++
+					if d < tt.minDelay || d >= tt.maxDelay {
+						t.Fatalf("delay %v outside [%v, %v)", d, tt.minDelay, tt.maxDelay)
+					}
+				}
+				switch status := tt.behavior.Status(rng); status {
+				case http.StatusOK:
+				case http.StatusInternalServerError:
+					errored++
+				default:
+					t.Fatalf("unexpected status %d", status)
+				}
+			}
+			if share := float64(delayed) / n; share < tt.delayed[0] || share > tt.delayed[1] {
+				t.Errorf("%.2f of requests delayed, want %.2f-%.2f", share, tt.delayed[0], tt.delayed[1])
+			}
+			if share := float64(errored) / n; share < tt.errored[0] || share > tt.errored[1] {
+				t.Errorf("%.2f of requests failed, want %.2f-%.2f", share, tt.errored[0], tt.errored[1])
+			}
+		})
+	}
+}
+
+func TestApplyStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := Slow.Apply(ctx, NewRand(1)); err != context.DeadlineExceeded {
+		t.Fatalf("Apply() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Apply() took %v after its deadline", elapsed)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	for _, b := range Behaviors {
+		if msg := b.Message(NewRand(1)); msg == "" || msg == "Unknown state" {
+			t.Errorf("%s has no messages", b)
+		}
+	}
+	if msg := Behavior("flaky").Message(NewRand(1)); msg != "Unknown state" {
+		t.Errorf("unknown behavior message = %q", msg)
+	}
+}
+
+// statuses sends n requests through h and returns the status codes.
+func statuses(h http.Handler, n int) []int {
+	codes := make([]int, n)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[i] = rec.Code
+	}
+	return codes
+}
+
+func TestMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	t.Run("normal passes through", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Middleware(Normal, NewRand(1), nil)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want the handler's 204", rec.Code)
+		}
+	})
+
+	t.Run("failures go to fail", func(t *testing.T) {
+		var failed []int
+		fail := func(w http.ResponseWriter, r *http.Request, status int) {
+			failed = append(failed, status)
+			w.WriteHeader(status)
+		}
+		h := Middleware(ErrorProne, NewRand(1), fail)(next)
+		codes := statuses(h, 100)
+		errors := 0
+		for _, code := range codes {
+			if code == http.StatusInternalServerError {
+				errors++
+			} else if code != http.StatusNoContent {
+				t.Fatalf("unexpected status %d", code)
+			}
+		}
+		if errors == 0 || errors != len(failed) {
+			t.Errorf("%d requests failed, fail saw %d", errors, len(failed))
+		}
+	})
+
+	t.Run("deadline during latency is a 504", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		Middleware(Slow, NewRand(1), nil)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("status = %d, want 504", rec.Code)
+		}
+	})
+
+	t.Run("same seed gives the same failures", func(t *testing.T) {
+		first := statuses(Middleware(ErrorProne, NewRand(42), nil)(next), 50)
+		second := statuses(Middleware(ErrorProne, NewRand(42), nil)(next), 50)
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("request %d: %d with one run, %d with the other", i, first[i], second[i])
+			}
+		}
+	})
+}
+
+func TestSeededRand(t *testing.T) {
+	a, err := SeededRand("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := SeededRand("7")
+	for i := 0; i < 10; i++ {
+		if x, y := a.Int63(), b.Int63(); x != y {
+			t.Fatalf("draw %d differs for the same seed: %d, %d", i, x, y)
+		}
+	}
+	if _, err := SeededRand("seven"); err == nil {
+		t.Error("SeededRand accepted a non-integer seed")
+	}
+	if rng, err := SeededRand(""); err != nil || rng == nil {
+		t.Errorf("SeededRand(\"\") = %v, %v, want a clock-seeded generator", rng, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Package middleware holds the HTTP middleware shared by the BMI services and
+// the rollouts demo app. It is a module of its own so both can import it; their
+// go.mod files replace it with this directory.
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+// ErrorFunc answers a request the middleware turns away itself, in the
+// service's own error format. code is a short machine-readable reason such as
+// "rate_limited", for formats that carry one.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, status int, code, message string)
+
+// Logf logs one line; log.Printf is one.
+type Logf func(format string, v ...interface{})
+
+// Chain composes middleware so the first one listed is the outermost: it sees the
+// request first and the response last.
+func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
+
+// Stack is what Standard needs from each service. ClientIP resolves the address
+// logged, Error answers the requests the stack refuses, and Logf, by default
+// log.Printf, writes the logs. A nil Metrics or Limiter leaves that layer out.
+type Stack struct {
+	ClientIP func(*http.Request) string
+	Error    ErrorFunc
+	Logf     Logf
+	Metrics  *Metrics
+	Limiter  *RateLimiter
+	Shedder  *LoadShedder
+}
+
+// Standard is the stack every service wraps its router in, outermost first:
+// recovery, so a panic anywhere below still gets a 500; the request ID, so the
+// logs and everything after have one; logging; metrics, so rejected requests are
+// counted too; rate limiting; load shedding, so requests over their client's rate
+// never take a slot. Anything service-specific goes inside it, on the router.
+func Standard(s Stack) []func(http.Handler) http.Handler {
+	logf := s.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	return []func(http.Handler) http.Handler{
+		Recover(s.Error, logf),
+		RequestID,
+		Logging(s.ClientIP, logf),
+		s.Metrics.Middleware,
+		s.Limiter.Middleware(s.Error),
+		s.Shedder.Middleware(s.Error),
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(mark("first"), mark("second"), mark("third"))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got, want := strings.Join(order, ","), "first,second,third,handler"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+// captureLog sends the standard logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// plainError answers with the code as a plain-text body.
+func plainError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	http.Error(w, code, status)
+}
+
+func standardHandler(limiter *RateLimiter, h http.Handler) http.Handler {
+	return Chain(Standard(Stack{
+		ClientIP: func(r *http.Request) string { return r.RemoteAddr },
+		Error:    plainError,
+		Metrics:  NewMetrics(prometheus.NewRegistry()),
+		Limiter:  limiter,
+		Shedder:  NewLoadShedder(8, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_in_flight"})),
+	})...)(h)
+}
+
+func TestStandardLogsRequestID(t *testing.T) {
+	logs := captureLog(t)
+	var seen string
+	h := standardHandler(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if seen != "abc-123" {
+		t.Errorf("handler saw request ID %q, want abc-123", seen)
+	}
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("response %s = %q, want abc-123", RequestIDHeader, got)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if !strings.Contains(line, "(request abc-123)") {
+			t.Errorf("log line without the request ID: %s", line)
+		}
+	}
+}
+
+func TestStandardRecoversPanics(t *testing.T) {
+	logs := captureLog(t)
+	h := standardHandler(nil, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	id := rec.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Fatal("panicking request got no request ID")
+	}
+	if !strings.Contains(logs.String(), "Panic serving GET / (request "+id+"): boom") {
+		t.Errorf("panic not logged with its request ID:\n%s", logs)
+	}
+	if !strings.Contains(logs.String(), "Completed: GET / 500") {
+		t.Errorf("recovered request not logged as a 500:\n%s", logs)
+	}
+}
+
+func TestStandardRateLimitsBeforeShedding(t *testing.T) {
+	captureLog(t)
+	limiter := NewRateLimiter(1, 1, func(r *http.Request) string { return r.RemoteAddr })
+	h := standardHandler(limiter, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	codes := make([]int, 2)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[i] = rec.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 429]", codes)
+	}
+}
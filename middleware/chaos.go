@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"math/rand"
+	"net/http"
+
+	"chaos"
+)
+
+// Chaos applies the simulated behavior b, drawing from rng, and answers the
+// requests it fails through onError: a 500 "simulated_failure", or a 504
+// "timeout" when the request's deadline passes during the latency.
+func Chaos(b chaos.Behavior, rng *rand.Rand, onError ErrorFunc) func(http.Handler) http.Handler {
+	return chaos.Middleware(b, rng, func(w http.ResponseWriter, r *http.Request, status int) {
+		if status == http.StatusGatewayTimeout {
+			onError(w, r, status, "timeout", "request timed out")
+			return
+		}
+		onError(w, r, status, "simulated_failure", "simulated failure")
+	})
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chaos"
+)
+
+func TestChaosErrorCodes(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		name     string
+		behavior chaos.Behavior
+		timeout  time.Duration
+		status   int
+		code     string
+	}{
+		{"simulated failure", chaos.ErrorProne, 0, http.StatusInternalServerError, "simulated_failure"},
+		{"deadline during latency", chaos.Slow, 10 * time.Millisecond, http.StatusGatewayTimeout, "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Chaos(tt.behavior, chaos.NewRand(1), plainError)(next)
+			var rec *httptest.ResponseRecorder
+			// error-prone fails about half the requests; stop at the first
+			for i := 0; i < 50; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tt.timeout > 0 {
+					ctx, cancel := context.WithTimeout(r.Context(), tt.timeout)
+					defer cancel()
+					r = r.WithContext(ctx)
+				}
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+				if rec.Code != http.StatusOK {
+					break
+				}
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.code {
+				t.Errorf("error code = %q, want %q", got, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LoadShedder caps the number of requests served at once. Requests over the
+// limit are rejected immediately with 503 and Retry-After instead of queueing
+// until the process falls over.
+type LoadShedder struct {
+	slots      chan struct{}
+	inFlight   prometheus.Gauge
+	retryAfter int
+}
+
+// NewLoadShedder allows up to max concurrent requests and reports the current
+// count on inFlight.
+func NewLoadShedder(max int, inFlight prometheus.Gauge) *LoadShedder {
+	if max < 1 {
+		max = 1
+	}
+	return &LoadShedder{
+		slots:      make(chan struct{}, max),
+		inFlight:   inFlight,
+		retryAfter: 1,
+	}
+}
+
+// Middleware applies the cap, answering the requests over it through onError.
+func (l *LoadShedder) Middleware(onError ErrorFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", strconv.Itoa(l.retryAfter))
+				onError(w, r, http.StatusServiceUnavailable, "overloaded", "server is at its concurrent request limit")
+				return
+			}
+
+			l.inFlight.Inc()
+			defer func() {
+				l.inFlight.Dec()
+				<-l.slots
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestLoadShedderRejectsOverLimit(t *testing.T) {
+	const limit = 3
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_in_flight"})
+	started, release := make(chan struct{}), make(chan struct{})
+	h := NewLoadShedder(limit, inFlight).Middleware(plainError)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	// Fill every slot with a request that holds on until released
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+		<-started
+	}
+	if got := gaugeValue(t, inFlight); got != limit {
+		t.Errorf("in-flight gauge = %v with the semaphore full, want %d", got, limit)
+	}
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("excess request %d: status %d, Retry-After %q, want 503 with Retry-After", i, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	if got := gaugeValue(t, inFlight); got != 0 {
+		t.Errorf("in-flight gauge = %v once drained, want 0", got)
+	}
+	go func() { <-started }()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d after the slots freed up, want 200", rec.Code)
+	}
+}
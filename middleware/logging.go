@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Logging logs each request as it arrives and again with its status and duration
+// once served, panics included, both tagged with the request ID. clientIP
+// resolves the address shown, so each service applies its own proxy-trust
+// settings, and logf writes the lines.
+func Logging(clientIP func(*http.Request) string, logf Logf) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := RequestIDFrom(r)
+			logf("Request: %s %s from %s (request %s)", r.Method, r.URL.Path, clientIP(r), id)
+			sw := RecordStatus(w)
+			finished := false
+			defer func() {
+				logf("Completed: %s %s %d in %v (request %s)", r.Method, r.URL.Path, sw.served(finished), time.Since(start), id)
+			}()
+			next.ServeHTTP(sw, r)
+			finished = true
+		})
+	}
+}
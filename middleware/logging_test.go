@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggingShowsResolvedClient(t *testing.T) {
+	// The service decides which address is the client's; a forwarded one here
+	clientIP := func(r *http.Request) string {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return xff
+		}
+		return r.RemoteAddr
+	}
+	h := Logging(clientIP, log.Printf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	logs := captureLog(t)
+	r := httptest.NewRequest(http.MethodGet, "/calculate", nil)
+	r.RemoteAddr = "10.0.0.2"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, want := range []string{"Request: GET /calculate from 198.51.100.1 ", "Completed: GET /calculate 418 in "} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log = %q, want it to contain %q", logs, want)
+		}
+	}
+}
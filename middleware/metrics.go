@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics counts requests into Requests, labelled method and code, and, when
+// Duration is set, observes their duration into it, labelled method. Each service
+// passes its own series; a nil Metrics counts nothing.
+type Metrics struct {
+	Requests *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+}
+
+// NewMetrics registers the series the BMI services report on reg:
+// http_requests_total and http_request_duration_seconds.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+	return &Metrics{
+		Requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests served, by method and status code",
+		}, []string{"method", "code"}),
+		Duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time to serve HTTP requests, by method",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+}
+
+// Middleware counts requests by method and status and observes their duration.
+// Paths and unknown methods are left out of the labels so clients can't grow the
+// series without bound.
+// Requests turned away by the rate limiter and load shedder below are counted too,
+// and so are panics, as the 500 Recover answers them with.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := RecordStatus(w)
+		finished := false
+		defer func() {
+			method := methodLabel(r.Method)
+			if m.Duration != nil {
+				m.Duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+			}
+			m.Requests.WithLabelValues(method, strconv.Itoa(sw.served(finished))).Inc()
+		}()
+		next.ServeHTTP(sw, r)
+		finished = true
+	})
+}
+
+// methodLabel maps methods outside the standard set to "other"; the server
+// accepts any token as a method, and each would be a new series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitClients is how many buckets are kept before those that have
+// refilled, and so carry no state worth keeping, are swept out.
+const maxRateLimitClients = 10000
+
+// RateLimiter allows each client, as told apart by clientIP, rps requests a
+// second with bursts of up to burst, answering the rest with 429 and
+// Retry-After. A nil RateLimiter lets everything through.
+type RateLimiter struct {
+	rps      float64
+	burst    float64
+	clientIP func(*http.Request) string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter for rps requests a second per client, or nil,
+// meaning no limit, when rps is not positive. A burst below 1 defaults to
+// rps rounded up, so a client may spend a second's worth at once.
+func NewRateLimiter(rps float64, burst int, clientIP func(*http.Request) string) *RateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rps))
+	}
+	return &RateLimiter{
+		rps:      rps,
+		burst:    float64(burst),
+		clientIP: clientIP,
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+// Middleware applies the limit, answering the requests over it through onError.
+func (l *RateLimiter) Middleware(onError ErrorFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait, ok := l.allow(l.clientIP(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				onError(w, r, http.StatusTooManyRequests, "rate_limited", "too many requests from this client")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allow takes a token from client's bucket, or reports how long until one is there.
+func (l *RateLimiter) allow(client string) (time.Duration, bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.pruneLocked(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rps * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
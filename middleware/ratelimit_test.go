@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(2, 3, nil)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, ok := l.allow("a"); !ok {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	wait, ok := l.allow("a")
+	if ok {
+		t.Fatal("request over the burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms at 2 requests/s", wait)
+	}
+	if _, ok := l.allow("b"); !ok {
+		t.Error("another client was limited by a's bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, ok := l.allow("a"); !ok {
+		t.Error("request after the bucket refilled a token was refused")
+	}
+	if _, ok := l.allow("a"); ok {
+		t.Error("refilled bucket allowed more than one token")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l := NewRateLimiter(0.5, 1, func(r *http.Request) string { return r.RemoteAddr })
+	h := l.Middleware(plainError)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	if l := NewRateLimiter(0, 10, nil); l != nil {
+		t.Fatal("NewRateLimiter(0, ...) returned a limiter")
+	}
+	var l *RateLimiter
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	rec := httptest.NewRecorder()
+	l.Middleware(plainError)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("nil limiter answered %d", rec.Code)
+	}
+}
+
+func TestNewRateLimiterDefaultBurst(t *testing.T) {
+	if l := NewRateLimiter(2.5, 0, nil); l.burst != 3 {
+		t.Errorf("burst = %v, want rps rounded up, 3", l.burst)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover turns a panicking handler into a logged 500 instead of a dropped
+// connection. http.ErrAbortHandler is re-raised, since it is how handlers ask the
+// server to abort the response on purpose. The 500 is written by onError and the
+// panic logged through logf.
+func Recover(onError ErrorFunc, logf Logf) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := RecordStatus(w)
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				// r predates RequestID's context, but shares the headers it sets the ID on
+				logf("Panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, r.Header.Get(RequestIDHeader), err, debug.Stack())
+				// Once the status is out, the best left to do is cut the response short
+				if sw.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				onError(sw, r, http.StatusInternalServerError, "internal_error", "internal server error")
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
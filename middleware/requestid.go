@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID between services and back to the client.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs taken from clients so they can't flood the logs.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID: the caller's X-Request-ID when it sent a
+// usable one, else a fresh one. The ID is set on the request headers, so proxies
+// and fan-out calls forward it, on the response, and in the context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the ID RequestID assigned to r, or "" outside the middleware.
+func RequestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error generating request ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
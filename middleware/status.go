@@ -0,0 +1,60 @@
+package middleware
+
+import "net/http"
+
+// StatusWriter remembers the status a handler answered with, for middleware that
+// acts on it once the handler returns.
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *StatusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the writer underneath, e.g. to hijack
+// the connection.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the status written so far, or 200 if the handler wrote nothing.
+func (w *StatusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// served is the status the client gets. A handler that didn't finish panicked,
+// and unless it had already written a status, Recover answers it with a 500.
+func (w *StatusWriter) served(finished bool) int {
+	if !finished && w.status == 0 {
+		return http.StatusInternalServerError
+	}
+	return w.Status()
+}
+
+// RecordStatus returns w wrapped in a StatusWriter, reusing one an outer
+// middleware already installed.
+func RecordStatus(w http.ResponseWriter) *StatusWriter {
+	if sw, ok := w.(*StatusWriter); ok {
+		return sw
+	}
+	return &StatusWriter{ResponseWriter: w}
+}
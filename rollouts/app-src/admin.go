@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	enableAdmin = getEnv("ENABLE_ADMIN", "false") == "true"
+	adminToken  = getEnv("ADMIN_TOKEN", "")
+
+	// exitFunc is swapped out in tests so the crash drills don't kill the test binary
+	exitFunc = os.Exit
+)
+
+func registerAdminRoutes(mux *http.ServeMux) {
+	if !enableAdmin {
+		return
+	}
+	if adminToken == "" {
+		fmt.Println("ENABLE_ADMIN is set but ADMIN_TOKEN is empty; admin endpoints stay disabled")
+		return
+	}
+
+	mux.HandleFunc("/admin/crash", requireAdmin(http.MethodPost, handleCrash))
+	mux.HandleFunc("/admin/panic", requireAdmin(http.MethodPost, handlePanic))
+	mux.HandleFunc("/admin/metrics/reset", requireAdmin(http.MethodPost, handleMetricsReset))
+	mux.HandleFunc("/admin/loadtest", requireAdmin(http.MethodPost, handleLoadtest))
+	mux.HandleFunc("/admin/leak", requireAdmin(http.MethodPost, handleLeak))
+	mux.HandleFunc("/admin/leak/release", requireAdmin(http.MethodPost, handleLeakRelease))
+	mux.HandleFunc("/api/close", requireAdmin(http.MethodGet, handleClose))
+	fmt.Println("Admin endpoints enabled")
+}
+
+// requireAdmin only lets requests with the given method and the shared ADMIN_TOKEN through.
+func requireAdmin(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if adminToken == "" {
+			writeError(w, r, http.StatusForbidden, "ADMIN_TOKEN is not configured")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			writeError(w, r, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func handleCrash(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("Admin crash requested from %s, exiting with status 1\n", r.RemoteAddr)
+	writeAccepted(w, r, "crashing")
+	exitFunc(1)
+}
+
+func handlePanic(w http.ResponseWriter, r *http.Request) {
+	fmt.Printf("Admin panic requested from %s\n", r.RemoteAddr)
+	writeAccepted(w, r, "panicking")
+	// net/http recovers panics inside handlers, so panic on a fresh goroutine to take the process down
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		panic("simulated panic triggered via /admin/panic")
+	}()
+}
+
+// handleMetricsReset zeroes the request metrics between demos. Resetting the vectors in
+// place drops every series without swapping collectors out from under running handlers;
+// app_version_info is left alone so dashboards keep identifying the pod.
+func handleMetricsReset(w http.ResponseWriter, r *http.Request) {
+	requestCounter.Reset()
+	requestDuration.Reset()
+	responsesTotal.Reset()
+	fmt.Printf("Admin metrics reset requested from %s\n", r.RemoteAddr)
+
+	writeJSON(w, r, http.StatusOK, map[string]string{
+		"status":   "metrics reset",
+		"hostname": hostname,
+	})
+}
+
+func writeAccepted(w http.ResponseWriter, r *http.Request, status string) {
+	writeJSON(w, r, http.StatusAccepted, map[string]string{
+		"status":   status,
+		"hostname": hostname,
+	})
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
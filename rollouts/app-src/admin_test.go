@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// useAdmin enables the admin routes with token for the rest of the test.
+func useAdmin(t *testing.T, token string) {
+	t.Helper()
+	oldEnabled, oldToken := enableAdmin, adminToken
+	t.Cleanup(func() { enableAdmin, adminToken = oldEnabled, oldToken })
+	enableAdmin, adminToken = true, token
+}
+
+func TestAdminCrash(t *testing.T) {
+	useAdmin(t, "secret")
+	var exitCodes []int
+	defer func(old func(int)) { exitFunc = old }(exitFunc)
+	exitFunc = func(code int) { exitCodes = append(exitCodes, code) }
+	mux := newMux()
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"without a token", http.MethodPost, "", http.StatusUnauthorized},
+		{"with the wrong token", http.MethodPost, "guess", http.StatusUnauthorized},
+		{"with the wrong method", http.MethodGet, "secret", http.StatusMethodNotAllowed},
+		{"authorized", http.MethodPost, "secret", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/admin/crash", nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if len(exitCodes) != 1 || exitCodes[0] != 1 {
+		t.Errorf("exitFunc called with %v, want exactly one exit with status 1", exitCodes)
+	}
+}
+
+func TestAdminRoutesNeedEnableAdmin(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		enabled bool
+		token   string
+	}{
+		{"ENABLE_ADMIN off", false, "secret"},
+		{"no ADMIN_TOKEN", true, ""},
+	} {
+		useAdmin(t, tt.token)
+		enableAdmin = tt.enabled
+		mux := newMux()
+		for _, path := range []string{"/admin/crash", "/admin/panic", "/admin/metrics/reset", "/admin/loadtest", "/api/close"} {
+			if _, pattern := mux.Handler(httptest.NewRequest(http.MethodPost, path, nil)); pattern != "/" {
+				t.Errorf("%s: %s is served by %q, want it left to the catch-all", tt.name, path, pattern)
+			}
+		}
+	}
+}
+
+// metricSum totals every sample of the named family in the default registry.
+func metricSum(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			total += m.GetCounter().GetValue() + m.GetGauge().GetValue() + float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+	return total
+}
+
+func TestAdminMetricsReset(t *testing.T) {
+	useAdmin(t, "secret")
+	mux := newMux()
+	versionGauge.WithLabelValues(version, string(behavior), hostname).Set(1)
+
+	requestCounter.WithLabelValues("GET", "/api/data", "200").Add(3)
+	requestDuration.WithLabelValues("GET", "/api/data", version, string(behavior)).Observe(0.1)
+	if metricSum(t, "http_requests_total") == 0 {
+		t.Fatal("http_requests_total is zero before the reset")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/metrics/reset", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /admin/metrics/reset = %d", rec.Code)
+	}
+
+	for _, name := range []string{"http_requests_total", "http_request_duration_seconds", "http_responses_total"} {
+		if got := metricSum(t, name); got != 0 {
+			t.Errorf("%s = %v after the reset, want 0", name, got)
+		}
+	}
+	if got := metricSum(t, "app_version_info"); got != 1 {
+		t.Errorf("app_version_info = %v after the reset, want it kept at 1", got)
+	}
+}
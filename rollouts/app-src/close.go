@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handleClose ends the request the way a pod does during a canary abort:
+// mode=graceful answers normally, mode=abrupt hijacks the connection and closes
+// it without writing a response, so the client sees a reset or EOF.
+func handleClose(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/api/close", duration)
+	}()
+
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "graceful":
+		requestCounter.WithLabelValues(r.Method, "/api/close", "200").Inc()
+		w.Header().Set("Connection", "close")
+		writeJSON(w, r, http.StatusOK, map[string]string{
+			"mode":     "graceful",
+			"version":  servedVersion(r),
+			"hostname": hostname,
+		})
+	case "abrupt":
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			requestCounter.WithLabelValues(r.Method, "/api/close", "500").Inc()
+			writeError(w, r, http.StatusInternalServerError, "connection cannot be hijacked: "+err.Error())
+			return
+		}
+		// No status reached the client; record the drop as such
+		requestCounter.WithLabelValues(r.Method, "/api/close", "aborted").Inc()
+		fmt.Printf("Abruptly closing connection from %s\n", r.RemoteAddr)
+		conn.Close()
+	default:
+		requestCounter.WithLabelValues(r.Method, "/api/close", "400").Inc()
+		writeError(w, r, http.StatusBadRequest, "mode must be graceful or abrupt")
+	}
+}
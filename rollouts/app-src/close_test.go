@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloseModes(t *testing.T) {
+	useAdmin(t, "secret")
+	server := httptest.NewServer(newMux())
+	defer server.Close()
+
+	get := func(mode string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/close?mode="+mode, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := get("graceful")
+	if err != nil {
+		t.Fatalf("graceful: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !resp.Close {
+		t.Errorf("graceful = %d (close %v), want 200 with Connection: close", resp.StatusCode, resp.Close)
+	}
+
+	if resp, err := get("abrupt"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("abrupt = %d, want the connection dropped", resp.StatusCode)
+	}
+
+	// On the wire, the connection ends without a single byte of response
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /api/close?mode=abrupt HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer secret\r\n\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if got, err := io.ReadAll(conn); len(got) != 0 || err != nil {
+		t.Errorf("abrupt sent %q (read error %v), want the connection closed with nothing written", got, err)
+	}
+
+	resp, err = get("sideways")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown mode = %d, want 400", resp.StatusCode)
+	}
+}
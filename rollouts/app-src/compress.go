@@ -0,0 +1,125 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	compressResponses = getEnv("COMPRESS_RESPONSES", "false") == "true"
+	compressMinBytes  = getEnvInt("COMPRESS_MIN_BYTES", 1024)
+)
+
+var gzipPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// compress gzips responses for clients that send Accept-Encoding: gzip, to show
+// the bandwidth saved on padded /api/data payloads. Responses with a
+// Content-Length below compressMinBytes go out as-is, since gzip would only add
+// overhead. /metrics is left alone: promhttp already negotiates gzip itself.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || r.URL.Path == "/metrics" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 explicitly refuses it
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter decides on the first WriteHeader or Write whether to
+// compress, based on the status, the Content-Length set by the handler and any
+// Content-Encoding it chose itself.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decided = true
+		if w.shouldCompress(status) {
+			h := w.Header()
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", "gzip")
+			w.gz = gzipPool.Get().(*gzip.Writer)
+			w.gz.Reset(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) shouldCompress(status int) bool {
+	h := w.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < compressMinBytes {
+		return false
+	}
+	return true
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush pushes compressed bytes written so far to the client, so streaming
+// handlers keep working behind the middleware.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// hijack the connection in /api/close.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) Close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	gzipPool.Put(w.gz)
+	w.gz = nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chaos"
+)
+
+func TestCompressPaddedResponse(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	handler := compress(http.HandlerFunc(handleAPIData))
+
+	tests := []struct {
+		name           string
+		query          string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"padded, gzip accepted", "?size=16", "br, gzip", true},
+		{"padded, gzip refused", "?size=16", "gzip;q=0", false},
+		{"padded, no Accept-Encoding", "?size=16", "", false},
+		{"below COMPRESS_MIN_BYTES", "", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/data"+tt.query, nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d", rec.Code)
+			}
+			if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", vary)
+			}
+
+			body := io.Reader(rec.Body)
+			sent := rec.Body.Len()
+			if gotGzip := rec.Header().Get("Content-Encoding") == "gzip"; gotGzip != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			if tt.wantGzip {
+				if cl := rec.Header().Get("Content-Length"); cl != "" {
+					t.Errorf("Content-Length = %s on a gzipped body, want it dropped", cl)
+				}
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			plain, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data struct {
+				Data string `json:"data"`
+			}
+			if err := json.Unmarshal(plain, &data); err != nil {
+				t.Fatalf("body does not decode to JSON: %v", err)
+			}
+			if tt.query != "" && len(data.Data) != 16<<10 {
+				t.Errorf("padding is %d bytes, want 16 KB", len(data.Data))
+			}
+			if tt.wantGzip && sent >= len(plain)/4 {
+				t.Errorf("sent %d bytes for %d of JSON, want the padding to compress well", sent, len(plain))
+			}
+		})
+	}
+}
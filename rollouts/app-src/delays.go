@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// endpointDelays maps a path to the fixed latency it simulates in place of the
+// behavior's random delay, e.g. ENDPOINT_DELAYS=/api/process=300ms,/api/data=50ms.
+var endpointDelays = parseEndpointDelays(getEnv("ENDPOINT_DELAYS", ""))
+
+// parseEndpointDelays reads "path=duration" pairs; malformed entries are skipped so
+// a typo can't take the pod down.
+func parseEndpointDelays(spec string) map[string]time.Duration {
+	delays := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, raw, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		path = strings.TrimSpace(path)
+		if !ok || !strings.HasPrefix(path, "/") || err != nil || d < 0 {
+			fmt.Printf("Ignoring invalid endpoint delay %q, expected /path=duration\n", entry)
+			continue
+		}
+		delays[path] = d
+	}
+	return delays
+}
+
+// simulate applies BEHAVIOR to r and returns the status to answer with. A path
+// listed in ENDPOINT_DELAYS waits for its configured delay instead of the
+// behavior's, but still gets the behavior's errors. It runs inside the handlers
+// rather than as a wrapping middleware so the delay shows up in
+// http_request_duration_seconds. ok is false if the client went away during the
+// delay, leaving nobody to answer.
+func simulate(r *http.Request) (status int, ok bool) {
+	d, fixed := endpointDelays[r.URL.Path]
+	if !fixed {
+		d = behavior.Delay(rng)
+	}
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+		return 0, false
+	}
+	return behavior.Status(rng), true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chaos"
+)
+
+func TestEndpointDelays(t *testing.T) {
+	defer func(old map[string]time.Duration) { endpointDelays = old }(endpointDelays)
+	endpointDelays = parseEndpointDelays("/api/process=150ms, /api/data=0s, bogus=1s, /api/x=soon")
+	if len(endpointDelays) != 2 {
+		t.Fatalf("parsed %v, want only the /api/process and /api/data entries", endpointDelays)
+	}
+	mux := newMux()
+
+	timed := func(path string) time.Duration {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, rec.Code)
+		}
+		return time.Since(start)
+	}
+
+	useBehavior(t, chaos.Normal, "1")
+	if d := timed("/api/process"); d < 150*time.Millisecond {
+		t.Errorf("/api/process took %v, want at least its configured 150ms", d)
+	}
+	if d := timed("/health"); d > 50*time.Millisecond {
+		t.Errorf("/health took %v, want no delay for an unlisted endpoint", d)
+	}
+
+	// A listed endpoint's delay replaces the slow behavior's 200ms or more
+	useBehavior(t, chaos.Slow, "1")
+	if d := timed("/api/data"); d > 100*time.Millisecond {
+		t.Errorf("/api/data took %v under slow, want its configured 0s", d)
+	}
+}
+
+func TestSimulateStopsWhenClientLeaves(t *testing.T) {
+	defer func(old map[string]time.Duration) { endpointDelays = old }(endpointDelays)
+	endpointDelays = map[string]time.Duration{"/api/data": time.Minute}
+	useBehavior(t, chaos.Normal, "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, ok := simulate(httptest.NewRequest(http.MethodGet, "/api/data", nil).WithContext(ctx)); ok {
+		t.Error("simulate reported a status for a request whose client left")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("simulate waited %v after the client left, want it to stop", d)
+	}
+}
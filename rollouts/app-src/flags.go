@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// flagStore holds feature flags in memory; they reset to FLAGS on every restart.
+type flagStore struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+var flags = newFlagStore(getEnv("FLAGS", ""))
+
+// newFlagStore parses a comma-separated "name=bool" list, skipping malformed entries.
+func newFlagStore(spec string) *flagStore {
+	s := &flagStore{flags: make(map[string]bool)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(entry, "=")
+		enabled, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if !ok || strings.TrimSpace(name) == "" || err != nil {
+			fmt.Printf("Ignoring invalid flag %q, expected name=bool\n", entry)
+			continue
+		}
+		s.flags[strings.TrimSpace(name)] = enabled
+	}
+	return s
+}
+
+func (s *flagStore) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flags[name]
+}
+
+func (s *flagStore) Set(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags[name] = enabled
+}
+
+func (s *flagStore) Snapshot() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]bool, len(s.flags))
+	for name, enabled := range s.flags {
+		out[name] = enabled
+	}
+	return out
+}
+
+func handleFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	snapshot := flags.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"flags":    snapshot,
+		"names":    names,
+		"version":  servedVersion(r),
+		"hostname": hostname,
+	})
+}
+
+// handleSetFlag serves PUT /flags/{name} with a body of {"enabled": bool}.
+func handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/flags/")
+	if name == "" || strings.Contains(name, "/") {
+		writeError(w, r, http.StatusNotFound, "flag name required")
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, r, http.StatusBadRequest, `body must be {"enabled": true|false}`)
+		return
+	}
+
+	flags.Set(name, *req.Enabled)
+	fmt.Printf("Flag %s set to %t\n", name, *req.Enabled)
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"name":    name,
+		"enabled": *req.Enabled,
+	})
+}
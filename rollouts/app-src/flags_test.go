@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chaos"
+)
+
+func TestFlagDefaults(t *testing.T) {
+	s := newFlagStore("new_ui=true, dark_mode=false, broken, =true, beta=maybe")
+	want := map[string]bool{"new_ui": true, "dark_mode": false}
+	got := s.Snapshot()
+	if len(got) != len(want) {
+		t.Fatalf("flags = %v, want %v", got, want)
+	}
+	for name, enabled := range want {
+		if got[name] != enabled {
+			t.Errorf("%s = %t, want %t", name, got[name], enabled)
+		}
+	}
+	if s.Enabled("unknown") {
+		t.Error("an unset flag reads as enabled")
+	}
+}
+
+func TestToggleFlag(t *testing.T) {
+	useAdmin(t, "secret")
+	useBehavior(t, chaos.Normal, "1")
+	defer func(old *flagStore) { flags = old }(flags)
+	flags = newFlagStore("new_ui=false")
+	mux := newMux()
+
+	newUI := func() bool {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var resp Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("GET / body %q: %v", rec.Body, err)
+		}
+		return resp.NewUI
+	}
+	put := func(token, body string) int {
+		r := httptest.NewRequest(http.MethodPut, "/flags/new_ui", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if newUI() {
+		t.Fatal("new_ui shows before it is enabled")
+	}
+	if code := put("guess", `{"enabled": true}`); code != http.StatusUnauthorized {
+		t.Errorf("PUT without the admin token = %d, want 401", code)
+	}
+	if code := put("secret", `{"on": true}`); code != http.StatusBadRequest {
+		t.Errorf("PUT without enabled = %d, want 400", code)
+	}
+	if newUI() {
+		t.Fatal("a rejected PUT changed the flag")
+	}
+	if code := put("secret", `{"enabled": true}`); code != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", code)
+	}
+	if !newUI() {
+		t.Error("new_ui doesn't show after enabling it")
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flags", nil))
+	var listed struct {
+		Flags map[string]bool `json:"flags"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || !listed.Flags["new_ui"] {
+		t.Errorf("GET /flags = %s, want new_ui enabled", rec.Body)
+	}
+}
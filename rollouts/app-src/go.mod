@@ -15,3 +15,15 @@ require (
 	golang.org/x/sys v0.11.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
+
+require (
+	chaos v0.0.0
+	config v0.0.0
+	middleware v0.0.0
+)
+
+replace (
+	chaos => ../../chaos
+	config => ../../config
+	middleware => ../../middleware
+)
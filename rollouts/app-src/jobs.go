@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobTimedOut  = "timed_out"
+
+	// maxRetainedJobs bounds how many jobs stay pollable before the oldest finished ones are dropped
+	maxRetainedJobs = 1000
+)
+
+var (
+	jobs = newJobQueue(getEnvInt("WORKERS", 4), getEnvInt("JOB_QUEUE_SIZE", 100))
+
+	// enqueueTimeout is how long /api/process?async=true waits for room in a full queue
+	enqueueTimeout = getEnvDuration("ENQUEUE_TIMEOUT", 0)
+	jobTimeout     = getEnvDuration("JOB_TIMEOUT", 30*time.Second)
+
+	jobQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "job_queue_depth",
+		Help: "Number of async jobs waiting for a worker",
+	})
+
+	jobWorkerUtilization = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "job_worker_utilization",
+		Help: "Fraction of async job workers currently running a job",
+	})
+)
+
+type job struct {
+	ID          string                 `json:"job_id"`
+	Status      string                 `json:"status"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	CreatedAt   string                 `json:"created_at"`
+	CompletedAt string                 `json:"completed_at,omitempty"`
+
+	enqueued time.Time
+	version  string
+}
+
+// jobQueue is a bounded in-memory queue drained by a fixed pool of workers.
+type jobQueue struct {
+	workers int
+	queue   chan *job
+	nextID  atomic.Uint64
+	busy    atomic.Int64
+
+	mu    sync.RWMutex
+	jobs  map[string]*job
+	order []string
+}
+
+func newJobQueue(workers, size int) *jobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &jobQueue{
+		workers: workers,
+		queue:   make(chan *job, size),
+		jobs:    make(map[string]*job),
+	}
+}
+
+func (q *jobQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+	fmt.Printf("Started %d job workers (queue size %d)\n", q.workers, cap(q.queue))
+}
+
+// Enqueue waits until the job fits in the queue, ctx is done or timeout elapses,
+// whichever comes first; a zero timeout fails immediately when the queue is full.
+func (q *jobQueue) Enqueue(ctx context.Context, v string, timeout time.Duration) (job, error) {
+	now := time.Now()
+	j := &job{
+		ID:        fmt.Sprintf("job-%d", q.nextID.Add(1)),
+		Status:    jobQueued,
+		CreatedAt: reportedTime(now),
+		enqueued:  now,
+		version:   v,
+	}
+
+	// Register before sending so a worker can't update the job before it's pollable
+	q.mu.Lock()
+	q.jobs[j.ID] = j
+	q.order = append(q.order, j.ID)
+	q.mu.Unlock()
+
+	if err := q.send(ctx, j, timeout); err != nil {
+		q.mu.Lock()
+		q.removeLocked(j.ID)
+		q.mu.Unlock()
+		return job{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.evictLocked()
+	jobQueueDepth.Set(float64(len(q.queue)))
+	return *j, nil
+}
+
+var errQueueFull = errors.New("job queue is full")
+
+func (q *jobQueue) send(ctx context.Context, j *job, timeout time.Duration) error {
+	select {
+	case q.queue <- j:
+		return nil
+	default:
+	}
+	if timeout <= 0 {
+		return errQueueFull
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case q.queue <- j:
+		return nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errQueueFull
+		}
+		return ctx.Err()
+	}
+}
+
+// Get returns a copy of the job so callers can encode it without holding the lock.
+func (q *jobQueue) Get(id string) (job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+func (q *jobQueue) work() {
+	for j := range q.queue {
+		jobQueueDepth.Set(float64(len(q.queue)))
+		q.setBusy(1)
+		q.update(j, func(j *job) { j.Status = jobRunning })
+
+		ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+		result, err := process(ctx, j.enqueued, j.version)
+		cancel()
+
+		q.update(j, func(j *job) {
+			j.Status = jobCompleted
+			j.Result = result
+			if err != nil {
+				j.Status = jobTimedOut
+				j.Result = map[string]interface{}{"error": fmt.Sprintf("job exceeded its %s deadline", jobTimeout)}
+			}
+			j.CompletedAt = reportedTime(time.Now())
+		})
+		q.setBusy(-1)
+	}
+}
+
+func (q *jobQueue) setBusy(delta int64) {
+	jobWorkerUtilization.Set(float64(q.busy.Add(delta)) / float64(q.workers))
+}
+
+func (q *jobQueue) update(j *job, fn func(*job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(j)
+}
+
+func (q *jobQueue) removeLocked(id string) {
+	delete(q.jobs, id)
+	for i, oid := range q.order {
+		if oid == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// evictLocked drops the oldest finished jobs once more than maxRetainedJobs are tracked.
+func (q *jobQueue) evictLocked() {
+	for i := 0; len(q.jobs) > maxRetainedJobs && i < len(q.order); {
+		id := q.order[i]
+		if status := q.jobs[id].Status; status != jobCompleted && status != jobTimedOut {
+			i++
+			continue
+		}
+		delete(q.jobs, id)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+	}
+}
+
+func enqueueProcess(w http.ResponseWriter, r *http.Request) {
+	j, err := jobs.Enqueue(r.Context(), servedVersion(r), enqueueTimeout)
+	if err != nil {
+		writeError(w, r, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+j.ID)
+	writeJSON(w, r, http.StatusAccepted, map[string]interface{}{
+		"job_id":   j.ID,
+		"status":   j.Status,
+		"poll":     "/api/jobs/" + j.ID,
+		"version":  servedVersion(r),
+		"hostname": hostname,
+	})
+}
+
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/api/jobs", duration)
+	}()
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	j, ok := jobs.Get(id)
+	if !ok {
+		requestCounter.WithLabelValues(r.Method, "/api/jobs", "404").Inc()
+		writeError(w, r, http.StatusNotFound, "job not found")
+		return
+	}
+
+	requestCounter.WithLabelValues(r.Method, "/api/jobs", "200").Inc()
+	writeJSON(w, r, http.StatusOK, j)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chaos"
+)
+
+// useJobQueue swaps in a queue of the given shape for the rest of the test; with
+// start unset no worker drains it.
+func useJobQueue(t *testing.T, workers, size int, start bool) *jobQueue {
+	t.Helper()
+	old := jobs
+	q := newJobQueue(workers, size)
+	if start {
+		q.Start()
+	}
+	jobs = q
+	t.Cleanup(func() {
+		jobs = old
+		close(q.queue)
+	})
+	return q
+}
+
+// enqueue posts an async /api/process and returns the response and its job.
+func enqueue(t *testing.T) (*httptest.ResponseRecorder, job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleProcess(rec, httptest.NewRequest(http.MethodPost, "/api/process?async=true", nil))
+	var j job
+	if rec.Code == http.StatusAccepted {
+		if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, j
+}
+
+// poll fetches a job through GET /api/jobs/{id}.
+func poll(t *testing.T, id string) (int, job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleJob(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil))
+	var j job
+	json.Unmarshal(rec.Body.Bytes(), &j)
+	return rec.Code, j
+}
+
+// waitFinished polls a job until it has completed or timed out.
+func waitFinished(t *testing.T, id string) job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		code, polled := poll(t, id)
+		if code != http.StatusOK {
+			t.Fatalf("GET /api/jobs/%s = %d", id, code)
+		}
+		if polled.Status == jobCompleted || polled.Status == jobTimedOut {
+			return polled
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s after 2s", polled.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAsyncProcess(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	useJobQueue(t, 2, 10, true)
+
+	rec, j := enqueue(t)
+	if rec.Code != http.StatusAccepted || j.ID == "" {
+		t.Fatalf("POST /api/process?async=true = %d %s, want 202 with a job_id", rec.Code, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/jobs/"+j.ID {
+		t.Errorf("Location = %q, want /api/jobs/%s", loc, j.ID)
+	}
+
+	if polled := waitFinished(t, j.ID); polled.Status != jobCompleted || polled.Result["status"] != "completed" || polled.CompletedAt == "" {
+		t.Errorf("finished job = %+v, want it completed with its result and completion time", polled)
+	}
+
+	if code, _ := poll(t, "job-0"); code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs/job-0 = %d, want 404", code)
+	}
+}
+
+func TestAsyncProcessQueueFull(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	defer func(old time.Duration) { enqueueTimeout = old }(enqueueTimeout)
+	enqueueTimeout = 0
+	useJobQueue(t, 1, 2, false)
+
+	for i := 0; i < 2; i++ {
+		if rec, _ := enqueue(t); rec.Code != http.StatusAccepted {
+			t.Fatalf("job %d: status = %d, want 202 while the queue has room", i+1, rec.Code)
+		}
+	}
+	rec, _ := enqueue(t)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d with the queue full, want 503", rec.Code)
+	}
+}
+
+func TestEnqueueTimeout(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	defer func(old time.Duration) { enqueueTimeout = old }(enqueueTimeout)
+	enqueueTimeout = 30 * time.Millisecond
+	q := useJobQueue(t, 1, 1, false)
+
+	if rec, _ := enqueue(t); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202 while the queue has room", rec.Code)
+	}
+	start := time.Now()
+	rec, _ := enqueue(t)
+	if elapsed := time.Since(start); rec.Code != http.StatusServiceUnavailable || elapsed < enqueueTimeout || elapsed > time.Second {
+		t.Errorf("full queue answered %d after %v, want 503 after ENQUEUE_TIMEOUT=%v", rec.Code, elapsed, enqueueTimeout)
+	}
+
+	// A client that hangs up stops waiting at once, whatever the timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Enqueue(ctx, version, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Enqueue() with a cancelled context = %v, want context.Canceled", err)
+	}
+	if code, _ := poll(t, "job-2"); code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs/job-2 = %d for a job that never fit, want 404", code)
+	}
+}
+
+func TestJobDeadline(t *testing.T) {
+	// slow makes process take at least 100ms
+	useBehavior(t, chaos.Slow, "1")
+	defer func(old time.Duration) { jobTimeout = old }(jobTimeout)
+	jobTimeout = 10 * time.Millisecond
+	q := useJobQueue(t, 1, 10, true)
+
+	j, err := q.Enqueue(context.Background(), version, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polled := waitFinished(t, j.ID); polled.Status != jobTimedOut || polled.Result["error"] == nil || polled.CompletedAt == "" {
+		t.Errorf("job = %+v, want it timed_out with an error once past JOB_TIMEOUT", polled)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledBuffer keeps unusually large responses (e.g. padded /api/data) from
+// pinning big buffers in the pool.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// prettyJSON indents responses by default; a request can still choose with
+// ?pretty=true or ?pretty=false.
+var prettyJSON = getEnv("PRETTY_JSON", "false") == "true"
+
+// writeJSON encodes v into a pooled buffer before writing, saving the encoder's
+// per-call allocations and letting the response carry an exact Content-Length.
+// Indented output is still served as application/json.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	enc := json.NewEncoder(buf)
+	if pretty(r) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		fmt.Printf("Error encoding response: %v\n", err)
+		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+func pretty(r *http.Request) bool {
+	if value, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+		return value
+	}
+	return prettyJSON
+}
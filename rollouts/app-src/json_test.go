@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// discardWriter keeps nothing, so the benchmark measures encoding rather than
+// a recorder growing its buffer.
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// writeJSONUnpooled is writeJSON with a fresh buffer per response.
+func writeJSONUnpooled(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty(r) {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// BenchmarkWriteJSON encodes an /api/data response padded to 4 KB with and
+// without the buffer pool; run with -benchmem to compare allocations.
+func BenchmarkWriteJSON(b *testing.B) {
+	data := map[string]interface{}{
+		"endpoint":  "/api/data",
+		"items":     42,
+		"processed": true,
+		"version":   "1.0.0",
+		"hostname":  "demo-app-7d4b9",
+		"data":      padding(4 << 10),
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/data?size=4", nil)
+	w := &discardWriter{header: make(http.Header)}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writeJSON(w, r, http.StatusOK, data)
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			writeJSONUnpooled(w, r, http.StatusOK, data)
+		}
+	})
+}
+
+func TestWriteJSONContentLength(t *testing.T) {
+	for _, size := range []int{0, 80 << 10} { // the second outgrows maxPooledBuffer
+		rec := httptest.NewRecorder()
+		writeJSON(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, map[string]string{"data": padding(size)})
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+			t.Errorf("%d bytes of padding: Content-Length = %s for a %d-byte body", size, got, rec.Body.Len())
+		}
+	}
+}
+
+func TestWriteJSONPretty(t *testing.T) {
+	defer func(old bool) { prettyJSON = old }(prettyJSON)
+	for _, tt := range []struct {
+		def    bool
+		path   string
+		indent bool
+	}{
+		{false, "/", false},
+		{false, "/?pretty=true", true},
+		{true, "/", true},
+		{true, "/?pretty=false", false},
+	} {
+		prettyJSON = tt.def
+		rec := httptest.NewRecorder()
+		writeJSON(rec, httptest.NewRequest(http.MethodGet, tt.path, nil), http.StatusOK, map[string]string{"status": "ok"})
+		if indented := strings.Contains(rec.Body.String(), "\n  \""); indented != tt.indent {
+			t.Errorf("PRETTY_JSON=%v %s: indented = %v, want %v in %q", tt.def, tt.path, indented, tt.indent, rec.Body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("PRETTY_JSON=%v %s: Content-Type = %q", tt.def, tt.path, ct)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// maxLeakMB bounds a single /admin/leak call; repeated calls keep adding up.
+const maxLeakMB = 1024
+
+// leaked is the memory /admin/leak holds on to, so the heap grows like a leaking
+// canary's and MEM_PRESSURE_MB readiness has something to catch.
+var (
+	leakMu sync.Mutex
+	leaked [][]byte
+)
+
+// handleLeak allocates mb more megabytes (default 10) and never lets go of them
+// until /admin/leak/release.
+func handleLeak(w http.ResponseWriter, r *http.Request) {
+	mb := 10
+	if raw := r.URL.Query().Get("mb"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLeakMB {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("mb must be between 1 and %d", maxLeakMB))
+			return
+		}
+		mb = n
+	}
+
+	chunk := make([]byte, mb<<20)
+	// Touch every page so resident memory grows too, not just the heap accounting
+	for i := 0; i < len(chunk); i += 4096 {
+		chunk[i] = 1
+	}
+	leakMu.Lock()
+	leaked = append(leaked, chunk)
+	held := leakedMB()
+	leakMu.Unlock()
+
+	fmt.Printf("Admin leak of %d MB requested from %s, %d MB now held\n", mb, r.RemoteAddr, held)
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"status":    "leaking",
+		"leaked_mb": held,
+		"hostname":  hostname,
+	})
+}
+
+// handleLeakRelease drops everything /admin/leak holds and collects it right away,
+// so readiness recovers on the next MEM_PRESSURE_INTERVAL reading.
+func handleLeakRelease(w http.ResponseWriter, r *http.Request) {
+	leakMu.Lock()
+	released := leakedMB()
+	leaked = nil
+	leakMu.Unlock()
+	runtime.GC()
+
+	fmt.Printf("Admin leak release requested from %s, %d MB released\n", r.RemoteAddr, released)
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"status":      "released",
+		"released_mb": released,
+		"hostname":    hostname,
+	})
+}
+
+// leakedMB is how much leaked holds; callers hold leakMu.
+func leakedMB() int {
+	total := 0
+	for _, chunk := range leaked {
+		total += len(chunk) >> 20
+	}
+	return total
+}
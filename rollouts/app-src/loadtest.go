@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxLoadtestConcurrency = 50
+	maxLoadtestDuration    = time.Minute
+	// maxLoadtestSamples bounds the latencies kept for percentiles; past it they
+	// are reservoir-sampled so a long run doesn't grow memory without limit
+	maxLoadtestSamples = 100000
+)
+
+// loadtestRunning allows one load test at a time.
+var loadtestRunning atomic.Bool
+
+// handleLoadtest serves POST /admin/loadtest?concurrency=N&duration=D by hammering
+// this pod's own /api/process over loopback for D with N workers. The requests go
+// through the real server, so http_requests_total and the duration histogram show
+// the load like any other traffic.
+func handleLoadtest(w http.ResponseWriter, r *http.Request) {
+	concurrency := 10
+	if raw := r.URL.Query().Get("concurrency"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLoadtestConcurrency {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("concurrency must be between 1 and %d", maxLoadtestConcurrency))
+			return
+		}
+		concurrency = n
+	}
+	duration := 5 * time.Second
+	if raw := r.URL.Query().Get("duration"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxLoadtestDuration {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("duration must be a positive duration up to %s", maxLoadtestDuration))
+			return
+		}
+		duration = d
+	}
+
+	if !loadtestRunning.CompareAndSwap(false, true) {
+		writeError(w, r, http.StatusConflict, "a load test is already running")
+		return
+	}
+	defer loadtestRunning.Store(false)
+
+	// The run outlasts the server's WriteTimeout, so give this response more time
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(duration + 10*time.Second)); err != nil {
+		fmt.Printf("Load test: could not extend write deadline: %v\n", err)
+	}
+
+	fmt.Printf("Admin load test requested from %s: %d workers for %s\n", r.RemoteAddr, concurrency, duration)
+	summary := runLoadtest(selfURL("/api/process"), concurrency, duration)
+	writeJSON(w, r, http.StatusOK, summary)
+}
+
+// selfURL addresses path on this server over loopback when it listens on every interface.
+func selfURL(path string) string {
+	host := bindAddr
+	if ip := net.ParseIP(bindAddr); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return "http://" + net.JoinHostPort(host, port) + path
+}
+
+type loadtestSummary struct {
+	Concurrency int                `json:"concurrency"`
+	Duration    string             `json:"duration"`
+	Requests    int64              `json:"requests"`
+	Errors      int64              `json:"errors"`
+	RPS         float64            `json:"rps"`
+	Statuses    map[string]int64   `json:"statuses"`
+	LatencyMs   map[string]float64 `json:"latency_ms"`
+}
+
+func runLoadtest(url string, concurrency int, duration time.Duration) loadtestSummary {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: concurrency},
+	}
+	defer client.CloseIdleConnections()
+
+	var (
+		mu        sync.Mutex
+		samples   []float64
+		seen      int64
+		statuses  = make(map[string]int64)
+		errors    int64
+		wg        sync.WaitGroup
+		deadline  = time.Now().Add(duration)
+		startedAt = time.Now()
+	)
+	record := func(ms float64, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen++
+		statuses[status]++
+		if len(samples) < maxLoadtestSamples {
+			samples = append(samples, ms)
+		} else if i := rng.Int63n(seen); i < maxLoadtestSamples {
+			samples[i] = ms
+		}
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				resp, err := client.Get(url)
+				ms := float64(time.Since(start).Microseconds()) / 1000
+				if err != nil {
+					atomic.AddInt64(&errors, 1)
+					record(ms, "error")
+					continue
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode >= 500 {
+					atomic.AddInt64(&errors, 1)
+				}
+				record(ms, strconv.Itoa(resp.StatusCode))
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(startedAt)
+
+	sort.Float64s(samples)
+	return loadtestSummary{
+		Concurrency: concurrency,
+		Duration:    duration.String(),
+		Requests:    seen,
+		Errors:      errors,
+		RPS:         math.Round(float64(seen)/elapsed.Seconds()*100) / 100,
+		Statuses:    statuses,
+		LatencyMs: map[string]float64{
+			"p50": percentile(samples, 0.50),
+			"p90": percentile(samples, 0.90),
+			"p99": percentile(samples, 0.99),
+			"max": percentile(samples, 1),
+		},
+	}
+}
+
+// percentile returns the q-th quantile of sorted by nearest rank, or 0 when empty.
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
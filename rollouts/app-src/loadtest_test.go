@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLoadtest(t *testing.T) {
+	var n atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1)%5 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer target.Close()
+
+	s := runLoadtest(target.URL+"/api/process", 2, 100*time.Millisecond)
+
+	if s.Concurrency != 2 || s.Duration != "100ms" {
+		t.Errorf("summary reports %d workers for %s, want 2 for 100ms", s.Concurrency, s.Duration)
+	}
+	if s.Requests == 0 || s.Requests != n.Load() {
+		t.Fatalf("summary counts %d requests, the target served %d", s.Requests, n.Load())
+	}
+	if s.Statuses["200"]+s.Statuses["503"] != s.Requests || s.Errors != s.Statuses["503"] || s.Errors == 0 {
+		t.Errorf("statuses %v with %d errors don't add up to %d requests", s.Statuses, s.Errors, s.Requests)
+	}
+	if s.RPS <= 0 {
+		t.Errorf("rps = %v, want it positive", s.RPS)
+	}
+	l := s.LatencyMs
+	if !(l["p50"] > 0 && l["p50"] <= l["p90"] && l["p90"] <= l["p99"] && l["p99"] <= l["max"]) {
+		t.Errorf("latency_ms = %v, want 0 < p50 <= p90 <= p99 <= max", l)
+	}
+}
+
+func TestLoadtestBounds(t *testing.T) {
+	for _, query := range []string{"concurrency=0", "concurrency=51", "concurrency=ten", "duration=0s", "duration=2m", "duration=soon"} {
+		rec := httptest.NewRecorder()
+		handleLoadtest(rec, httptest.NewRequest(http.MethodPost, "/admin/loadtest?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+
+	loadtestRunning.Store(true)
+	defer loadtestRunning.Store(false)
+	rec := httptest.NewRecorder()
+	handleLoadtest(rec, httptest.NewRequest(http.MethodPost, "/admin/loadtest?duration=1s", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second load test = %d, want 409", rec.Code)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for q, want := range map[float64]float64{0: 1, 0.5: 5, 0.9: 9, 0.99: 10, 1: 10} {
+		if got := percentile(sorted, q); got != want {
+			t.Errorf("percentile(1..10, %v) = %v, want %v", q, got, want)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile of nothing = %v, want 0", got)
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"chaos"
+	"config"
+	"middleware"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -15,21 +21,53 @@ import (
 
 var (
 	version  = getEnv("VERSION", "1.0")
-	behavior = getEnv("BEHAVIOR", "normal") // normal, slow, error-prone, chaotic
+	behavior = chaos.Behavior(getEnv("BEHAVIOR", "normal")) // normal, slow, error-prone, chaotic
 	port     = getEnv("PORT", "8080")
+	bindAddr = getEnv("BIND_ADDR", "0.0.0.0")
 	hostname = getHostname()
 
+	// healthPath lets the probe path follow the cluster's convention, e.g. /healthz
+	healthPath = getEnv("HEALTH_PATH", defaultHealthPath)
+
+	maxPayloadKB = getEnvInt("MAX_PAYLOAD_KB", 1024)
+
+	rateLimitRPS   = getEnvFloat("RATE_LIMIT_RPS", 0)
+	rateLimitBurst = getEnvInt("RATE_LIMIT_BURST", 0)
+	maxConcurrent  = getEnvInt("MAX_CONCURRENT", 256)
+
+	// clockSkew shifts the timestamps reported in responses, never the clock used
+	// for timing, to show how skew between pods breaks log correlation
+	clockSkew = time.Duration(getEnvInt("CLOCK_SKEW_MS", 0)) * time.Millisecond
+
+	// rng drives every simulated decision; it is reseeded from RAND_SEED at startup
+	rng = chaos.NewRand(time.Now().UnixNano())
+
 	// Prometheus metrics
 	requestCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
 		Help: "Total number of HTTP requests",
 	}, []string{"method", "endpoint", "status"})
 
+	// version and behavior are bounded by VERSION_WEIGHTS and the behavior list, so
+	// stable and canary latency can be compared without exploding cardinality
 	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "http_request_duration_seconds",
 		Help:    "HTTP request duration in seconds",
 		Buckets: prometheus.DefBuckets,
-	}, []string{"method", "endpoint"})
+	}, []string{"method", "endpoint", "version", "behavior"})
+
+	// responsesTotal counts every response, including those the stack answers
+	// itself; http_requests_total is counted per endpoint by the handlers and
+	// never sees requests turned away before them
+	responsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_responses_total",
+		Help: "HTTP responses sent, by method and status code, including rate-limited and shed requests",
+	}, []string{"method", "code"})
+
+	inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	})
 
 	versionGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "app_version_info",
@@ -44,28 +82,58 @@ type Response struct {
 	Timestamp string            `json:"timestamp"`
 	Message   string            `json:"message"`
 	Headers   map[string]string `json:"headers,omitempty"`
+	NewUI     bool              `json:"new_ui,omitempty"`
 }
 
 func main() {
-	// Set version gauge
-	versionGauge.WithLabelValues(version, behavior, hostname).Set(1)
+	behavior = checkBehavior(behavior, getEnv("STRICT_BEHAVIOR", "false") == "true", exitFunc)
+
+	// Set version gauge; with VERSION_WEIGHTS it counts requests per served version instead
+	if len(versionWeights) == 0 {
+		versionGauge.WithLabelValues(version, string(behavior), hostname).Set(1)
+	} else {
+		fmt.Printf("Simulating weighted versions: %s\n", getEnv("VERSION_WEIGHTS", ""))
+	}
+	if len(endpointDelays) > 0 {
+		fmt.Printf("Endpoint delays: %v\n", endpointDelays)
+	}
 
 	// Seed random
-	rand.Seed(time.Now().UnixNano())
+	if seedStr := getEnv("RAND_SEED", ""); seedStr != "" {
+		seeded, err := chaos.SeededRand(seedStr)
+		if err != nil {
+			fmt.Printf("Invalid RAND_SEED: %v\n", err)
+			os.Exit(1)
+		}
+		rng = seeded
+		fmt.Printf("Using deterministic random seed: %s\n", seedStr)
+	}
 
-	// Routes
-	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/health", handleHealth)
-	http.HandleFunc("/api/data", handleAPIData)
-	http.HandleFunc("/api/process", handleProcess)
-	http.Handle("/metrics", promhttp.Handler())
+	crashOnStart(getEnvFloat("CRASH_ON_START_PROBABILITY", 0), exitFunc)
 
-	fmt.Printf("Starting server - Version: %s, Behavior: %s, Port: %s\n", version, behavior, port)
+	mux := newMux()
 
-	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	startPprof()
+
+	jobs.Start()
+
+	if net.ParseIP(bindAddr) == nil {
+		fmt.Printf("Invalid BIND_ADDR %q, expected an IP address\n", bindAddr)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Starting server - Version: %s, Behavior: %s, Address: %s\n", version, behavior, net.JoinHostPort(bindAddr, port))
+
+	var handler http.Handler = mux
+	if compressResponses {
+		handler = compress(handler)
+		fmt.Printf("Compressing responses of %d bytes or more for gzip clients\n", compressMinBytes)
+	}
+
+	server, err := newServer(net.JoinHostPort(bindAddr, port), middleware.Chain(standardStack()...)(withServedVersion(liveness.Middleware(handler))))
+	if err != nil {
+		fmt.Printf("Server config error: %v\n", err)
+		os.Exit(1)
 	}
 
 	if err := server.ListenAndServe(); err != nil {
@@ -74,189 +142,316 @@ func main() {
 	}
 }
 
+// newServer applies the connection limits from the environment to a server for
+// handler on addr, and logs the effective values.
+func newServer(addr string, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		// A zero IdleTimeout would silently fall back to ReadTimeout
+		IdleTimeout:    getEnvDuration("IDLE_TIMEOUT", 5*time.Second),
+		MaxHeaderBytes: getEnvInt("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes),
+	}
+	if server.MaxHeaderBytes <= 0 {
+		return nil, fmt.Errorf("invalid MAX_HEADER_BYTES %d, must be positive", server.MaxHeaderBytes)
+	}
+	// Without keep-alives every request opens a new connection, which shows how
+	// quickly traffic moves to new pods when the Service endpoints change
+	keepAlives := getEnv("DISABLE_KEEPALIVES", "false") != "true"
+	server.SetKeepAlivesEnabled(keepAlives)
+	fmt.Printf("Server limits: idle_timeout=%s max_header_bytes=%d keep_alives=%t\n", server.IdleTimeout, server.MaxHeaderBytes, keepAlives)
+	return server, nil
+}
+
+// newMux registers every route: the built-in ones first, then those whose paths
+// come from the environment and so are checked against them.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRoot)
+	mux.HandleFunc("/livez", handleLivez)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/api/data", handleAPIData)
+	mux.HandleFunc("/api/process", handleProcess)
+	mux.HandleFunc("/api/stream", handleStream)
+	mux.HandleFunc("/api/jobs/", handleJob)
+	mux.HandleFunc("/flags", handleFlags)
+	mux.HandleFunc("/flags/", requireAdmin(http.MethodPut, handleSetFlag))
+	mux.HandleFunc("/config", handleConfig)
+	mux.HandleFunc("/rollout-info", handleRolloutInfo)
+	mux.HandleFunc("/whoami", handleWhoami)
+	mux.HandleFunc("/stats", handleStats)
+	// OpenMetrics is the only exposition format that carries exemplars
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: tracingEnabled})))
+	registerAdminRoutes(mux)
+	registerHealthRoute(mux)
+	registerCustomRoutes(mux, getEnv("CUSTOM_ROUTES", ""))
+	return mux
+}
+
 func handleRoot(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start).Seconds()
-		requestDuration.WithLabelValues(r.Method, "/").Observe(duration)
+		observeDuration(r, "/", duration)
 	}()
 
 	// Apply behavior
-	status := applyBehavior(w, r)
+	status, ok := simulate(r)
+	if !ok {
+		return
+	}
 
 	requestCounter.WithLabelValues(r.Method, "/", fmt.Sprintf("%d", status)).Inc()
 
 	if status != http.StatusOK {
-		http.Error(w, http.StatusText(status), status)
+		writeError(w, r, status, http.StatusText(status))
 		return
 	}
 
 	response := Response{
-		Version:   version,
-		Behavior:  behavior,
+		Version:   servedVersion(r),
+		Behavior:  string(behavior),
 		Hostname:  hostname,
-		Timestamp: time.Now().Format(time.RFC3339),
-		Message:   getMessage(),
+		Timestamp: reportedTime(time.Now()),
+		Message:   behavior.Message(rng),
+		NewUI:     flags.Enabled("new_ui"),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, r, http.StatusOK, response)
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start).Seconds()
-		requestDuration.WithLabelValues(r.Method, "/health").Observe(duration)
+		observeDuration(r, healthPath, duration)
 	}()
 
 	// Health check might fail in error-prone mode
-	if behavior == "error-prone" && rand.Float32() < 0.3 {
-		requestCounter.WithLabelValues(r.Method, "/health", "503").Inc()
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{
+	if behavior == chaos.ErrorProne && rng.Float32() < 0.3 {
+		requestCounter.WithLabelValues(r.Method, healthPath, "503").Inc()
+		writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
 			"status": "unhealthy",
 			"reason": "simulated failure",
 		})
 		return
 	}
 
-	requestCounter.WithLabelValues(r.Method, "/health", "200").Inc()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	requestCounter.WithLabelValues(r.Method, healthPath, "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]string{
 		"status":   "healthy",
-		"version":  version,
+		"version":  servedVersion(r),
 		"hostname": hostname,
 	})
 }
 
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/config", duration)
+	}()
+
+	requestCounter.WithLabelValues(r.Method, "/config", "200").Inc()
+	writeJSON(w, r, http.StatusOK, config.Snapshot())
+}
+
 func handleAPIData(w http.ResponseWriter, r *http.Request) {
+	serveData(w, r, "/api/data")
+}
+
+// serveData answers /api/data and the CUSTOM_ROUTES echoing it; endpoint is the
+// route recorded in metrics.
+func serveData(w http.ResponseWriter, r *http.Request, endpoint string) {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start).Seconds()
-		requestDuration.WithLabelValues(r.Method, "/api/data").Observe(duration)
+		observeDuration(r, endpoint, duration)
 	}()
 
-	status := applyBehavior(w, r)
-	requestCounter.WithLabelValues(r.Method, "/api/data", fmt.Sprintf("%d", status)).Inc()
+	sizeKB := 0
+	if raw := r.URL.Query().Get("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			requestCounter.WithLabelValues(r.Method, endpoint, "400").Inc()
+			writeError(w, r, http.StatusBadRequest, "size must be a non-negative integer (KB)")
+			return
+		}
+		sizeKB = min(n, maxPayloadKB)
+	}
+
+	status, ok := simulate(r)
+	if !ok {
+		return
+	}
+	requestCounter.WithLabelValues(r.Method, endpoint, fmt.Sprintf("%d", status)).Inc()
 
 	if status != http.StatusOK {
-		http.Error(w, http.StatusText(status), status)
+		writeError(w, r, status, http.StatusText(status))
 		return
 	}
 
 	// Simulate some data processing
 	data := map[string]interface{}{
-		"items":     rand.Intn(100),
+		"endpoint":  endpoint,
+		"items":     rng.Intn(100),
 		"processed": true,
-		"version":   version,
+		"version":   servedVersion(r),
 		"hostname":  hostname,
-		"timestamp": time.Now().Format(time.RFC3339),
+		"timestamp": reportedTime(time.Now()),
+	}
+	if sizeKB > 0 {
+		data["data"] = padding(sizeKB * 1024)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	writeJSON(w, r, http.StatusOK, data)
 }
 
 func handleProcess(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start).Seconds()
-		requestDuration.WithLabelValues(r.Method, "/api/process").Observe(duration)
+		observeDuration(r, "/api/process", duration)
 	}()
 
-	status := applyBehavior(w, r)
+	status, ok := simulate(r)
+	if !ok {
+		return
+	}
 	requestCounter.WithLabelValues(r.Method, "/api/process", fmt.Sprintf("%d", status)).Inc()
 
 	if status != http.StatusOK {
-		http.Error(w, http.StatusText(status), status)
+		writeError(w, r, status, http.StatusText(status))
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		enqueueProcess(w, r)
+		return
+	}
+
+	result, err := process(r.Context(), start, servedVersion(r))
+	if err != nil {
+		// The client has gone away; nobody reads this, but keep the status honest
+		writeError(w, r, http.StatusServiceUnavailable, err.Error())
 		return
 	}
+	writeJSON(w, r, http.StatusOK, result)
+}
 
+// process simulates the work behind /api/process; start is when the work was requested
+// and v the version reported for it. It stops early with ctx's error once ctx is done.
+func process(ctx context.Context, start time.Time, v string) (map[string]interface{}, error) {
 	// Simulate processing time
-	if behavior == "slow" {
-		time.Sleep(time.Duration(100+rand.Intn(400)) * time.Millisecond)
+	if behavior == chaos.Slow {
+		select {
+		case <-time.After(time.Duration(100+rng.Intn(400)) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
-	response := map[string]interface{}{
+	return map[string]interface{}{
 		"status":   "completed",
 		"duration": time.Since(start).Milliseconds(),
-		"version":  version,
+		"version":  v,
+		"hostname": hostname,
+	}, nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, r, status, map[string]interface{}{
+		"error":    message,
+		"status":   status,
+		"version":  servedVersion(r),
 		"hostname": hostname,
+	})
+}
+
+// standardStack is the middleware stack the BMI services use, outermost first:
+// recovery, request ID, logging, metrics, rate limiting, load shedding. Its
+// errors and logs take the app's own format.
+func standardStack() []func(http.Handler) http.Handler {
+	limiter := middleware.NewRateLimiter(rateLimitRPS, rateLimitBurst, peerIP)
+	if limiter != nil {
+		fmt.Printf("Rate limiting each client to %g requests/s\n", rateLimitRPS)
 	}
+	return middleware.Standard(middleware.Stack{
+		ClientIP: peerIP,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+			writeError(w, r, status, message)
+		},
+		Logf:    func(format string, v ...interface{}) { fmt.Printf(format+"\n", v...) },
+		Metrics: &middleware.Metrics{Requests: responsesTotal},
+		Limiter: limiter,
+		Shedder: middleware.NewLoadShedder(maxConcurrent, inFlightGauge),
+	})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// peerIP is the client address the app knows of; it trusts no forwarded headers.
+func peerIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
 
-func applyBehavior(w http.ResponseWriter, r *http.Request) int {
-	switch behavior {
-	case "normal":
-		return http.StatusOK
-
-	case "slow":
-		// Add artificial delay
-		delay := time.Duration(200+rand.Intn(800)) * time.Millisecond
-		time.Sleep(delay)
-		return http.StatusOK
-
-	case "error-prone":
-		// Return errors randomly (50% chance)
-		if rand.Float32() < 0.5 {
-			return http.StatusInternalServerError
-		}
-		return http.StatusOK
+// reportedTime formats t for a response, shifted by CLOCK_SKEW_MS.
+func reportedTime(t time.Time) string {
+	return t.Add(clockSkew).Format(time.RFC3339)
+}
 
-	case "chaotic":
-		// Mix of slow and errors
-		if rand.Float32() < 0.3 {
-			time.Sleep(time.Duration(500+rand.Intn(1000)) * time.Millisecond)
-		}
-		if rand.Float32() < 0.4 {
-			return http.StatusInternalServerError
-		}
-		return http.StatusOK
+// padding returns a deterministic filler string of exactly n bytes.
+func padding(n int) string {
+	const pattern = "abcdefghijklmnopqrstuvwxyz0123456789"
+	return strings.Repeat(pattern, n/len(pattern)+1)[:n]
+}
 
-	default:
-		return http.StatusOK
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		config.Record(key, value)
+		return value
 	}
+	config.Record(key, defaultValue)
+	return defaultValue
 }
 
-func getMessage() string {
-	messages := map[string][]string{
-		"normal": {
-			"Service operating normally!!",
-			"All systems functional",
-			"Request processed successfully",
-		},
-		"slow": {
-			"Service is experiencing delays",
-			"Processing taking longer than usual",
-			"High latency detected",
-		},
-		"error-prone": {
-			"Service unstable",
-			"Errors may occur",
-			"Degraded performance",
-		},
-		"chaotic": {
-			"Unpredictable behavior",
-			"System under stress",
-			"Erratic performance",
-		},
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			config.Record(key, n)
+			return n
+		}
+		fmt.Printf("Invalid %s %q, using default %d\n", key, value, defaultValue)
 	}
+	config.Record(key, defaultValue)
+	return defaultValue
+}
 
-	msgs := messages[behavior]
-	if len(msgs) == 0 {
-		return "Unknown state"
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			config.Record(key, f)
+			return f
+		}
+		fmt.Printf("Invalid %s %q, using default %v\n", key, value, defaultValue)
 	}
-	return msgs[rand.Intn(len(msgs))]
+	config.Record(key, defaultValue)
+	return defaultValue
 }
 
-func getEnv(key, defaultValue string) string {
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
-		return value
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			config.Record(key, d)
+			return d
+		}
+		fmt.Printf("Invalid %s %q, using default %s\n", key, value, defaultValue)
 	}
+	config.Record(key, defaultValue)
 	return defaultValue
 }
 
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"chaos"
+	"middleware"
+)
+
+// useBehavior runs the rest of the test under b with rng seeded from seed, as
+// BEHAVIOR and RAND_SEED would.
+func useBehavior(t *testing.T, b chaos.Behavior, seed string) {
+	t.Helper()
+	seeded, err := chaos.SeededRand(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBehavior, oldRng := behavior, rng
+	t.Cleanup(func() { behavior, rng = oldBehavior, oldRng })
+	behavior, rng = b, seeded
+}
+
+// errorDecisions serves n requests to handler and returns their status codes.
+func errorDecisions(handler http.HandlerFunc, n int) []int {
+	codes := make([]int, n)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[i] = rec.Code
+	}
+	return codes
+}
+
+func TestRandSeedReproducible(t *testing.T) {
+	useBehavior(t, chaos.ErrorProne, "42")
+	first := errorDecisions(handleRoot, 50)
+
+	useBehavior(t, chaos.ErrorProne, "42")
+	second := errorDecisions(handleRoot, 50)
+
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("request %d: %d on the first run, %d on the second with the same seed", i, first[i], second[i])
+		}
+		if first[i] != http.StatusOK {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("%d of %d requests failed, want a mix in error-prone mode", failures, len(first))
+	}
+
+	useBehavior(t, chaos.ErrorProne, "43")
+	other := errorDecisions(handleRoot, 50)
+	same := true
+	for i := range first {
+		same = same && first[i] == other[i]
+	}
+	if same {
+		t.Error("a different seed gave the same 50 decisions")
+	}
+}
+
+func TestErrorBodyIsJSON(t *testing.T) {
+	useBehavior(t, chaos.ErrorProne, "1")
+	for _, handler := range []http.HandlerFunc{handleRoot, handleAPIData, handleProcess} {
+		var rec *httptest.ResponseRecorder
+		for i := 0; i < 50; i++ {
+			rec = httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusOK {
+				break
+			}
+		}
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("no simulated failure in 50 error-prone requests, last status %d", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var body struct {
+			Error    string `json:"error"`
+			Status   int    `json:"status"`
+			Version  string `json:"version"`
+			Hostname string `json:"hostname"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("error body %q is not JSON: %v", rec.Body, err)
+		}
+		if body.Error == "" || body.Status != http.StatusInternalServerError || body.Version != version || body.Hostname != hostname {
+			t.Errorf("error body = %+v, want the error, a 500 status, version %q and hostname %q", body, version, hostname)
+		}
+	}
+}
+
+func TestAPIDataSize(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	defer func(old int) { maxPayloadKB = old }(maxPayloadKB)
+	maxPayloadKB = 16
+
+	tests := []struct {
+		query  string
+		wantKB int
+	}{
+		{"?size=10", 10},
+		{"?size=1000", 16}, // capped at MAX_PAYLOAD_KB
+		{"", 0},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleAPIData(rec, httptest.NewRequest(http.MethodGet, "/api/data"+tt.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/data%s = %d", tt.query, rec.Code)
+		}
+		// The rest of the response is a few hundred bytes of fields
+		want := tt.wantKB * 1024
+		if size := rec.Body.Len(); size < want || size > want+512 {
+			t.Errorf("GET /api/data%s body is %d bytes, want %d plus the fields", tt.query, size, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleAPIData(rec, httptest.NewRequest(http.MethodGet, "/api/data?size=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/data?size=-1 = %d, want 400", rec.Code)
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	// net/http allows 4 KB on top of MaxHeaderBytes, so go well past both
+	padding := strings.Repeat("x", 8<<10)
+
+	for _, tt := range []struct {
+		limit string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"1024", http.StatusRequestHeaderFieldsTooLarge},
+	} {
+		if tt.limit != "" {
+			t.Setenv("MAX_HEADER_BYTES", tt.limit)
+		}
+		var server *http.Server
+		var err error
+		captureStdout(t, func() { server, err = newServer("127.0.0.1:0", ok) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.Serve(listener)
+
+		req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/", nil)
+		req.Header.Set("X-Padding", padding)
+		resp, err := http.DefaultClient.Do(req)
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("MAX_HEADER_BYTES=%q: 8 KB header = %d, want %d", tt.limit, resp.StatusCode, tt.want)
+		}
+	}
+
+	t.Setenv("MAX_HEADER_BYTES", "-1")
+	if _, err := newServer("127.0.0.1:0", ok); err == nil {
+		t.Error("MAX_HEADER_BYTES=-1 accepted, want an error")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	defer func(old time.Duration) { clockSkew = old }(clockSkew)
+
+	for _, skew := range []time.Duration{0, 90 * time.Minute, -45 * time.Second} {
+		clockSkew = skew
+		for _, handler := range []http.HandlerFunc{handleRoot, handleAPIData} {
+			// RFC 3339 drops the fraction, so allow for the truncated second
+			before := time.Now().Add(skew).Truncate(time.Second)
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			after := time.Now().Add(skew)
+
+			var body struct {
+				Timestamp string `json:"timestamp"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			got, err := time.Parse(time.RFC3339, body.Timestamp)
+			if err != nil {
+				t.Fatalf("timestamp %q: %v", body.Timestamp, err)
+			}
+			if got.Before(before) || got.After(after) {
+				t.Errorf("CLOCK_SKEW_MS=%d reported %s, want now shifted by %v (between %s and %s)",
+					skew.Milliseconds(), body.Timestamp, skew, before.Format(time.RFC3339), after.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// captureStdout returns what fn printed; the app logs with fmt.Printf.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestStandardStackLogsRequestID(t *testing.T) {
+	var seen string
+	h := middleware.Chain(standardStack()...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.RequestIDFrom(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	logs := captureStdout(t, func() { h.ServeHTTP(rec, req) })
+
+	if seen != "abc-123" {
+		t.Errorf("handler saw request ID %q, want abc-123", seen)
+	}
+	if got := rec.Header().Get(middleware.RequestIDHeader); got != "abc-123" {
+		t.Errorf("response %s = %q, want abc-123", middleware.RequestIDHeader, got)
+	}
+	for _, want := range []string{"Request: GET /api/data from 192.0.2.1 (request abc-123)", "Completed: GET /api/data 200"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestStandardStackRecoversPanics(t *testing.T) {
+	h := middleware.Chain(standardStack()...)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	logs := captureStdout(t, func() { h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil)) })
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	id := rec.Header().Get(middleware.RequestIDHeader)
+	if !strings.Contains(logs, "Panic serving GET / (request "+id+"): boom") || !strings.Contains(logs, "Completed: GET / 500") {
+		t.Errorf("panic not logged with request %s as a 500:\n%s", id, logs)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// startPprof serves the profiling endpoints on ADMIN_PORT when ENABLE_PPROF=true.
+// The public routes use their own mux, so the handlers net/http/pprof registers on
+// http.DefaultServeMux are never reachable through PORT.
+func startPprof() {
+	if getEnv("ENABLE_PPROF", "false") != "true" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	adminPort := getEnv("ADMIN_PORT", "6060")
+	go func() {
+		fmt.Printf("pprof listening on admin port %s\n", adminPort)
+		if err := http.ListenAndServe(":"+adminPort, mux); err != nil {
+			fmt.Printf("pprof server error: %v\n", err)
+		}
+	}()
+}
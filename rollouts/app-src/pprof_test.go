@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing is listening on.
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+func TestPprofToggle(t *testing.T) {
+	off := freePort(t)
+	t.Setenv("ADMIN_PORT", off)
+	t.Setenv("ENABLE_PPROF", "false")
+	startPprof()
+	time.Sleep(50 * time.Millisecond)
+	if resp, err := http.Get("http://127.0.0.1:" + off + "/debug/pprof/goroutine"); err == nil {
+		resp.Body.Close()
+		t.Errorf("ENABLE_PPROF=false but the admin port answered %d", resp.StatusCode)
+	}
+
+	on := freePort(t)
+	t.Setenv("ADMIN_PORT", on)
+	t.Setenv("ENABLE_PPROF", "true")
+	startPprof()
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://127.0.0.1:" + on + "/debug/pprof/goroutine"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("ENABLE_PPROF=true but the admin port is unreachable: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /debug/pprof/goroutine = %d on the admin port, want 200", resp.StatusCode)
+	}
+
+	// The public routes never serve profiles, whatever the flag says
+	rec := httptest.NewRecorder()
+	newMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Error("the public mux served a goroutine profile")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	dependency = newDependencyChecker(getEnv("DEPENDENCY_URL", ""), getEnvDuration("DEPENDENCY_CACHE_TTL", 5*time.Second))
+	memory     = newMemoryPressure(getEnvInt("MEM_PRESSURE_MB", 0), getEnvDuration("MEM_PRESSURE_INTERVAL", 5*time.Second))
+)
+
+// dependencyChecker pings a downstream URL and caches the result for ttl so a busy
+// readiness probe doesn't hammer the dependency.
+type dependencyChecker struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	healthy   bool
+	reason    string
+}
+
+// newDependencyChecker returns nil when url is empty so readiness ignores dependencies.
+func newDependencyChecker(url string, ttl time.Duration) *dependencyChecker {
+	if url == "" {
+		return nil
+	}
+	return &dependencyChecker{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+func (d *dependencyChecker) Status() (bool, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if time.Since(d.checkedAt) < d.ttl {
+		return d.healthy, d.reason
+	}
+
+	d.healthy, d.reason = true, ""
+	resp, err := d.client.Get(d.url)
+	if err != nil {
+		d.healthy, d.reason = false, err.Error()
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			d.healthy, d.reason = false, fmt.Sprintf("dependency returned %d", resp.StatusCode)
+		}
+	}
+	d.checkedAt = time.Now()
+	return d.healthy, d.reason
+}
+
+// memoryPressure reports not-ready once the heap in use passes a limit, so a pod
+// whose memory keeps growing is pulled from rotation before it is OOM-killed.
+// ReadMemStats stops the world, so a reading is reused for interval.
+type memoryPressure struct {
+	limit    uint64
+	interval time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	alloc     uint64
+}
+
+// newMemoryPressure returns nil when limitMB is not positive so readiness ignores memory.
+func newMemoryPressure(limitMB int, interval time.Duration) *memoryPressure {
+	if limitMB <= 0 {
+		return nil
+	}
+	return &memoryPressure{limit: uint64(limitMB) << 20, interval: interval}
+}
+
+// Status reports whether the last reading of runtime.MemStats.Alloc is within the
+// limit, along with the reading.
+func (m *memoryPressure) Status() (bool, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.checkedAt) >= m.interval {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		m.alloc, m.checkedAt = stats.Alloc, time.Now()
+	}
+	return m.alloc <= m.limit, m.alloc
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/readyz", duration)
+	}()
+
+	if dependency != nil {
+		if ok, reason := dependency.Status(); !ok {
+			requestCounter.WithLabelValues(r.Method, "/readyz", "503").Inc()
+			writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+				"status":     "not ready",
+				"dependency": dependency.url,
+				"reason":     reason,
+			})
+			return
+		}
+	}
+
+	if memory != nil {
+		if ok, alloc := memory.Status(); !ok {
+			requestCounter.WithLabelValues(r.Method, "/readyz", "503").Inc()
+			writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+				"status": "not ready",
+				"reason": fmt.Sprintf("heap in use is %d MB, above MEM_PRESSURE_MB=%d", alloc>>20, memory.limit>>20),
+			})
+			return
+		}
+	}
+
+	requestCounter.WithLabelValues(r.Method, "/readyz", "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]string{
+		"status":   "ready",
+		"version":  servedVersion(r),
+		"hostname": hostname,
+	})
+}
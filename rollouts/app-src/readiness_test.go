@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadyzFollowsDependency(t *testing.T) {
+	defer func(d *dependencyChecker) { dependency = d }(dependency)
+
+	var up atomic.Bool
+	var pings atomic.Int64
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer stub.Close()
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	dependency = newDependencyChecker(stub.URL, 0)
+	for _, state := range []bool{true, false, true} {
+		up.Store(state)
+		want := http.StatusOK
+		if !state {
+			want = http.StatusServiceUnavailable
+		}
+		if code := readyz(); code != want {
+			t.Errorf("dependency up=%v: GET /readyz = %d, want %d", state, code, want)
+		}
+	}
+
+	// Within the TTL the cached answer stands, without pinging again
+	dependency = newDependencyChecker(stub.URL, time.Hour)
+	up.Store(true)
+	pings.Store(0)
+	readyz()
+	up.Store(false)
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d inside the cache TTL, want the cached 200", code)
+	}
+	if n := pings.Load(); n != 1 {
+		t.Errorf("dependency pinged %d times inside the cache TTL, want 1", n)
+	}
+
+	dependency = nil
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d without DEPENDENCY_URL, want 200", code)
+	}
+}
+
+func TestReadyzMemoryPressure(t *testing.T) {
+	defer func(m *memoryPressure, enabled bool, token string) {
+		memory, enableAdmin, adminToken = m, enabled, token
+	}(memory, enableAdmin, adminToken)
+	enableAdmin, adminToken = true, "secret"
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	// A limit 32 MB above the heap now, read afresh on every probe
+	memory = newMemoryPressure(int(stats.Alloc>>20)+32, 0)
+	mux := newMux()
+
+	do := func(method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, "/readyz"); code != http.StatusOK {
+		t.Fatalf("GET /readyz = %d before leaking, want 200", code)
+	}
+	if code := do(http.MethodPost, "/admin/leak?mb=64"); code != http.StatusOK {
+		t.Fatalf("POST /admin/leak = %d", code)
+	}
+	if code := do(http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz = %d after leaking past MEM_PRESSURE_MB, want 503", code)
+	}
+	if code := do(http.MethodPost, "/admin/leak/release"); code != http.StatusOK {
+		t.Fatalf("POST /admin/leak/release = %d", code)
+	}
+	if code := do(http.MethodGet, "/readyz"); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d after releasing, want 200", code)
+	}
+}
+
+func TestLeakRejectsBadSizes(t *testing.T) {
+	for _, mb := range []string{"0", "-1", "lots", "1025"} {
+		rec := httptest.NewRecorder()
+		handleLeak(rec, httptest.NewRequest(http.MethodPost, "/admin/leak?mb="+mb, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("mb=%s: status = %d, want 400", mb, rec.Code)
+		}
+	}
+}
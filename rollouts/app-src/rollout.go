@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Rollout metadata, typically injected through the downward API, e.g.
+// metadata.labels['rollouts-pod-template-hash']. Pods started outside Argo
+// Rollouts report "unknown".
+var (
+	rolloutPodTemplateHash = getEnv("ROLLOUT_POD_TEMPLATE_HASH", "unknown")
+	rolloutStatus          = getEnv("ROLLOUT_STATUS", "unknown") // canary or stable
+	podName                = getEnv("POD_NAME", hostname)
+
+	podIP     = getEnv("POD_IP", "unknown")
+	nodeName  = getEnv("NODE_NAME", "unknown")
+	namespace = getEnv("NAMESPACE", "unknown")
+)
+
+func handleRolloutInfo(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/rollout-info", duration)
+	}()
+
+	requestCounter.WithLabelValues(r.Method, "/rollout-info", "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]string{
+		"pod_template_hash": rolloutPodTemplateHash,
+		"status":            rolloutStatus,
+		"pod_name":          podName,
+		"version":           servedVersion(r),
+		"hostname":          hostname,
+	})
+}
+
+// handleWhoami reports which pod answered, to check that traffic and topology
+// spread land where expected.
+func handleWhoami(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/whoami", duration)
+	}()
+
+	requestCounter.WithLabelValues(r.Method, "/whoami", "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]string{
+		"hostname":  hostname,
+		"pod_name":  podName,
+		"pod_ip":    podIP,
+		"node_name": nodeName,
+		"namespace": namespace,
+		"version":   servedVersion(r),
+	})
+}
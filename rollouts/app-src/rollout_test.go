@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// getFields serves GET path through handler and decodes its flat JSON object.
+func getFields(t *testing.T, handler http.HandlerFunc, path string) map[string]string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d", path, rec.Code)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestRolloutInfo(t *testing.T) {
+	if os.Getenv("ROLLOUT_POD_TEMPLATE_HASH") == "" && os.Getenv("ROLLOUT_STATUS") == "" {
+		fields := getFields(t, handleRolloutInfo, "/rollout-info")
+		if fields["pod_template_hash"] != "unknown" || fields["status"] != "unknown" {
+			t.Errorf("without the rollout env vars: %v, want both reported as unknown", fields)
+		}
+	}
+
+	defer func(hash, status, pod string) {
+		rolloutPodTemplateHash, rolloutStatus, podName = hash, status, pod
+	}(rolloutPodTemplateHash, rolloutStatus, podName)
+	t.Setenv("ROLLOUT_POD_TEMPLATE_HASH", "6d4b8f9c7")
+	t.Setenv("ROLLOUT_STATUS", "canary")
+	t.Setenv("POD_NAME", "demo-app-6d4b8f9c7-x2k4q")
+	// Read the way the package does at startup
+	rolloutPodTemplateHash = getEnv("ROLLOUT_POD_TEMPLATE_HASH", "unknown")
+	rolloutStatus = getEnv("ROLLOUT_STATUS", "unknown")
+	podName = getEnv("POD_NAME", hostname)
+
+	fields := getFields(t, handleRolloutInfo, "/rollout-info")
+	for key, want := range map[string]string{
+		"pod_template_hash": "6d4b8f9c7",
+		"status":            "canary",
+		"pod_name":          "demo-app-6d4b8f9c7-x2k4q",
+		"version":           version,
+		"hostname":          hostname,
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %q, want %q", key, fields[key], want)
+		}
+	}
+}
+
+func TestWhoami(t *testing.T) {
+	want, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := getFields(t, handleWhoami, "/whoami")
+	if fields["hostname"] != want {
+		t.Errorf("hostname = %q, want os.Hostname() %q", fields["hostname"], want)
+	}
+	for _, key := range []string{"pod_name", "pod_ip", "node_name", "namespace", "version"} {
+		if fields[key] == "" {
+			t.Errorf("%s is empty, want a value or unknown", key)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// reservedPrefixes stay off-limits to CUSTOM_ROUTES even while the routes under
+// them aren't registered, so enabling admin later can't clash with a custom route.
+var reservedPrefixes = []string{"/admin/", "/api/close"}
+
+const defaultHealthPath = "/health"
+
+// registerHealthRoute serves the health check on HEALTH_PATH. Must be called after
+// the other built-in routes: ServeMux panics on a duplicate pattern, so a path
+// that is malformed or already served is refused with an error and the health
+// check stays on /health, where the pod can still be probed.
+func registerHealthRoute(mux *http.ServeMux) {
+	if err := checkRoute(mux, healthPath); err != nil {
+		fmt.Printf("ERROR: ignoring HEALTH_PATH %q: %v; serving the health check on %s\n", healthPath, err, defaultHealthPath)
+		healthPath = defaultHealthPath
+	}
+	mux.HandleFunc(healthPath, handleHealth)
+}
+
+// registerCustomRoutes adds the comma-separated paths in spec as copies of
+// /api/data, e.g. CUSTOM_ROUTES=/api/v2/items, so a new version can grow its API
+// surface during a rollout without a rebuild. Must be called after the built-in
+// routes: a path that is malformed or already served by one is skipped with a
+// warning, so a typo can't take the pod down.
+func registerCustomRoutes(mux *http.ServeMux, spec string) {
+	for _, route := range strings.Split(spec, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		if err := checkRoute(mux, route); err != nil {
+			fmt.Printf("Ignoring custom route %q: %v\n", route, err)
+			continue
+		}
+		route := route
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			serveData(w, r, route)
+		})
+		fmt.Printf("Serving custom route %s like /api/data\n", route)
+	}
+}
+
+// checkRoute reports why route can't be added to mux, if it can't.
+func checkRoute(mux *http.ServeMux, route string) error {
+	if !strings.HasPrefix(route, "/") || route == "/" || path.Clean(route) != route {
+		return errors.New("expected a clean absolute path such as /api/v2/items")
+	}
+	for _, c := range route {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("/-._~", c)) {
+			return errors.New("only letters, digits and /-._~ are allowed")
+		}
+	}
+	for _, prefix := range reservedPrefixes {
+		if route == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(route, prefix) {
+			return fmt.Errorf("%s is reserved", prefix)
+		}
+	}
+	// Everything unmatched falls through to "/", so any other pattern means a
+	// built-in route, or an earlier added one, already answers this path
+	if _, pattern := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: route}}); pattern != "/" {
+		return fmt.Errorf("collides with the existing route %s", pattern)
+	}
+	return nil
+}
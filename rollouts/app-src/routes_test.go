@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chaos"
+)
+
+func TestHealthPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		healthPath string
+		serves     string // path the health check ends up on
+		notServes  string // path that must not be the health check
+	}{
+		{"custom path", "/healthz", "/healthz", "/health"},
+		{"collides with /metrics", "/metrics", "/health", ""},
+		{"collides with /livez", "/livez", "/health", ""},
+		{"collides with /config", "/config", "/health", ""},
+		{"collides with /", "/", "/health", ""},
+		{"under a subtree route", "/api/jobs/health", "/health", "/api/jobs/health"},
+		{"reserved for admin", "/admin/health", "/health", ""},
+		{"no leading slash", "healthz", "/health", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old string) { healthPath = old }(healthPath)
+			healthPath = tt.healthPath
+
+			mux := newMux()
+			if healthPath != tt.serves {
+				t.Fatalf("healthPath = %q, want %q", healthPath, tt.serves)
+			}
+			if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, tt.serves, nil)); pattern != tt.serves {
+				t.Errorf("%s is served by pattern %q", tt.serves, pattern)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.serves, nil))
+			if rec.Code != http.StatusOK && rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("GET %s = %d, want the health check", tt.serves, rec.Code)
+			}
+			if tt.notServes != "" {
+				if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, tt.notServes, nil)); pattern == tt.notServes {
+					t.Errorf("%s is still served by its own pattern", tt.notServes)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomRoutes(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	t.Setenv("CUSTOM_ROUTES", " /api/v2/items, /metrics,/api/data, /admin/items, /api/close, api/v3, /api/v2/../items, /api/v2/items,")
+	mux := newMux()
+
+	fields := func(path string) map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, rec.Code)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return body
+	}
+	data, custom := fields("/api/data"), fields("/api/v2/items")
+	for key := range data {
+		if _, ok := custom[key]; !ok {
+			t.Errorf("custom route is missing %q from the /api/data shape", key)
+		}
+	}
+	if len(custom) != len(data) || custom["endpoint"] != "/api/v2/items" || data["endpoint"] != "/api/data" {
+		t.Errorf("custom route = %v, want the /api/data shape with its own endpoint; /api/data = %v", custom, data)
+	}
+
+	// Collisions stay with their built-in handlers; rejected paths aren't served
+	for path, want := range map[string]string{
+		"/metrics":     "/metrics",
+		"/api/data":    "/api/data",
+		"/admin/items": "/",
+		"/api/close":   "/",
+		"/api/v3":      "/",
+	} {
+		if _, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, path, nil)); pattern != want {
+			t.Errorf("%s is served by %q, want %q", path, pattern, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"chaos"
+)
+
+// crashOnStart exits with status 1 with probability p, so a canary configured with
+// CRASH_ON_START_PROBABILITY lands in CrashLoopBackOff and the rollout has to
+// handle it. exit is injected so the decision can be exercised without dying.
+func crashOnStart(p float64, exit func(int)) {
+	if p <= 0 {
+		return
+	}
+	roll := rng.Float64()
+	if roll < p {
+		fmt.Printf("Simulated startup crash (CRASH_ON_START_PROBABILITY=%v, roll %.3f), exiting with status 1\n", p, roll)
+		exit(1)
+		return
+	}
+	fmt.Printf("Surviving startup (CRASH_ON_START_PROBABILITY=%v, roll %.3f)\n", p, roll)
+}
+
+// checkBehavior returns the behavior to run as. An unknown BEHAVIOR would behave
+// like normal and hide a typo in the manifest, so it is warned about, or with
+// strict set exits with status 1 through exit.
+func checkBehavior(b chaos.Behavior, strict bool, exit func(int)) chaos.Behavior {
+	if b.Known() {
+		return b
+	}
+	valid := make([]string, len(chaos.Behaviors))
+	for i, known := range chaos.Behaviors {
+		valid[i] = string(known)
+	}
+	if strict {
+		fmt.Printf("Unknown BEHAVIOR %q, expected one of %s\n", b, strings.Join(valid, ", "))
+		exit(1)
+		return b
+	}
+	fmt.Printf("WARNING: unknown BEHAVIOR %q, running as normal; expected one of %s\n", b, strings.Join(valid, ", "))
+	return chaos.Normal
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"chaos"
+)
+
+func TestCrashOnStart(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+
+	var codes []int
+	out := captureStdout(t, func() {
+		crashOnStart(1, func(code int) { codes = append(codes, code) })
+	})
+	if len(codes) != 1 || codes[0] != 1 {
+		t.Fatalf("CRASH_ON_START_PROBABILITY=1: exit called with %v, want once with 1", codes)
+	}
+	if !strings.Contains(out, "Simulated startup crash") {
+		t.Errorf("crash decision not logged: %q", out)
+	}
+
+	tests := []struct {
+		p        float64
+		min, max int // exits over 1000 startups
+	}{
+		{0, 0, 0},
+		{-1, 0, 0},
+		{0.5, 400, 600},
+		{1, 1000, 1000},
+	}
+	for _, tt := range tests {
+		exits := 0
+		captureStdout(t, func() {
+			for i := 0; i < 1000; i++ {
+				crashOnStart(tt.p, func(int) { exits++ })
+			}
+		})
+		if exits < tt.min || exits > tt.max {
+			t.Errorf("CRASH_ON_START_PROBABILITY=%v: exited %d of 1000 startups, want %d to %d", tt.p, exits, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCheckBehavior(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior chaos.Behavior
+		strict   bool
+		want     chaos.Behavior
+		exits    int
+		log      string
+	}{
+		{"known", chaos.Slow, false, chaos.Slow, 0, ""},
+		{"known in strict mode", chaos.ErrorProne, true, chaos.ErrorProne, 0, ""},
+		{"typo", "slwo", false, chaos.Normal, 0, `WARNING: unknown BEHAVIOR "slwo", running as normal`},
+		{"typo in strict mode", "slwo", true, "slwo", 1, `Unknown BEHAVIOR "slwo"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exits := 0
+			var got chaos.Behavior
+			out := captureStdout(t, func() {
+				got = checkBehavior(tt.behavior, tt.strict, func(code int) {
+					if code != 1 {
+						t.Errorf("exit(%d), want 1", code)
+					}
+					exits++
+				})
+			})
+			if exits != tt.exits {
+				t.Errorf("exited %d times, want %d", exits, tt.exits)
+			}
+			if tt.exits == 0 && got != tt.want {
+				t.Errorf("runs as %q, want %q", got, tt.want)
+			}
+			if tt.log == "" {
+				if out != "" {
+					t.Errorf("logged %q for a known behavior", out)
+				}
+				return
+			}
+			if !strings.Contains(out, tt.log) || !strings.Contains(out, string(chaos.ErrorProne)) {
+				t.Errorf("logged %q, want %q and the valid options", out, tt.log)
+			}
+		})
+	}
+}
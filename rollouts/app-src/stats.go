@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsWindow is how many recent requests per endpoint /stats computes percentiles over.
+var statsWindow = max(getEnvInt("STATS_WINDOW", 1000), 1)
+
+const overallEndpoint = "all"
+
+// latencyRing keeps the last len(samples) request durations, in seconds.
+type latencyRing struct {
+	samples []float64
+	next    int
+	full    bool
+}
+
+func (l *latencyRing) add(seconds float64) {
+	l.samples[l.next] = seconds
+	l.next = (l.next + 1) % len(l.samples)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+func (l *latencyRing) sorted() []float64 {
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	out := make([]float64, n)
+	copy(out, l.samples[:n])
+	sort.Float64s(out)
+	return out
+}
+
+// latencyStats holds a bounded window of recent durations per endpoint, so
+// percentiles are available without a Prometheus server.
+type latencyStats struct {
+	mu        sync.Mutex
+	window    int
+	endpoints map[string]*latencyRing
+}
+
+var stats = &latencyStats{window: statsWindow, endpoints: make(map[string]*latencyRing)}
+
+func (s *latencyStats) observe(endpoint string, seconds float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range []string{endpoint, overallEndpoint} {
+		ring, ok := s.endpoints[name]
+		if !ok {
+			ring = &latencyRing{samples: make([]float64, s.window)}
+			s.endpoints[name] = ring
+		}
+		ring.add(seconds)
+	}
+}
+
+type latencySummary struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+func (s *latencyStats) summary() map[string]latencySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]latencySummary, len(s.endpoints))
+	for name, ring := range s.endpoints {
+		sorted := ring.sorted()
+		out[name] = latencySummary{
+			Count: len(sorted),
+			P50Ms: toMillis(percentile(sorted, 0.50)),
+			P90Ms: toMillis(percentile(sorted, 0.90)),
+			P99Ms: toMillis(percentile(sorted, 0.99)),
+		}
+	}
+	return out
+}
+
+// toMillis converts seconds to milliseconds rounded to the microsecond.
+func toMillis(seconds float64) float64 {
+	return math.Round(seconds*1e6) / 1e3
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/stats", duration)
+	}()
+
+	requestCounter.WithLabelValues(r.Method, "/stats", "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"window":    statsWindow,
+		"endpoints": stats.summary(),
+		"hostname":  hostname,
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestLatencyStats(t *testing.T) {
+	s := &latencyStats{window: 100, endpoints: make(map[string]*latencyRing)}
+	// 1..200 ms; only the last 100 stay in the window
+	for ms := 1; ms <= 200; ms++ {
+		s.observe("/api/data", float64(ms)/1000)
+	}
+	s.observe("/api/process", 0.5)
+
+	got := s.summary()
+	want := latencySummary{Count: 100, P50Ms: 150, P90Ms: 190, P99Ms: 199}
+	if got["/api/data"] != want {
+		t.Errorf("/api/data = %+v, want %+v", got["/api/data"], want)
+	}
+	if p := got["/api/process"]; p.Count != 1 || p.P50Ms != 500 || p.P99Ms != 500 {
+		t.Errorf("/api/process = %+v, want its single 500ms sample", p)
+	}
+	// The overall window holds the 99 newest /api/data samples and the /api/process one
+	if all := got[overallEndpoint]; all.Count != 100 || all.P50Ms != 151 || all.P99Ms != 200 {
+		t.Errorf("all = %+v, want 100 samples from 102ms to 500ms", all)
+	}
+}
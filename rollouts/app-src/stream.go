@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxStreamChunks = 1000
+	// maxStreamDuration keeps chunks*delay under the server's 10s WriteTimeout,
+	// which would otherwise cut the stream off mid-way
+	maxStreamDuration = 9 * time.Second
+)
+
+// handleStream writes ?chunks= JSON lines, flushing each one and sleeping ?delay=
+// between them, to show how proxies' timeouts and buffering treat a response that
+// trickles in. It stops early when the client goes away.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/api/stream", duration)
+	}()
+
+	chunks, delay, err := parseStreamParams(r)
+	if err != nil {
+		requestCounter.WithLabelValues(r.Method, "/api/stream", "400").Inc()
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		requestCounter.WithLabelValues(r.Method, "/api/stream", "500").Inc()
+		writeError(w, r, http.StatusInternalServerError, "streaming is not supported by this connection")
+		return
+	}
+
+	status, ok := simulate(r)
+	if !ok {
+		return
+	}
+	requestCounter.WithLabelValues(r.Method, "/api/stream", fmt.Sprintf("%d", status)).Inc()
+
+	if status != http.StatusOK {
+		writeError(w, r, status, http.StatusText(status))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	// Ask nginx-style proxies not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for i := 1; i <= chunks; i++ {
+		if i > 1 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				fmt.Printf("Stream to %s canceled after %d of %d chunks\n", r.RemoteAddr, i-1, chunks)
+				return
+			}
+		}
+		enc.Encode(map[string]interface{}{
+			"chunk":      i,
+			"chunks":     chunks,
+			"elapsed_ms": time.Since(start).Milliseconds(),
+			"version":    servedVersion(r),
+			"hostname":   hostname,
+			"timestamp":  reportedTime(time.Now()),
+		})
+		flusher.Flush()
+	}
+}
+
+func parseStreamParams(r *http.Request) (int, time.Duration, error) {
+	q := r.URL.Query()
+	chunks, delay := 10, 100*time.Millisecond
+	if raw := q.Get("chunks"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxStreamChunks {
+			return 0, 0, fmt.Errorf("chunks must be an integer from 1 to %d", maxStreamChunks)
+		}
+		chunks = n
+	}
+	if raw := q.Get("delay"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return 0, 0, errors.New("delay must be a non-negative duration, e.g. 100ms")
+		}
+		delay = d
+	}
+	if total := time.Duration(chunks-1) * delay; total > maxStreamDuration {
+		return 0, 0, fmt.Errorf("chunks*delay is %s, the limit is %s", total, maxStreamDuration)
+	}
+	return chunks, delay, nil
+}
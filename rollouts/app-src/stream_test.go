@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chaos"
+)
+
+func TestStreamChunksArriveOverTime(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	server := httptest.NewServer(http.HandlerFunc(handleStream))
+	defer server.Close()
+
+	const chunks, delay = 5, 50 * time.Millisecond
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/api/stream?chunks=5&delay=50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d, Content-Type %q; want a 200 NDJSON stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var arrivals []time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		arrivals = append(arrivals, time.Since(start))
+		var line struct {
+			Chunk  int `json:"chunk"`
+			Chunks int `json:"chunks"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		if line.Chunk != len(arrivals) || line.Chunks != chunks {
+			t.Errorf("line %d is chunk %d of %d, want %d of %d", len(arrivals), line.Chunk, line.Chunks, len(arrivals), chunks)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) != chunks {
+		t.Fatalf("got %d chunks, want %d", len(arrivals), chunks)
+	}
+	// Flushed chunks trickle in; a buffered response would land all at once
+	if spread := arrivals[chunks-1] - arrivals[0]; spread < (chunks-1)*delay*3/4 {
+		t.Errorf("chunks arrived over %v, want about %v, each flushed after its delay", spread, (chunks-1)*delay)
+	}
+}
+
+func TestStreamBounds(t *testing.T) {
+	useBehavior(t, chaos.Normal, "1")
+	for _, query := range []string{"chunks=0", "chunks=1001", "chunks=x", "delay=-1s", "delay=soon", "chunks=100&delay=1s"} {
+		rec := httptest.NewRecorder()
+		handleStream(rec, httptest.NewRequest(http.MethodGet, "/api/stream?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
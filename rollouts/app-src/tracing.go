@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tracingEnabled attaches the caller's trace ID as an exemplar on
+// http_request_duration_seconds so Grafana can jump from a latency bucket to the trace.
+var tracingEnabled = getEnv("TRACING_ENABLED", "false") == "true"
+
+// observeDuration records one request in requestDuration, with an exemplar when
+// tracing is enabled and the request carries a trace, and in the /stats window.
+func observeDuration(r *http.Request, endpoint string, seconds float64) {
+	stats.observe(endpoint, seconds)
+	observer := requestDuration.WithLabelValues(r.Method, endpoint, servedVersion(r), string(behavior))
+	if tracingEnabled {
+		if id := traceID(r); id != "" {
+			if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+				eo.ObserveWithExemplar(seconds, prometheus.Labels{"trace_id": id})
+				return
+			}
+		}
+	}
+	observer.Observe(seconds)
+}
+
+// traceID returns the trace ID of a W3C traceparent header
+// ("00-<trace-id>-<span-id>-<flags>"), or "" when there is no valid one.
+func traceID(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+	for _, c := range parts[1] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+	return parts[1]
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"chaos"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// exemplarTraceIDs returns the trace_id of every exemplar on the
+// http_request_duration_seconds buckets for endpoint.
+func exemplarTraceIDs(t *testing.T, endpoint string) []string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			matches := false
+			for _, label := range m.GetLabel() {
+				matches = matches || label.GetName() == "endpoint" && label.GetValue() == endpoint
+			}
+			if !matches {
+				continue
+			}
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				for _, label := range bucket.GetExemplar().GetLabel() {
+					if label.GetName() == "trace_id" {
+						ids = append(ids, label.GetValue())
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func TestObserveDurationExemplar(t *testing.T) {
+	defer func(old bool) { tracingEnabled = old }(tracingEnabled)
+
+	tests := []struct {
+		endpoint    string
+		enabled     bool
+		traceparent string
+		want        string
+	}{
+		{"/test/traced", true, testTraceparent, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"/test/untraced", true, "", ""},
+		{"/test/tracing-off", false, testTraceparent, ""},
+	}
+	for _, tt := range tests {
+		tracingEnabled = tt.enabled
+		r := httptest.NewRequest(http.MethodGet, tt.endpoint, nil)
+		if tt.traceparent != "" {
+			r.Header.Set("traceparent", tt.traceparent)
+		}
+		observeDuration(r, tt.endpoint, 0.042)
+
+		ids := exemplarTraceIDs(t, tt.endpoint)
+		switch {
+		case tt.want == "" && len(ids) > 0:
+			t.Errorf("%s: exemplars %v, want none", tt.endpoint, ids)
+		case tt.want != "" && (len(ids) != 1 || ids[0] != tt.want):
+			t.Errorf("%s: exemplars %v, want one with trace_id %s", tt.endpoint, ids, tt.want)
+		}
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	tests := map[string]string{
+		testTraceparent: "4bf92f3577b34da6a3ce929d0e0e4736",
+		"":              "",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01":                 "",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("traceparent", header)
+		if got := traceID(r); got != want {
+			t.Errorf("traceID(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// durationSamples returns how many samples the http_request_duration_seconds
+// series with exactly labels holds, and false when there is no such series.
+func durationSamples(t *testing.T, labels map[string]string) (uint64, bool) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			got := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				got[label.GetName()] = label.GetValue()
+			}
+			if reflect.DeepEqual(got, labels) {
+				return m.GetHistogram().GetSampleCount(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestObserveDurationLabels(t *testing.T) {
+	useBehavior(t, chaos.ErrorProne, "1")
+	labels := map[string]string{"method": "GET", "endpoint": "/api/data", "version": "2.0.0-canary", "behavior": "error-prone"}
+	before, _ := durationSamples(t, labels)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	r = r.WithContext(context.WithValue(r.Context(), servedVersionKey{}, "2.0.0-canary"))
+	observeDuration(r, "/api/data", 0.042)
+
+	n, ok := durationSamples(t, labels)
+	if !ok {
+		t.Fatalf("no http_request_duration_seconds series labelled %v", labels)
+	}
+	if n != before+1 {
+		t.Errorf("series %v has %d samples, want %d", labels, n, before+1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// weightedVersion is one entry of VERSION_WEIGHTS, e.g. "1.1:30".
+type weightedVersion struct {
+	version string
+	weight  int
+}
+
+type servedVersionKey struct{}
+
+var versionWeights = parseVersionWeights(getEnv("VERSION_WEIGHTS", ""))
+
+// parseVersionWeights reads "version:weight" pairs; malformed or non-positive
+// entries are skipped so a typo can't take the pod down.
+func parseVersionWeights(spec string) []weightedVersion {
+	var weights []weightedVersion
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		v, raw, ok := strings.Cut(entry, ":")
+		weight, err := strconv.Atoi(strings.TrimSpace(raw))
+		if !ok || strings.TrimSpace(v) == "" || err != nil || weight <= 0 {
+			fmt.Printf("Ignoring invalid version weight %q, expected version:weight\n", entry)
+			continue
+		}
+		weights = append(weights, weightedVersion{version: strings.TrimSpace(v), weight: weight})
+	}
+	return weights
+}
+
+// pickVersion draws a version according to VERSION_WEIGHTS, or returns VERSION when
+// no weights are configured.
+func pickVersion() string {
+	total := 0
+	for _, wv := range versionWeights {
+		total += wv.weight
+	}
+	if total == 0 {
+		return version
+	}
+
+	n := rng.Intn(total)
+	for _, wv := range versionWeights {
+		if n < wv.weight {
+			return wv.version
+		}
+		n -= wv.weight
+	}
+	return versionWeights[len(versionWeights)-1].version
+}
+
+// withServedVersion decides which version answers the request, advertises it in
+// X-App-Version and makes it available to handlers through servedVersion.
+func withServedVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := pickVersion()
+		if len(versionWeights) > 0 {
+			versionGauge.WithLabelValues(v, string(behavior), hostname).Inc()
+		}
+		w.Header().Set("X-App-Version", v)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), servedVersionKey{}, v)))
+	})
+}
+
+func servedVersion(r *http.Request) string {
+	if v, ok := r.Context().Value(servedVersionKey{}).(string); ok {
+		return v
+	}
+	return version
+}
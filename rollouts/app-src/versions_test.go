@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chaos"
+)
+
+func TestVersionWeightsDistribution(t *testing.T) {
+	defer func(old []weightedVersion) { versionWeights = old }(versionWeights)
+	versionWeights = parseVersionWeights("1.0:70,1.1:30")
+	useBehavior(t, chaos.Normal, "7")
+	// Served versions count up app_version_info; leave no series for later tests
+	defer versionGauge.Reset()
+
+	const n = 10000
+	h := withServedVersion(http.HandlerFunc(handleRoot))
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var body Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if header := rec.Header().Get("X-App-Version"); header != body.Version {
+			t.Fatalf("X-App-Version %q but the body says %q", header, body.Version)
+		}
+		counts[body.Version]++
+	}
+
+	if len(counts) != 2 {
+		t.Fatalf("served versions %v, want only 1.0 and 1.1", counts)
+	}
+	// Three standard deviations of a 70/30 split over n draws is about 1.4 points
+	for v, want := range map[string]float64{"1.0": 0.7, "1.1": 0.3} {
+		if got := float64(counts[v]) / n; math.Abs(got-want) > 0.02 {
+			t.Errorf("version %s served %.3f of the time, want %.2f", v, got, want)
+		}
+	}
+}
+
+func TestParseVersionWeightsSkipsInvalid(t *testing.T) {
+	got := parseVersionWeights("1.0:70, bad, 1.1:0, :5, 1.2:x, 1.3:30")
+	if len(got) != 2 || got[0] != (weightedVersion{"1.0", 70}) || got[1] != (weightedVersion{"1.3", 30}) {
+		t.Errorf("parseVersionWeights() = %v, want 1.0:70 and 1.3:30", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// watchdog notices handlers that hang: when requests are in flight but none has
+// completed for WATCHDOG_TIMEOUT, /livez starts failing so the kubelet restarts the pod.
+type watchdog struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	// progress is the last time a request completed, or the first one started after an idle spell
+	progress time.Time
+}
+
+// probePaths, and healthPath, are not tracked; kubelet probes completing would
+// otherwise hide a hang.
+var probePaths = map[string]bool{"/livez": true, "/readyz": true, "/metrics": true, "/stats": true}
+
+var watchdogTimeout = getEnvDuration("WATCHDOG_TIMEOUT", 0)
+
+var liveness = newWatchdog(watchdogTimeout)
+
+// newWatchdog returns nil when timeout is zero, which disables the watchdog.
+func newWatchdog(timeout time.Duration) *watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	fmt.Printf("Watchdog enabled: /livez fails after %s without a completed request\n", timeout)
+	return &watchdog{timeout: timeout, progress: time.Now()}
+}
+
+func (wd *watchdog) Middleware(next http.Handler) http.Handler {
+	if wd == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probePaths[r.URL.Path] || r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		wd.mu.Lock()
+		if wd.inFlight == 0 {
+			wd.progress = time.Now()
+		}
+		wd.inFlight++
+		wd.mu.Unlock()
+
+		defer func() {
+			wd.mu.Lock()
+			wd.inFlight--
+			wd.progress = time.Now()
+			wd.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stuck reports whether requests are in flight and none has completed within the
+// timeout, along with how long it has been.
+func (wd *watchdog) Stuck() (bool, time.Duration) {
+	if wd == nil {
+		return false, 0
+	}
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	since := time.Since(wd.progress)
+	return wd.inFlight > 0 && since > wd.timeout, since
+}
+
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start).Seconds()
+		observeDuration(r, "/livez", duration)
+	}()
+
+	if stuck, since := liveness.Stuck(); stuck {
+		requestCounter.WithLabelValues(r.Method, "/livez", "503").Inc()
+		writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{
+			"status": "stuck",
+			"reason": fmt.Sprintf("no request completed in %s", since.Round(time.Second)),
+		})
+		return
+	}
+
+	requestCounter.WithLabelValues(r.Method, "/livez", "200").Inc()
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": "alive"})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func livez() int {
+	rec := httptest.NewRecorder()
+	handleLivez(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	return rec.Code
+}
+
+func TestWatchdogFailsLivezOnStuckHandler(t *testing.T) {
+	defer func(old *watchdog) { liveness = old }(liveness)
+	liveness = newWatchdog(50 * time.Millisecond)
+
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	h := liveness.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/process", nil))
+	}()
+	<-started
+
+	if code := livez(); code != http.StatusOK {
+		t.Errorf("GET /livez = %d right after the request started, want 200", code)
+	}
+	deadline := time.Now().Add(time.Second)
+	for livez() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("GET /livez still passing a second into a stuck request, want 503 after WATCHDOG_TIMEOUT")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	<-done
+	if code := livez(); code != http.StatusOK {
+		t.Errorf("GET /livez = %d once the request completed, want 200", code)
+	}
+}
+
+func TestWatchdogIgnoresIdlePods(t *testing.T) {
+	defer func(old *watchdog) { liveness = old }(liveness)
+	liveness = newWatchdog(10 * time.Millisecond)
+
+	// Nothing in flight is not a hang, however long it has been quiet
+	time.Sleep(30 * time.Millisecond)
+	if code := livez(); code != http.StatusOK {
+		t.Errorf("GET /livez = %d on an idle pod, want 200", code)
+	}
+}
@@ -140,7 +140,8 @@ build_version() {
     local full_image_name="${DOCKER_USERNAME}/${APP_NAME}:${image_tag}"
     
     echo "Building image: $full_image_name"
-    docker build -t "$full_image_name" -f "$dockerfile_path" "$SCRIPT_DIR/app-src"
+    # The repository root is the context, so the shared chaos, config and middleware modules are included
+    docker build -t "$full_image_name" -f "$dockerfile_path" "$SCRIPT_DIR/.."
     
     if [[ "$PUSH_IMAGES" == true ]]; then
         echo "Pushing to registry..."